@@ -114,3 +114,205 @@ func NewAssignExpr(Name token.Token, Value Expr) *AssignExpr {
 
 func (a *AssignExpr) Accept(v IASTVisitor) (any, error) { return v.VisitAssignExpr(a)}
 
+type FunctionExpr struct {
+	Keyword token.Token
+	Params []token.Token
+	Body []Stmt
+}
+
+func NewFunctionExpr(Keyword token.Token, Params []token.Token, Body []Stmt) *FunctionExpr {
+	return &FunctionExpr{
+		Keyword: Keyword,
+		Params: Params,
+		Body: Body,
+	}
+}
+
+func (f *FunctionExpr) Accept(v IASTVisitor) (any, error) { return v.VisitFunctionExpr(f)}
+
+type ListExpr struct {
+	Bracket token.Token
+	Elements []Expr
+}
+
+func NewListExpr(Bracket token.Token, Elements []Expr) *ListExpr {
+	return &ListExpr{
+		Bracket: Bracket,
+		Elements: Elements,
+	}
+}
+
+func (l *ListExpr) Accept(v IASTVisitor) (any, error) { return v.VisitListExpr(l)}
+
+type IndexExpr struct {
+	Object Expr
+	Bracket token.Token
+	Index Expr
+}
+
+func NewIndexExpr(Object Expr, Bracket token.Token, Index Expr) *IndexExpr {
+	return &IndexExpr{
+		Object: Object,
+		Bracket: Bracket,
+		Index: Index,
+	}
+}
+
+func (i *IndexExpr) Accept(v IASTVisitor) (any, error) { return v.VisitIndexExpr(i)}
+
+type SliceExpr struct {
+	Object Expr
+	Bracket token.Token
+	Start Expr
+	End Expr
+}
+
+func NewSliceExpr(Object Expr, Bracket token.Token, Start Expr, End Expr) *SliceExpr {
+	return &SliceExpr{
+		Object: Object,
+		Bracket: Bracket,
+		Start: Start,
+		End: End,
+	}
+}
+
+func (s *SliceExpr) Accept(v IASTVisitor) (any, error) { return v.VisitSliceExpr(s)}
+
+type IndexSetExpr struct {
+	Object Expr
+	Bracket token.Token
+	Index Expr
+	Value Expr
+}
+
+func NewIndexSetExpr(Object Expr, Bracket token.Token, Index Expr, Value Expr) *IndexSetExpr {
+	return &IndexSetExpr{
+		Object: Object,
+		Bracket: Bracket,
+		Index: Index,
+		Value: Value,
+	}
+}
+
+func (i *IndexSetExpr) Accept(v IASTVisitor) (any, error) { return v.VisitIndexSetExpr(i)}
+
+type MapExpr struct {
+	Bracket token.Token
+	Keys []Expr
+	Values []Expr
+}
+
+func NewMapExpr(Bracket token.Token, Keys []Expr, Values []Expr) *MapExpr {
+	return &MapExpr{
+		Bracket: Bracket,
+		Keys: Keys,
+		Values: Values,
+	}
+}
+
+func (m *MapExpr) Accept(v IASTVisitor) (any, error) { return v.VisitMapExpr(m)}
+
+type GetExpr struct {
+	Object Expr
+	Name token.Token
+}
+
+func NewGetExpr(Object Expr, Name token.Token) *GetExpr {
+	return &GetExpr{
+		Object: Object,
+		Name: Name,
+	}
+}
+
+func (g *GetExpr) Accept(v IASTVisitor) (any, error) { return v.VisitGetExpr(g)}
+
+type SetExpr struct {
+	Object Expr
+	Name token.Token
+	Value Expr
+}
+
+func NewSetExpr(Object Expr, Name token.Token, Value Expr) *SetExpr {
+	return &SetExpr{
+		Object: Object,
+		Name: Name,
+		Value: Value,
+	}
+}
+
+func (s *SetExpr) Accept(v IASTVisitor) (any, error) { return v.VisitSetExpr(s)}
+
+type ThisExpr struct {
+	Keyword token.Token
+}
+
+func NewThisExpr(Keyword token.Token) *ThisExpr {
+	return &ThisExpr{
+		Keyword: Keyword,
+	}
+}
+
+func (t *ThisExpr) Accept(v IASTVisitor) (any, error) { return v.VisitThisExpr(t)}
+
+type SuperExpr struct {
+	Keyword token.Token
+	Method token.Token
+}
+
+func NewSuperExpr(Keyword token.Token, Method token.Token) *SuperExpr {
+	return &SuperExpr{
+		Keyword: Keyword,
+		Method: Method,
+	}
+}
+
+func (s *SuperExpr) Accept(v IASTVisitor) (any, error) { return v.VisitSuperExpr(s)}
+
+type WithExpr struct {
+	Object Expr
+	Keyword token.Token
+	Names []token.Token
+	Values []Expr
+}
+
+func NewWithExpr(Object Expr, Keyword token.Token, Names []token.Token, Values []Expr) *WithExpr {
+	return &WithExpr{
+		Object: Object,
+		Keyword: Keyword,
+		Names: Names,
+		Values: Values,
+	}
+}
+
+func (w *WithExpr) Accept(v IASTVisitor) (any, error) { return v.VisitWithExpr(w)}
+
+type InterpolationExpr struct {
+	Start token.Token
+	Parts []Expr
+}
+
+func NewInterpolationExpr(Start token.Token, Parts []Expr) *InterpolationExpr {
+	return &InterpolationExpr{
+		Start: Start,
+		Parts: Parts,
+	}
+}
+
+func (i *InterpolationExpr) Accept(v IASTVisitor) (any, error) { return v.VisitInterpolationExpr(i)}
+
+type CompoundAssignExpr struct {
+	Target Expr
+	Operator token.Token
+	Value Expr
+}
+
+func NewCompoundAssignExpr(Target Expr, Operator token.Token, Value Expr) *CompoundAssignExpr {
+	return &CompoundAssignExpr{
+		Target: Target,
+		Operator: Operator,
+		Value: Value,
+	}
+}
+
+func (c *CompoundAssignExpr) Accept(v IASTVisitor) (any, error) { return v.VisitCompoundAssignExpr(c)}
+
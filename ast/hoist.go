@@ -0,0 +1,39 @@
+package ast
+
+import "github.com/Toolnado/sludge/token"
+
+// HoistedVars returns the "var" declarations of a function body or program,
+// including those nested in blocks, conditionals, loops and try statements
+// but not those of nested functions and classes. A var belongs to the
+// whole function it is declared in, so it is defined before the body runs.
+func HoistedVars(stmts []Stmt) []*VarStmt {
+	vars := []*VarStmt{}
+	var walk func(stmt Stmt)
+	walk = func(stmt Stmt) {
+		switch s := stmt.(type) {
+		case *VarStmt:
+			if s.Keyword.Type == token.VAR {
+				vars = append(vars, s)
+			}
+		case *BlockStmt:
+			for _, stmt := range s.Statements {
+				walk(stmt)
+			}
+		case *IfStmt:
+			walk(s.ThenBranch)
+			walk(s.ElseBranch)
+		case *WhileStmt:
+			walk(s.Body)
+		case *TryStmt:
+			for _, stmts := range [][]Stmt{s.Body, s.Catch, s.Finally} {
+				for _, stmt := range stmts {
+					walk(stmt)
+				}
+			}
+		}
+	}
+	for _, stmt := range stmts {
+		walk(stmt)
+	}
+	return vars
+}
@@ -27,12 +27,14 @@ func NewExprStmt(Expession Expr) *ExprStmt {
 func (e *ExprStmt) Accept(v IASTVisitor) (any, error) { return v.VisitExprStmt(e)}
 
 type VarStmt struct {
+	Keyword token.Token
 	Name token.Token
 	Initializer Expr
 }
 
-func NewVarStmt(Name token.Token, Initializer Expr) *VarStmt {
+func NewVarStmt(Keyword token.Token, Name token.Token, Initializer Expr) *VarStmt {
 	return &VarStmt{
+		Keyword: Keyword,
 		Name: Name,
 		Initializer: Initializer,
 	}
@@ -71,12 +73,14 @@ func (i *IfStmt) Accept(v IASTVisitor) (any, error) { return v.VisitIfStmt(i)}
 type WhileStmt struct {
 	Condition Expr
 	Body Stmt
+	Increment Expr
 }
 
-func NewWhileStmt(Condition Expr, Body Stmt) *WhileStmt {
+func NewWhileStmt(Condition Expr, Body Stmt, Increment Expr) *WhileStmt {
 	return &WhileStmt{
 		Condition: Condition,
 		Body: Body,
+		Increment: Increment,
 	}
 }
 
@@ -98,3 +102,135 @@ func NewFunctionStmt(Name token.Token, Params []token.Token, Body []Stmt) *Funct
 
 func (f *FunctionStmt) Accept(v IASTVisitor) (any, error) { return v.VisitFunctionStmt(f)}
 
+type ReturnStmt struct {
+	Keyword token.Token
+	Value Expr
+}
+
+func NewReturnStmt(Keyword token.Token, Value Expr) *ReturnStmt {
+	return &ReturnStmt{
+		Keyword: Keyword,
+		Value: Value,
+	}
+}
+
+func (r *ReturnStmt) Accept(v IASTVisitor) (any, error) { return v.VisitReturnStmt(r)}
+
+type BreakStmt struct {
+	Keyword token.Token
+}
+
+func NewBreakStmt(Keyword token.Token) *BreakStmt {
+	return &BreakStmt{
+		Keyword: Keyword,
+	}
+}
+
+func (b *BreakStmt) Accept(v IASTVisitor) (any, error) { return v.VisitBreakStmt(b)}
+
+type ContinueStmt struct {
+	Keyword token.Token
+}
+
+func NewContinueStmt(Keyword token.Token) *ContinueStmt {
+	return &ContinueStmt{
+		Keyword: Keyword,
+	}
+}
+
+func (c *ContinueStmt) Accept(v IASTVisitor) (any, error) { return v.VisitContinueStmt(c)}
+
+type ClassStmt struct {
+	Name token.Token
+	Superclass *VariableExpr
+	Methods []*FunctionStmt
+}
+
+func NewClassStmt(Name token.Token, Superclass *VariableExpr, Methods []*FunctionStmt) *ClassStmt {
+	return &ClassStmt{
+		Name: Name,
+		Superclass: Superclass,
+		Methods: Methods,
+	}
+}
+
+func (c *ClassStmt) Accept(v IASTVisitor) (any, error) { return v.VisitClassStmt(c)}
+
+type RecordStmt struct {
+	Name token.Token
+	Fields []token.Token
+}
+
+func NewRecordStmt(Name token.Token, Fields []token.Token) *RecordStmt {
+	return &RecordStmt{
+		Name: Name,
+		Fields: Fields,
+	}
+}
+
+func (r *RecordStmt) Accept(v IASTVisitor) (any, error) { return v.VisitRecordStmt(r)}
+
+type ImportStmt struct {
+	Keyword token.Token
+	Path token.Token
+	Alias token.Token
+	Names []token.Token
+}
+
+func NewImportStmt(Keyword token.Token, Path token.Token, Alias token.Token, Names []token.Token) *ImportStmt {
+	return &ImportStmt{
+		Keyword: Keyword,
+		Path: Path,
+		Alias: Alias,
+		Names: Names,
+	}
+}
+
+func (i *ImportStmt) Accept(v IASTVisitor) (any, error) { return v.VisitImportStmt(i)}
+
+type EmitStmt struct {
+	Value Expr
+}
+
+func NewEmitStmt(Value Expr) *EmitStmt {
+	return &EmitStmt{
+		Value: Value,
+	}
+}
+
+func (e *EmitStmt) Accept(v IASTVisitor) (any, error) { return v.VisitEmitStmt(e)}
+
+type ThrowStmt struct {
+	Keyword token.Token
+	Value Expr
+}
+
+func NewThrowStmt(Keyword token.Token, Value Expr) *ThrowStmt {
+	return &ThrowStmt{
+		Keyword: Keyword,
+		Value: Value,
+	}
+}
+
+func (t *ThrowStmt) Accept(v IASTVisitor) (any, error) { return v.VisitThrowStmt(t)}
+
+type TryStmt struct {
+	Keyword token.Token
+	Body []Stmt
+	Name token.Token
+	Catch []Stmt
+	Finally []Stmt
+}
+
+func NewTryStmt(Keyword token.Token, Body []Stmt, Name token.Token, Catch []Stmt, Finally []Stmt) *TryStmt {
+	return &TryStmt{
+		Keyword: Keyword,
+		Body: Body,
+		Name: Name,
+		Catch: Catch,
+		Finally: Finally,
+	}
+}
+
+func (t *TryStmt) Accept(v IASTVisitor) (any, error) { return v.VisitTryStmt(t)}
+
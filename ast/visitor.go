@@ -6,14 +6,27 @@ type IASTVisitor interface {
 }
 
 type IExprVisitor interface {
+	VisitLogicalExpr(expr *LogicalExpr) (any, error)
+	VisitCallExpr(expr *CallExpr) (any, error)
 	VisitBinaryExpr(expr *BinaryExpr) (any, error)
-	VisitGroupingExpr(expr *GroupingExpr) (any, error)
-	VisitLiteralExpr(expr *LiteralExpr) (any, error)
 	VisitUnaryExpr(expr *UnaryExpr) (any, error)
+	VisitLiteralExpr(expr *LiteralExpr) (any, error)
+	VisitGroupingExpr(expr *GroupingExpr) (any, error)
 	VisitVariableExpr(expr *VariableExpr) (any, error)
 	VisitAssignExpr(expr *AssignExpr) (any, error)
-	VisitLogicalExpr(expr *LogicalExpr) (any, error)
-	VisitCallExpr(expr *CallExpr) (any, error)
+	VisitFunctionExpr(expr *FunctionExpr) (any, error)
+	VisitListExpr(expr *ListExpr) (any, error)
+	VisitIndexExpr(expr *IndexExpr) (any, error)
+	VisitSliceExpr(expr *SliceExpr) (any, error)
+	VisitIndexSetExpr(expr *IndexSetExpr) (any, error)
+	VisitMapExpr(expr *MapExpr) (any, error)
+	VisitGetExpr(expr *GetExpr) (any, error)
+	VisitSetExpr(expr *SetExpr) (any, error)
+	VisitThisExpr(expr *ThisExpr) (any, error)
+	VisitSuperExpr(expr *SuperExpr) (any, error)
+	VisitWithExpr(expr *WithExpr) (any, error)
+	VisitInterpolationExpr(expr *InterpolationExpr) (any, error)
+	VisitCompoundAssignExpr(expr *CompoundAssignExpr) (any, error)
 }
 
 type IStmtVisitor interface {
@@ -24,4 +37,13 @@ type IStmtVisitor interface {
 	VisitIfStmt(stmt *IfStmt) (any, error)
 	VisitWhileStmt(stmt *WhileStmt) (any, error)
 	VisitFunctionStmt(stmt *FunctionStmt) (any, error)
+	VisitReturnStmt(stmt *ReturnStmt) (any, error)
+	VisitBreakStmt(stmt *BreakStmt) (any, error)
+	VisitContinueStmt(stmt *ContinueStmt) (any, error)
+	VisitClassStmt(stmt *ClassStmt) (any, error)
+	VisitRecordStmt(stmt *RecordStmt) (any, error)
+	VisitImportStmt(stmt *ImportStmt) (any, error)
+	VisitEmitStmt(stmt *EmitStmt) (any, error)
+	VisitThrowStmt(stmt *ThrowStmt) (any, error)
+	VisitTryStmt(stmt *TryStmt) (any, error)
 }
@@ -0,0 +1,177 @@
+// Package closure runs Sludge programs by compiling every node of the
+// syntax tree once into a Go closure, which then runs as often as the
+// program needs it. Unlike the interpreter, running a program dispatches
+// on no node or operator types: that work is done while compiling.
+//
+// Programs give the same output and errors as in the interpreter, whose
+// operators and built-in values this package shares. Variables live in
+// frames that mirror the scopes of the resolver, except that scopes which
+// declare nothing get no frame.
+package closure
+
+import (
+	"io"
+	"os"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/environment"
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/resolver"
+)
+
+// Value is a runtime value of a program.
+type Value = any
+
+// Frame holds the variables of a running scope.
+type Frame struct {
+	slots   []Value
+	parent  *Frame                   // Frame of the enclosing scope
+	globals *environment.Environment // Outermost scope of the module
+}
+
+// ancestor returns the frame hops levels out from this one.
+func (f *Frame) ancestor(hops int) *Frame {
+	for ; hops > 0; hops-- {
+		f = f.parent
+	}
+	return f
+}
+
+// undefined fills the slots of variables whose declaration hasn't run yet.
+type undefined struct{}
+
+// eval computes the value of a compiled expression.
+type eval func(*Frame) (Value, error)
+
+// exec runs a compiled statement and reports how control leaves it, with
+// the value of a return statement.
+type exec func(*Frame) (Value, flow, error)
+
+type flow int
+
+const (
+	flowNext flow = iota
+	flowBreak
+	flowContinue
+	flowReturn
+)
+
+// escape carries a return, break or continue out of a statement used as
+// an expression, up to the function or loop it leaves.
+type escape struct {
+	flow  flow
+	value Value
+}
+
+func (e *escape) Error() string {
+	return "can't leave an expression with return, break or continue"
+}
+
+// Program is a compiled program or module.
+type Program struct {
+	body exec
+}
+
+// run runs the program in globals, its outermost scope.
+func (p *Program) run(globals *environment.Environment) error {
+	_, _, err := p.body(&Frame{globals: globals})
+	return err
+}
+
+type Interpreter struct {
+	builtins *environment.Environment // Natives, which programs may shadow
+	globals  *environment.Environment
+	out      io.Writer
+	loader   interpreter.Loader             // Reads the source of imported modules
+	modules  map[string]*interpreter.Module // Modules that have already run, by path
+	loading  []string                       // Paths of the modules currently running
+
+	calls        []interpreter.CallFrame // Calls of functions written in Sludge that are running
+	maxCallDepth int                     // How many of them may run at once
+	tailCalls    bool                    // Whether calls in tail position replace the calling function
+}
+
+// Option configures an Interpreter created by New.
+type Option func(*Interpreter)
+
+// WithLoader sets the loader used to read imported modules. By default
+// modules are read from disk relative to the working directory.
+func WithLoader(loader interpreter.Loader) Option {
+	return func(i *Interpreter) {
+		i.loader = loader
+	}
+}
+
+// WithOutput sets the writer that print statements and template text are
+// written to. By default it is os.Stdout.
+func WithOutput(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.out = w
+	}
+}
+
+// WithMaxCallDepth sets how many calls of functions written in Sludge can
+// run at once. A call beyond that fails with a stack overflow instead of
+// exhausting the Go stack. By default it is
+// interpreter.DefaultMaxCallDepth, and it is at most
+// interpreter.MaxRecursiveCallDepth.
+func WithMaxCallDepth(depth int) Option {
+	return func(i *Interpreter) {
+		i.maxCallDepth = min(depth, interpreter.MaxRecursiveCallDepth)
+	}
+}
+
+// WithTailCalls sets whether a function that returns the result of
+// calling a function written in Sludge makes that call in its own place,
+// so that it runs in constant space. Turning it off keeps every call on
+// the call stack of errors. By default it is on.
+func WithTailCalls(enabled bool) Option {
+	return func(i *Interpreter) {
+		i.tailCalls = enabled
+	}
+}
+
+func New(options ...Option) *Interpreter {
+	builtins := interpreter.Builtins()
+	i := &Interpreter{
+		builtins: builtins,
+		globals:  environment.NewGlobal(builtins),
+		out:      os.Stdout,
+		loader:   interpreter.NewFileLoader("."),
+		modules:  make(map[string]*interpreter.Module),
+
+		maxCallDepth: interpreter.DefaultMaxCallDepth,
+		tailCalls:    true,
+	}
+	for _, option := range options {
+		option(i)
+	}
+	return i
+}
+
+// Define binds name to value in the global environment, so that the
+// programs run afterwards can refer to it.
+func (i *Interpreter) Define(name string, value any) {
+	i.globals.Define(name, value)
+}
+
+// Compile resolves a program and compiles it for Run. Names already
+// defined in the global environment are known to the resolver.
+func (i *Interpreter) Compile(stmts []ast.Stmt) (*Program, error) {
+	return i.compile(stmts, append(i.builtins.Names(), i.globals.Names()...))
+}
+
+// compile compiles stmts like Compile, knowing the predefined names only.
+func (i *Interpreter) compile(stmts []ast.Stmt, predefined []string) (*Program, error) {
+	r := resolver.New(predefined...)
+	if err := r.Resolve(stmts); err != nil {
+		return nil, err
+	}
+	c := &compiler{interpreter: i, slots: r.Slots()}
+	return c.program(stmts), nil
+}
+
+// Run runs a program compiled by Compile in the global environment.
+func (i *Interpreter) Run(p *Program) error {
+	return p.run(i.globals)
+}
@@ -0,0 +1,62 @@
+package closure
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+)
+
+const benchmarkInput = `
+function sum(n) {
+    let total = 0;
+    for (let i = 0; i < n; i += 1) {
+        let square = i * i;
+        total += square % 7;
+    }
+    return total;
+}
+
+function fib(n) {
+    if (n < 2) {
+        return n;
+    }
+    return fib(n - 1) + fib(n - 2);
+}
+
+print sum(100000) + fib(20);`
+
+func BenchmarkCompile(b *testing.B) {
+	stmts, err := parser.New(lexer.New(strings.NewReader(benchmarkInput)).ScanTokens()).Parse()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := New().Compile(stmts); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkRun(b *testing.B) {
+	stmts, err := parser.New(lexer.New(strings.NewReader(benchmarkInput)).ScanTokens()).Parse()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		interpreter := New(WithOutput(io.Discard))
+		p, err := interpreter.Compile(stmts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := interpreter.Run(p); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
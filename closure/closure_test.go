@@ -0,0 +1,155 @@
+package closure
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+)
+
+// run compiles and runs each input in turn on interpreter, returning
+// everything written by print statements. The output and errors of
+// programs in general are tested against the tree-walking interpreter's in
+// the interpreter package.
+func run(interpreter *Interpreter, inputs ...string) (string, error) {
+	out := &bytes.Buffer{}
+	interpreter.out = out
+	for _, input := range inputs {
+		l := lexer.New(strings.NewReader(input))
+		stmts, err := parser.New(l.ScanTokens()).Parse()
+		if err != nil {
+			return "", err
+		}
+		p, err := interpreter.Compile(stmts)
+		if err != nil {
+			return out.String(), err
+		}
+		if err := interpreter.Run(p); err != nil {
+			return out.String(), err
+		}
+	}
+	return out.String(), nil
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   []string
+		expected string
+	}{
+		{
+			name: "closures share captured variables",
+			inputs: []string{`
+				function pair() {
+					let n = 0;
+					let inc = function() { n += 1; };
+					let get = function() { return n; };
+					return [inc, get];
+				}
+				let p = pair();
+				p[0]();
+				p[0]();
+				print p[1]();
+			`},
+			expected: "2\n",
+		},
+		{
+			name: "loop bodies capture a fresh variable per iteration",
+			inputs: []string{`
+				let fns = [null, null, null];
+				for (let i = 0; i < 3; i += 1) {
+					let j = i;
+					fns[i] = function() { return j; };
+				}
+				print fns[0]() + fns[1]() + fns[2]();
+			`},
+			expected: "3\n",
+		},
+		{
+			name: "blocks without declarations share the enclosing frame",
+			inputs: []string{`
+				function f(a) {
+					{
+						{
+							let b = a + 1;
+							{ if (true) { return a + b; } }
+						}
+					}
+				}
+				print f(1);
+			`},
+			expected: "3\n",
+		},
+		{
+			name:     "globals persist between programs",
+			inputs:   []string{"let a = 1;", "function f() { return a + 1; }", "print f();"},
+			expected: "2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(New(), tt.inputs...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got output %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+// TestUndeclaredLocal checks that a local read before its declaration runs
+// is an error rather than the value of an empty slot.
+func TestUndeclaredLocal(t *testing.T) {
+	_, err := run(New(), "{\n  print z;\n  let z = 1;\n}")
+	if err == nil || !strings.Contains(err.Error(), "undefined variable 'z'\n<input>:2:9") {
+		t.Fatalf("got error %v, expected undefined variable 'z'", err)
+	}
+}
+
+func TestDefine(t *testing.T) {
+	interpreter := New()
+	interpreter.Define("answer", int64(42))
+	got, err := run(interpreter, "print answer;")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "42\n" {
+		t.Errorf("got output %q, expected %q", got, "42\n")
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	interpreter := New(WithMaxCallDepth(3))
+	_, err := run(interpreter, "function f(n) {\n  if (n > 0) f(n - 1);\n}\nf(2);", "f(3);")
+	if err == nil || !strings.HasPrefix(err.Error(), "stack overflow: more than 3 nested calls\n<input>:2:21\n  f called at <input>:2:21 (2 times)\n  f called at <input>:1:4") {
+		t.Fatalf("got error %v, expected stack overflow", err)
+	}
+	if len(interpreter.calls) != 0 {
+		t.Errorf("got %d calls running after the error, expected none", len(interpreter.calls))
+	}
+}
+
+// TestMaxCallDepthLimit checks that a depth too large for the Go stack is
+// lowered to MaxRecursiveCallDepth, which still fails with a stack overflow.
+func TestMaxCallDepthLimit(t *testing.T) {
+	_, err := run(New(WithMaxCallDepth(1<<30)), "function f(n) {\n  try {\n    while (true) {\n      return 1 + [f(n + 1)][0];\n    }\n  } finally {}\n}\nf(0);")
+	want := fmt.Sprintf("stack overflow: more than %d nested calls", interpreter.MaxRecursiveCallDepth)
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got error %v, expected stack overflow", err)
+	}
+}
+
+func TestTailCallsOff(t *testing.T) {
+	interpreter := New(WithMaxCallDepth(3), WithTailCalls(false))
+	_, err := run(interpreter, "function f(n) {\n  if (n > 0) return f(n - 1);\n}\nf(2);", "f(3);")
+	if err == nil || !strings.HasPrefix(err.Error(), "stack overflow: more than 3 nested calls\n<input>:2:28\n  f called at <input>:2:28 (2 times)\n  f called at <input>:1:4") {
+		t.Fatalf("got error %v, expected stack overflow", err)
+	}
+}
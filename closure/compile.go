@@ -0,0 +1,1158 @@
+package closure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/resolver"
+	"github.com/Toolnado/sludge/token"
+)
+
+// compiler turns the nodes of a resolved program into closures. Statements
+// become an exec and expressions an eval.
+type compiler struct {
+	interpreter *Interpreter
+	slots       map[ast.Expr]resolver.Slot
+	scopes      []*scope
+	tries       int // Try statements of the current function that a return can't leave early
+}
+
+// scope mirrors a scope of the resolver.
+type scope struct {
+	size     int  // Slots of the scope's frame, or 0 if it runs in the frame of its parent
+	declared int  // Variables declared so far
+	global   bool // Whether the scope is the program, whose variables are globals
+}
+
+// program compiles a program or module. Its var declarations are defined
+// before it runs, unless they exist already.
+func (c *compiler) program(stmts []ast.Stmt) *Program {
+	c.scopes = []*scope{{global: true}}
+	var names []string
+	for _, v := range ast.HoistedVars(stmts) {
+		names = append(names, v.Name.Lexeme)
+	}
+	body := c.sequence(stmts)
+	return &Program{body: func(f *Frame) (Value, flow, error) {
+		for _, name := range names {
+			if _, ok := f.globals.Lookup(name); !ok {
+				f.globals.Define(name, nil)
+			}
+		}
+		return body(f)
+	}}
+}
+
+func (c *compiler) statement(stmt ast.Stmt) exec {
+	run, _ := stmt.Accept(c)
+	return run.(exec)
+}
+
+// sequence compiles statements that run one after the other until one of
+// them leaves the sequence.
+func (c *compiler) sequence(stmts []ast.Stmt) exec {
+	runs := make([]exec, len(stmts))
+	for indx, stmt := range stmts {
+		runs[indx] = c.statement(stmt)
+	}
+	if len(runs) == 1 {
+		return runs[0]
+	}
+	return func(f *Frame) (Value, flow, error) {
+		for _, run := range runs {
+			if value, flow, err := run(f); err != nil || flow != flowNext {
+				return value, flow, err
+			}
+		}
+		return nil, flowNext, nil
+	}
+}
+
+// expression compiles an expression. Blocks, conditionals and loops can be
+// used as expressions, and their value is nil as in the interpreter.
+func (c *compiler) expression(expr ast.Expr) eval {
+	if isStatement(expr) {
+		run := c.statement(expr)
+		return func(f *Frame) (Value, error) {
+			value, flow, err := run(f)
+			if err != nil {
+				return nil, err
+			}
+			if flow != flowNext {
+				return nil, &escape{flow: flow, value: value}
+			}
+			return nil, nil
+		}
+	}
+	value, _ := expr.Accept(c)
+	return value.(eval)
+}
+
+func (c *compiler) expressions(exprs []ast.Expr) []eval {
+	evals := make([]eval, len(exprs))
+	for indx, expr := range exprs {
+		evals[indx] = c.expression(expr)
+	}
+	return evals
+}
+
+// isStatement reports whether expr is one of the statements the parser
+// accepts where an expression is expected.
+func isStatement(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.BlockStmt, *ast.IfStmt, *ast.WhileStmt:
+		return true
+	default:
+		return false
+	}
+}
+
+// declarations counts the variables that stmts declare in their own scope.
+// Var declarations belong to the enclosing function and aren't counted.
+func declarations(stmts []ast.Stmt) int {
+	count := 0
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.VarStmt:
+			if s.Keyword.Type != token.VAR {
+				count++
+			}
+		case *ast.FunctionStmt, *ast.ClassStmt, *ast.RecordStmt:
+			count++
+		case *ast.ImportStmt:
+			if s.Alias.Type == token.IDENTIFIER {
+				count++
+			}
+			count += len(s.Names)
+		}
+	}
+	return count
+}
+
+// frame returns the frame of a scope with size slots, none of whose
+// variables is declared yet.
+func frame(parent *Frame, size int) *Frame {
+	slots := make([]Value, size)
+	for indx := range slots {
+		slots[indx] = undefined{}
+	}
+	return &Frame{slots: slots, parent: parent, globals: parent.globals}
+}
+
+// locate returns how many frames out from the current one the variable at
+// slot lives, and its index in that frame.
+func (c *compiler) locate(slot resolver.Slot) (hops, index int) {
+	for _, s := range c.scopes[len(c.scopes)-slot.Depth:] {
+		if s.size > 0 {
+			hops++
+		}
+	}
+	return hops, slot.Index
+}
+
+// variable returns closures that read and assign the variable name used by
+// expr. Variables the resolver located are found by their slot, and the
+// others by name, searching the enclosing scopes.
+func (c *compiler) variable(expr ast.Expr, name token.Token) (eval, func(*Frame, Value) error) {
+	slot, ok := c.slots[expr]
+	if !ok {
+		return func(f *Frame) (Value, error) {
+				value, err := f.globals.Get(name)
+				if err != nil {
+					return nil, interpreter.Wrap(err, name.Position)
+				}
+				return value, nil
+			}, func(f *Frame, value Value) error {
+				if _, err := f.globals.Assign(name, value); err != nil {
+					return interpreter.Wrap(err, name.Position)
+				}
+				return nil
+			}
+	}
+	if slot.Index < 0 {
+		return func(f *Frame) (Value, error) {
+				value, err := f.globals.GetAt(0, -1, name)
+				if err != nil {
+					return nil, interpreter.Wrap(err, name.Position)
+				}
+				return value, nil
+			}, func(f *Frame, value Value) error {
+				if _, err := f.globals.AssignAt(0, -1, name, value); err != nil {
+					return interpreter.Wrap(err, name.Position)
+				}
+				return nil
+			}
+	}
+
+	hops, index := c.locate(slot)
+	get := func(f *Frame) (Value, error) {
+		value := f.ancestor(hops).slots[index]
+		if _, ok := value.(undefined); ok {
+			return nil, undefinedVariable(name)
+		}
+		return value, nil
+	}
+	if hops == 0 {
+		get = func(f *Frame) (Value, error) {
+			value := f.slots[index]
+			if _, ok := value.(undefined); ok {
+				return nil, undefinedVariable(name)
+			}
+			return value, nil
+		}
+	}
+	return get, func(f *Frame, value Value) error {
+		frame := f.ancestor(hops)
+		if _, ok := frame.slots[index].(undefined); ok {
+			return undefinedVariable(name)
+		}
+		frame.slots[index] = value
+		return nil
+	}
+}
+
+func undefinedVariable(name token.Token) error {
+	return interpreter.Wrap(diagnostic.Errorf(diagnostic.ErrUndefinedVariable, "undefined variable '%s'", name.Lexeme), name.Position)
+}
+
+// declare returns a closure declaring name as the next variable of the
+// innermost scope. Variables of the program are globals, declared as
+// constants if constant is set. The others go to their slot.
+func (c *compiler) declare(name token.Token, constant bool) func(*Frame, Value) error {
+	s := c.scopes[len(c.scopes)-1]
+	if !s.global {
+		index := s.declared
+		s.declared++
+		return func(f *Frame, value Value) error {
+			f.slots[index] = value
+			return nil
+		}
+	}
+	return func(f *Frame, value Value) error {
+		declare := f.globals.Declare
+		if constant {
+			declare = f.globals.DeclareConst
+		}
+		if err := declare(name, value); err != nil {
+			return interpreter.Wrap(err, name.Position)
+		}
+		return nil
+	}
+}
+
+// function compiles the body of a function. The body sees its parameters
+// and hoisted variables in a scope of its own.
+func (c *compiler) function(name string, params []token.Token, body []ast.Stmt, initializer bool) *declaration {
+	locals := len(params) + len(ast.HoistedVars(body))
+	s := &scope{size: locals + declarations(body), declared: locals}
+	c.scopes = append(c.scopes, s)
+	// The try statements being compiled belong to the enclosing function.
+	tries := c.tries
+	c.tries = 0
+	run := c.sequence(body)
+	c.tries = tries
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	return &declaration{
+		name:        name,
+		arity:       len(params),
+		locals:      locals,
+		size:        s.size,
+		body:        run,
+		initializer: initializer,
+	}
+}
+
+func (c *compiler) VisitPrintStmt(stmt *ast.PrintStmt) (any, error) {
+	value := c.expression(stmt.Expession)
+	out := &c.interpreter.out
+	return exec(func(f *Frame) (Value, flow, error) {
+		v, err := value(f)
+		if err != nil {
+			return nil, flowNext, err
+		}
+		fmt.Fprintln(*out, interpreter.Stringify(v))
+		return nil, flowNext, nil
+	}), nil
+}
+
+func (c *compiler) VisitEmitStmt(stmt *ast.EmitStmt) (any, error) {
+	value := c.expression(stmt.Value)
+	out := &c.interpreter.out
+	return exec(func(f *Frame) (Value, flow, error) {
+		v, err := value(f)
+		if err != nil {
+			return nil, flowNext, err
+		}
+		_, err = fmt.Fprint(*out, interpreter.Stringify(v))
+		return nil, flowNext, err
+	}), nil
+}
+
+func (c *compiler) VisitExprStmt(stmt *ast.ExprStmt) (any, error) {
+	if isStatement(stmt.Expession) {
+		return c.statement(stmt.Expession), nil
+	}
+	value := c.expression(stmt.Expession)
+	return exec(func(f *Frame) (Value, flow, error) {
+		_, err := value(f)
+		return nil, flowNext, err
+	}), nil
+}
+
+func (c *compiler) VisitVarStmt(stmt *ast.VarStmt) (any, error) {
+	value := func(*Frame) (Value, error) { return nil, nil }
+	if stmt.Initializer != nil {
+		value = c.expression(stmt.Initializer)
+	}
+
+	var store func(*Frame, Value) error
+	switch {
+	case stmt.Keyword.Type != token.VAR:
+		store = c.declare(stmt.Name, stmt.Keyword.Type == token.CONST)
+	case stmt.Initializer != nil:
+		// The variable was hoisted to the top of its function, so only the
+		// initializer is left to assign.
+		_, store = c.variable(stmt, stmt.Name)
+	default:
+		return exec(func(*Frame) (Value, flow, error) { return nil, flowNext, nil }), nil
+	}
+
+	return exec(func(f *Frame) (Value, flow, error) {
+		v, err := value(f)
+		if err != nil {
+			return nil, flowNext, err
+		}
+		return nil, flowNext, store(f, v)
+	}), nil
+}
+
+func (c *compiler) VisitBlockStmt(stmt *ast.BlockStmt) (any, error) {
+	return c.block(stmt.Statements), nil
+}
+
+// block compiles statements that run in a scope of their own.
+func (c *compiler) block(stmts []ast.Stmt) exec {
+	size := declarations(stmts)
+	c.scopes = append(c.scopes, &scope{size: size})
+	body := c.sequence(stmts)
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	if size == 0 {
+		return body
+	}
+	return func(f *Frame) (Value, flow, error) {
+		return body(frame(f, size))
+	}
+}
+
+func (c *compiler) VisitIfStmt(stmt *ast.IfStmt) (any, error) {
+	condition := c.expression(stmt.Condition)
+	then := c.statement(stmt.ThenBranch)
+	otherwise := exec(func(*Frame) (Value, flow, error) { return nil, flowNext, nil })
+	if stmt.ElseBranch != nil {
+		otherwise = c.statement(stmt.ElseBranch)
+	}
+	return exec(func(f *Frame) (Value, flow, error) {
+		value, err := condition(f)
+		if err != nil {
+			return nil, flowNext, err
+		}
+		if interpreter.IsTruthy(value) {
+			return then(f)
+		}
+		return otherwise(f)
+	}), nil
+}
+
+func (c *compiler) VisitWhileStmt(stmt *ast.WhileStmt) (any, error) {
+	condition := c.expression(stmt.Condition)
+	body := c.statement(stmt.Body)
+	increment := func(*Frame) (Value, error) { return nil, nil }
+	if stmt.Increment != nil {
+		increment = c.expression(stmt.Increment)
+	}
+	return exec(func(f *Frame) (Value, flow, error) {
+		for {
+			value, err := condition(f)
+			if err != nil {
+				return nil, flowNext, err
+			}
+			if !interpreter.IsTruthy(value) {
+				return nil, flowNext, nil
+			}
+			value, flow, err := body(f)
+			if err != nil {
+				e, ok := err.(*escape)
+				if !ok || e.flow == flowReturn {
+					return nil, flowNext, err
+				}
+				flow = e.flow
+			}
+			switch flow {
+			case flowBreak:
+				return nil, flowNext, nil
+			case flowReturn:
+				return value, flowReturn, nil
+			}
+			if _, err := increment(f); err != nil {
+				return nil, flowNext, err
+			}
+		}
+	}), nil
+}
+
+func (c *compiler) VisitThrowStmt(stmt *ast.ThrowStmt) (any, error) {
+	value := c.expression(stmt.Value)
+	keyword := stmt.Keyword
+	return exec(func(f *Frame) (Value, flow, error) {
+		v, err := value(f)
+		if err != nil {
+			return nil, flowNext, err
+		}
+		return nil, flowNext, interpreter.Throw(v, keyword.Position)
+	}), nil
+}
+
+// VisitTryStmt compiles a try statement. The catch clause runs in a scope
+// whose first variable is the error, and the finally block runs however
+// the others end. An error or a return, break or continue of the finally
+// block replaces how the others ended.
+func (c *compiler) VisitTryStmt(stmt *ast.TryStmt) (any, error) {
+	// A call in tail position would only run once the try statement is
+	// left, so the returns of the parts the statement still has to finish
+	// call as usual.
+	c.tries++
+	body := c.block(stmt.Body)
+	c.tries--
+
+	var catch func(*Frame, Value) (Value, flow, error)
+	if stmt.Name.Type == token.IDENTIFIER {
+		size := 1 + declarations(stmt.Catch)
+		c.scopes = append(c.scopes, &scope{size: size})
+		declare := c.declare(stmt.Name, false)
+		if stmt.Finally != nil {
+			c.tries++
+		}
+		run := c.sequence(stmt.Catch)
+		if stmt.Finally != nil {
+			c.tries--
+		}
+		c.scopes = c.scopes[:len(c.scopes)-1]
+		catch = func(f *Frame, value Value) (Value, flow, error) {
+			inner := frame(f, size)
+			declare(inner, value)
+			return run(inner)
+		}
+	}
+
+	var finally exec
+	if stmt.Finally != nil {
+		finally = c.block(stmt.Finally)
+	}
+
+	i := c.interpreter
+	return exec(func(f *Frame) (Value, flow, error) {
+		value, flow, err := body(f)
+		if err != nil && catch != nil {
+			if caught, ok := interpreter.Caught(interpreter.Trace(err, i.calls)); ok {
+				value, flow, err = catch(f, caught)
+			}
+		}
+		if finally != nil {
+			if v, fl, ferr := finally(f); ferr != nil || fl != flowNext {
+				return v, fl, ferr
+			}
+		}
+		return value, flow, err
+	}), nil
+}
+
+func (c *compiler) VisitBreakStmt(stmt *ast.BreakStmt) (any, error) {
+	return exec(func(*Frame) (Value, flow, error) { return nil, flowBreak, nil }), nil
+}
+
+func (c *compiler) VisitContinueStmt(stmt *ast.ContinueStmt) (any, error) {
+	return exec(func(*Frame) (Value, flow, error) { return nil, flowContinue, nil }), nil
+}
+
+func (c *compiler) VisitFunctionStmt(stmt *ast.FunctionStmt) (any, error) {
+	d := c.function(stmt.Name.Lexeme, stmt.Params, stmt.Body, false)
+	declare := c.declare(stmt.Name, false)
+	return exec(func(f *Frame) (Value, flow, error) {
+		return nil, flowNext, declare(f, &Function{declaration: d, closure: f})
+	}), nil
+}
+
+func (c *compiler) VisitFunctionExpr(expr *ast.FunctionExpr) (any, error) {
+	d := c.function("", expr.Params, expr.Body, false)
+	return eval(func(f *Frame) (Value, error) {
+		return &Function{declaration: d, closure: f}, nil
+	}), nil
+}
+
+func (c *compiler) VisitReturnStmt(stmt *ast.ReturnStmt) (any, error) {
+	if stmt.Value == nil {
+		return exec(func(*Frame) (Value, flow, error) { return nil, flowReturn, nil }), nil
+	}
+	var value eval
+	if call, ok := stmt.Value.(*ast.CallExpr); ok && c.interpreter.tailCalls && c.tries == 0 {
+		value = c.call(call, true)
+	} else {
+		value = c.expression(stmt.Value)
+	}
+	return exec(func(f *Frame) (Value, flow, error) {
+		v, err := value(f)
+		if err != nil {
+			return nil, flowNext, err
+		}
+		return v, flowReturn, nil
+	}), nil
+}
+
+func (c *compiler) VisitClassStmt(stmt *ast.ClassStmt) (any, error) {
+	var super eval
+	if stmt.Superclass != nil {
+		super = c.expression(stmt.Superclass)
+	}
+	outer := c.scopes[len(c.scopes)-1]
+	declare := c.declare(stmt.Name, false)
+	assign := func(f *Frame, value Value) error {
+		_, err := f.globals.Assign(stmt.Name, value)
+		return err
+	}
+	if !outer.global {
+		index := outer.declared - 1
+		assign = func(f *Frame, value Value) error {
+			f.slots[index] = value
+			return nil
+		}
+	}
+
+	// Methods see "super" in a scope of its own, if there is a superclass,
+	// and "this" in the scope just inside it.
+	if super != nil {
+		c.scopes = append(c.scopes, &scope{size: 1, declared: 1})
+	}
+	c.scopes = append(c.scopes, &scope{size: 1, declared: 1})
+	methods := make(map[string]*declaration, len(stmt.Methods))
+	for _, method := range stmt.Methods {
+		initializer := method.Name.Lexeme == "init"
+		methods[method.Name.Lexeme] = c.function(method.Name.Lexeme, method.Params, method.Body, initializer)
+	}
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	if super != nil {
+		c.scopes = c.scopes[:len(c.scopes)-1]
+	}
+
+	return exec(func(f *Frame) (Value, flow, error) {
+		var superclass *Class
+		if super != nil {
+			value, err := super(f)
+			if err != nil {
+				return nil, flowNext, err
+			}
+			class, ok := value.(*Class)
+			if !ok {
+				return nil, flowNext, interpreter.Wrap(diagnostic.Errorf(diagnostic.ErrType, "superclass must be a class"), stmt.Superclass.Name.Position)
+			}
+			superclass = class
+		}
+
+		if err := declare(f, nil); err != nil {
+			return nil, flowNext, err
+		}
+
+		closure := f
+		if superclass != nil {
+			closure = &Frame{slots: []Value{superclass}, parent: f, globals: f.globals}
+		}
+		class := &Class{name: stmt.Name.Lexeme, superclass: superclass, methods: make(map[string]*Function, len(methods))}
+		for name, d := range methods {
+			class.methods[name] = &Function{declaration: d, closure: closure}
+		}
+		return nil, flowNext, assign(f, class)
+	}), nil
+}
+
+func (c *compiler) VisitRecordStmt(stmt *ast.RecordStmt) (any, error) {
+	fields := make([]string, len(stmt.Fields))
+	for indx, field := range stmt.Fields {
+		fields[indx] = field.Lexeme
+	}
+	declare := c.declare(stmt.Name, false)
+	return exec(func(f *Frame) (Value, flow, error) {
+		return nil, flowNext, declare(f, interpreter.NewRecord(stmt.Name.Lexeme, fields))
+	}), nil
+}
+
+func (c *compiler) VisitImportStmt(stmt *ast.ImportStmt) (any, error) {
+	var alias func(*Frame, Value) error
+	if stmt.Alias.Type == token.IDENTIFIER {
+		alias = c.declare(stmt.Alias, false)
+	}
+	names := make([]func(*Frame, Value) error, len(stmt.Names))
+	for indx, name := range stmt.Names {
+		names[indx] = c.declare(name, false)
+	}
+	i := c.interpreter
+	return exec(func(f *Frame) (Value, flow, error) {
+		module, err := i.importModule(stmt.Path.Literal.(string), stmt.Path.Position)
+		if err != nil {
+			return nil, flowNext, err
+		}
+		if alias != nil {
+			if err := alias(f, module); err != nil {
+				return nil, flowNext, err
+			}
+		}
+		for indx, name := range stmt.Names {
+			value, err := module.Get(name)
+			if err != nil {
+				return nil, flowNext, interpreter.Wrap(err, name.Position)
+			}
+			if err := names[indx](f, value); err != nil {
+				return nil, flowNext, err
+			}
+		}
+		return nil, flowNext, nil
+	}), nil
+}
+
+func (c *compiler) VisitLogicalExpr(expr *ast.LogicalExpr) (any, error) {
+	left, right := c.expression(expr.Left), c.expression(expr.Right)
+	or := expr.Operator.Type == token.OR
+	return eval(func(f *Frame) (Value, error) {
+		value, err := left(f)
+		if err != nil {
+			return nil, err
+		}
+		if interpreter.IsTruthy(value) == or {
+			return value, nil
+		}
+		return right(f)
+	}), nil
+}
+
+func (c *compiler) VisitCallExpr(expr *ast.CallExpr) (any, error) {
+	return c.call(expr, false), nil
+}
+
+// call compiles a call. A call in tail position of a function doesn't
+// call a function written in Sludge, but gives a tailCall for the caller
+// of the function it is in to make.
+func (c *compiler) call(expr *ast.CallExpr, tail bool) eval {
+	callee := c.expression(expr.Callee)
+	arguments := c.expressions(expr.Arguments)
+	paren := expr.Paren
+	i := c.interpreter
+	return eval(func(f *Frame) (Value, error) {
+		value, err := callee(f)
+		if err != nil {
+			return nil, interpreter.Wrap(err, paren.Position)
+		}
+
+		// The arguments of a function go straight into the frame of its
+		// body.
+		size := len(arguments)
+		fn, ok := value.(*Function)
+		if ok && fn.declaration.size > size {
+			size = fn.declaration.size
+		}
+		var slots []Value
+		if size > 0 {
+			slots = make([]Value, size)
+		}
+		for indx, argument := range arguments {
+			if slots[indx], err = argument(f); err != nil {
+				return nil, interpreter.Wrap(err, paren.Position)
+			}
+		}
+
+		if !ok {
+			return i.call(value, slots[:len(arguments)], paren)
+		}
+		if len(arguments) != fn.declaration.arity {
+			return nil, arityError(fn.declaration.arity, len(arguments), paren)
+		}
+		if tail {
+			return &tailCall{fn: fn, slots: slots, paren: paren}, nil
+		}
+		if err := i.enter(fn, paren); err != nil {
+			return nil, err
+		}
+		value, err = i.run(fn, slots)
+		if err != nil {
+			err = interpreter.Trace(err, i.calls)
+		}
+		i.leave()
+		return value, err
+	})
+}
+
+// run calls fn, and then each function it calls in tail position in its
+// place.
+func (i *Interpreter) run(fn *Function, slots []Value) (Value, error) {
+	for {
+		value, err := fn.call(slots)
+		tail, ok := value.(*tailCall)
+		if !ok {
+			return value, err
+		}
+		i.calls[len(i.calls)-1] = interpreter.CallFrame{Function: tail.fn.declaration.name, Position: tail.paren.Position}
+		fn, slots = tail.fn, tail.slots
+	}
+}
+
+// call calls a value other than a function.
+func (i *Interpreter) call(callee Value, arguments []Value, paren token.Token) (Value, error) {
+	switch c := callee.(type) {
+	case *Class:
+		if len(arguments) != c.arity() {
+			return nil, arityError(c.arity(), len(arguments), paren)
+		}
+		instance := &Instance{class: c, fields: make(map[string]any)}
+		if initializer, ok := c.findMethod("init"); ok {
+			slots := make([]Value, max(initializer.declaration.size, len(arguments)))
+			copy(slots, arguments)
+			if err := i.enter(initializer, paren); err != nil {
+				return nil, err
+			}
+			_, err := initializer.bind(instance).call(slots)
+			if err != nil {
+				err = interpreter.Trace(err, i.calls)
+			}
+			i.leave()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return instance, nil
+	case interpreter.Callable:
+		if len(arguments) != c.Arity() {
+			return nil, arityError(c.Arity(), len(arguments), paren)
+		}
+		value, err := c.Call(nil, arguments)
+		if _, ok := c.(interpreter.Native); ok && err != nil {
+			return nil, interpreter.Wrap(err, paren.Position)
+		}
+		return value, err
+	default:
+		return nil, interpreter.Wrap(diagnostic.Errorf(diagnostic.ErrNotCallable, "can only call functions and classes"), paren.Position)
+	}
+}
+
+// enter records the start of a call to fn at paren, failing if there are
+// too many calls running already.
+func (i *Interpreter) enter(fn *Function, paren token.Token) error {
+	if len(i.calls) >= i.maxCallDepth {
+		return interpreter.Wrap(interpreter.StackOverflow(i.maxCallDepth), paren.Position)
+	}
+	i.calls = append(i.calls, interpreter.CallFrame{Function: fn.declaration.name, Position: paren.Position})
+	return nil
+}
+
+// leave records the end of the innermost call.
+func (i *Interpreter) leave() {
+	i.calls = i.calls[:len(i.calls)-1]
+}
+
+func arityError(arity, got int, paren token.Token) error {
+	return interpreter.Wrap(diagnostic.Errorf(diagnostic.ErrArity, "expected %d arguments, but got %d", arity, got), paren.Position)
+}
+
+func (c *compiler) VisitBinaryExpr(expr *ast.BinaryExpr) (any, error) {
+	left, right := c.expression(expr.Left), c.expression(expr.Right)
+	apply := binaryOperators[expr.Operator.Type]
+	pos := expr.Operator.Position
+	if apply == nil {
+		return eval(func(*Frame) (Value, error) {
+			return nil, interpreter.NewError("unsupported binary operator", pos)
+		}), nil
+	}
+	return eval(func(f *Frame) (Value, error) {
+		l, err := left(f)
+		if err != nil {
+			return nil, interpreter.Wrap(err, pos)
+		}
+		r, err := right(f)
+		if err != nil {
+			return nil, interpreter.Wrap(err, pos)
+		}
+		value, err := apply(l, r)
+		if err != nil {
+			return nil, interpreter.Wrap(err, pos)
+		}
+		return value, nil
+	}), nil
+}
+
+func (c *compiler) VisitUnaryExpr(expr *ast.UnaryExpr) (any, error) {
+	right := c.expression(expr.Right)
+	pos := expr.Operator.Position
+	switch expr.Operator.Type {
+	case token.MINUS:
+		return eval(func(f *Frame) (Value, error) {
+			value, err := right(f)
+			if err != nil {
+				return nil, interpreter.Wrap(err, pos)
+			}
+			if n, ok := value.(int64); ok {
+				return -n, nil
+			}
+			if value, err = interpreter.Negate(value); err != nil {
+				return nil, interpreter.Wrap(err, pos)
+			}
+			return value, nil
+		}), nil
+	case token.BANG:
+		return eval(func(f *Frame) (Value, error) {
+			value, err := right(f)
+			if err != nil {
+				return nil, interpreter.Wrap(err, pos)
+			}
+			return !interpreter.IsTruthy(value), nil
+		}), nil
+	default:
+		return eval(func(*Frame) (Value, error) {
+			return nil, interpreter.NewError("unsupported unary operator", pos)
+		}), nil
+	}
+}
+
+func (c *compiler) VisitLiteralExpr(expr *ast.LiteralExpr) (any, error) {
+	value := expr.Value
+	return eval(func(*Frame) (Value, error) {
+		return value, nil
+	}), nil
+}
+
+func (c *compiler) VisitGroupingExpr(expr *ast.GroupingExpr) (any, error) {
+	return c.expression(expr.Expession), nil
+}
+
+func (c *compiler) VisitVariableExpr(expr *ast.VariableExpr) (any, error) {
+	get, _ := c.variable(expr, expr.Name)
+	return get, nil
+}
+
+func (c *compiler) VisitAssignExpr(expr *ast.AssignExpr) (any, error) {
+	value := c.expression(expr.Value)
+	_, set := c.variable(expr, expr.Name)
+	pos := expr.Name.Position
+	return eval(func(f *Frame) (Value, error) {
+		v, err := value(f)
+		if err != nil {
+			return nil, interpreter.Wrap(err, pos)
+		}
+		return nil, set(f, v)
+	}), nil
+}
+
+// VisitCompoundAssignExpr applies an operator such as "+=" to a variable,
+// element or property. The object and index of the target are evaluated
+// once, before the value on the right.
+func (c *compiler) VisitCompoundAssignExpr(expr *ast.CompoundAssignExpr) (any, error) {
+	apply := binaryOperators[compoundOperators[expr.Operator.Type]]
+	value := c.expression(expr.Value)
+	pos := expr.Operator.Position
+	// operate computes the new value of the target from its current one.
+	operate := func(f *Frame, current Value) (Value, error) {
+		operand, err := value(f)
+		if err != nil {
+			return nil, err
+		}
+		result, err := apply(current, operand)
+		if err != nil {
+			return nil, interpreter.Wrap(err, pos)
+		}
+		return result, nil
+	}
+
+	switch target := expr.Target.(type) {
+	case *ast.VariableExpr:
+		get, set := c.variable(target, target.Name)
+		return eval(func(f *Frame) (Value, error) {
+			current, err := get(f)
+			if err != nil {
+				return nil, err
+			}
+			result, err := operate(f, current)
+			if err != nil {
+				return nil, err
+			}
+			return result, set(f, result)
+		}), nil
+	case *ast.IndexExpr:
+		object, index := c.expression(target.Object), c.expression(target.Index)
+		bracket := target.Bracket.Position
+		return eval(func(f *Frame) (Value, error) {
+			o, err := object(f)
+			if err != nil {
+				return nil, err
+			}
+			i, err := index(f)
+			if err != nil {
+				return nil, err
+			}
+			current, err := interpreter.GetIndex(o, i)
+			if err != nil {
+				return nil, interpreter.Wrap(err, bracket)
+			}
+			result, err := operate(f, current)
+			if err != nil {
+				return nil, err
+			}
+			if err := interpreter.SetIndex(o, i, result); err != nil {
+				return nil, interpreter.Wrap(err, bracket)
+			}
+			return result, nil
+		}), nil
+	case *ast.GetExpr:
+		object := c.expression(target.Object)
+		name := target.Name
+		return eval(func(f *Frame) (Value, error) {
+			o, err := object(f)
+			if err != nil {
+				return nil, err
+			}
+			current, err := getProperty(o, name)
+			if err == nil {
+				err = checkSetProperty(o, name)
+			}
+			if err != nil {
+				return nil, interpreter.Wrap(err, name.Position)
+			}
+			result, err := operate(f, current)
+			if err != nil {
+				return nil, err
+			}
+			setProperty(o, name, result)
+			return result, nil
+		}), nil
+	default:
+		return eval(func(*Frame) (Value, error) {
+			return nil, interpreter.NewError("invalid assignment target", pos)
+		}), nil
+	}
+}
+
+func (c *compiler) VisitListExpr(expr *ast.ListExpr) (any, error) {
+	elements := c.expressions(expr.Elements)
+	return eval(func(f *Frame) (Value, error) {
+		values := make([]any, len(elements))
+		for indx, element := range elements {
+			value, err := element(f)
+			if err != nil {
+				return nil, err
+			}
+			values[indx] = value
+		}
+		return interpreter.NewList(values), nil
+	}), nil
+}
+
+func (c *compiler) VisitIndexExpr(expr *ast.IndexExpr) (any, error) {
+	object, index := c.expression(expr.Object), c.expression(expr.Index)
+	bracket := expr.Bracket.Position
+	return eval(func(f *Frame) (Value, error) {
+		o, err := object(f)
+		if err != nil {
+			return nil, err
+		}
+		i, err := index(f)
+		if err != nil {
+			return nil, err
+		}
+		value, err := interpreter.GetIndex(o, i)
+		if err != nil {
+			return nil, interpreter.Wrap(err, bracket)
+		}
+		return value, nil
+	}), nil
+}
+
+func (c *compiler) VisitSliceExpr(expr *ast.SliceExpr) (any, error) {
+	object := c.expression(expr.Object)
+	bound := func(expr ast.Expr) eval {
+		if expr == nil {
+			return func(*Frame) (Value, error) { return nil, nil }
+		}
+		return c.expression(expr)
+	}
+	start, end := bound(expr.Start), bound(expr.End)
+	bracket := expr.Bracket.Position
+	return eval(func(f *Frame) (Value, error) {
+		o, err := object(f)
+		if err != nil {
+			return nil, err
+		}
+		low, err := start(f)
+		if err != nil {
+			return nil, err
+		}
+		high, err := end(f)
+		if err != nil {
+			return nil, err
+		}
+		value, err := interpreter.Slice(o, low, high)
+		if err != nil {
+			return nil, interpreter.Wrap(err, bracket)
+		}
+		return value, nil
+	}), nil
+}
+
+func (c *compiler) VisitIndexSetExpr(expr *ast.IndexSetExpr) (any, error) {
+	object, index, value := c.expression(expr.Object), c.expression(expr.Index), c.expression(expr.Value)
+	bracket := expr.Bracket.Position
+	return eval(func(f *Frame) (Value, error) {
+		o, err := object(f)
+		if err != nil {
+			return nil, err
+		}
+		i, err := index(f)
+		if err != nil {
+			return nil, err
+		}
+		v, err := value(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := interpreter.SetIndex(o, i, v); err != nil {
+			return nil, interpreter.Wrap(err, bracket)
+		}
+		return v, nil
+	}), nil
+}
+
+func (c *compiler) VisitMapExpr(expr *ast.MapExpr) (any, error) {
+	keys, values := c.expressions(expr.Keys), c.expressions(expr.Values)
+	bracket := expr.Bracket.Position
+	return eval(func(f *Frame) (Value, error) {
+		m := interpreter.NewMap()
+		for indx := range keys {
+			key, err := keys[indx](f)
+			if err != nil {
+				return nil, err
+			}
+			value, err := values[indx](f)
+			if err != nil {
+				return nil, err
+			}
+			if err := m.Set(key, value); err != nil {
+				return nil, interpreter.Wrap(err, bracket)
+			}
+		}
+		return m, nil
+	}), nil
+}
+
+func (c *compiler) VisitGetExpr(expr *ast.GetExpr) (any, error) {
+	object := c.expression(expr.Object)
+	name := expr.Name
+	return eval(func(f *Frame) (Value, error) {
+		o, err := object(f)
+		if err != nil {
+			return nil, err
+		}
+		value, err := getProperty(o, name)
+		if err != nil {
+			return nil, interpreter.Wrap(err, name.Position)
+		}
+		return value, nil
+	}), nil
+}
+
+func (c *compiler) VisitSetExpr(expr *ast.SetExpr) (any, error) {
+	object, value := c.expression(expr.Object), c.expression(expr.Value)
+	name := expr.Name
+	return eval(func(f *Frame) (Value, error) {
+		o, err := object(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkSetProperty(o, name); err != nil {
+			return nil, interpreter.Wrap(err, name.Position)
+		}
+		v, err := value(f)
+		if err != nil {
+			return nil, err
+		}
+		setProperty(o, name, v)
+		return v, nil
+	}), nil
+}
+
+func (c *compiler) VisitThisExpr(expr *ast.ThisExpr) (any, error) {
+	get, _ := c.variable(expr, expr.Keyword)
+	return get, nil
+}
+
+func (c *compiler) VisitSuperExpr(expr *ast.SuperExpr) (any, error) {
+	super, _ := c.variable(expr, expr.Keyword)
+	// "this" is the only variable of the scope just inside the one
+	// holding "super".
+	slot := c.slots[expr]
+	hops, _ := c.locate(resolver.Slot{Depth: slot.Depth - 1})
+	method := expr.Method
+	return eval(func(f *Frame) (Value, error) {
+		value, err := super(f)
+		if err != nil {
+			return nil, err
+		}
+		this := f.ancestor(hops).slots[0].(*Instance)
+		fn, ok := value.(*Class).findMethod(method.Lexeme)
+		if !ok {
+			return nil, interpreter.Wrap(diagnostic.Errorf(diagnostic.ErrUndefinedProperty, "undefined property '%s'", method.Lexeme), method.Position)
+		}
+		return fn.bind(this), nil
+	}), nil
+}
+
+func (c *compiler) VisitWithExpr(expr *ast.WithExpr) (any, error) {
+	object := c.expression(expr.Object)
+	values := c.expressions(expr.Values)
+	names := make([]string, len(expr.Names))
+	for indx, name := range expr.Names {
+		names[indx] = name.Lexeme
+	}
+	keyword := expr.Keyword.Position
+	return eval(func(f *Frame) (Value, error) {
+		o, err := object(f)
+		if err != nil {
+			return nil, err
+		}
+		record, ok := o.(*interpreter.RecordValue)
+		if !ok {
+			return nil, interpreter.Wrap(diagnostic.Errorf(diagnostic.ErrType, "can only use 'with' on records"), keyword)
+		}
+		fields := make([]any, len(values))
+		for indx, value := range values {
+			if fields[indx], err = value(f); err != nil {
+				return nil, err
+			}
+		}
+		updated, err := record.With(names, fields)
+		if err != nil {
+			return nil, interpreter.Wrap(err, keyword)
+		}
+		return updated, nil
+	}), nil
+}
+
+func (c *compiler) VisitInterpolationExpr(expr *ast.InterpolationExpr) (any, error) {
+	parts := c.expressions(expr.Parts)
+	return eval(func(f *Frame) (Value, error) {
+		b := &strings.Builder{}
+		for _, part := range parts {
+			value, err := part(f)
+			if err != nil {
+				return nil, err
+			}
+			b.WriteString(interpreter.Stringify(value))
+		}
+		return b.String(), nil
+	}), nil
+}
@@ -0,0 +1,37 @@
+package closure
+
+import (
+	"github.com/Toolnado/sludge/environment"
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/token"
+)
+
+// importModule returns the module at the given import path, running it on
+// first use. Pos is the position of the path in the import statement. A
+// module runs in an environment of its own, which sees the builtins but
+// not the globals of the program that imports it.
+func (i *Interpreter) importModule(path string, pos token.Position) (*interpreter.Module, error) {
+	name := interpreter.ResolveModule(i.loading, path)
+	if module, ok := i.modules[name]; ok {
+		return module, nil
+	}
+	stmts, err := interpreter.ParseModule(i.loader, i.loading, name, pos)
+	if err != nil {
+		return nil, err
+	}
+	p, err := i.compile(stmts, i.builtins.Names())
+	if err != nil {
+		return nil, err
+	}
+
+	env := environment.NewGlobal(i.builtins)
+	i.loading = append(i.loading, name)
+	err = p.run(env)
+	i.loading = i.loading[:len(i.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+	module := interpreter.NewModule(name, env)
+	i.modules[name] = module
+	return module, nil
+}
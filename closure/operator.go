@@ -0,0 +1,103 @@
+package closure
+
+import (
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/token"
+)
+
+// operator applies a binary operator to the values of its operands.
+type operator func(left, right Value) (Value, error)
+
+// binaryOperators are chosen by the compiler for each binary expression.
+// They take a shortcut for two integers and otherwise share the rules of
+// the interpreter.
+var binaryOperators = map[token.TokenType]operator{
+	token.PLUS: func(left, right Value) (Value, error) {
+		if a, ok := left.(int64); ok {
+			if b, ok := right.(int64); ok {
+				return a + b, nil
+			}
+		}
+		return interpreter.Add(left, right)
+	},
+	token.MINUS: arithmetic(token.MINUS, func(a, b int64) Value { return a - b }),
+	token.STAR:  arithmetic(token.STAR, func(a, b int64) Value { return a * b }),
+	// Division and modulo leave checking for zero to the interpreter.
+	token.SLASH:   arithmetic(token.SLASH, nil),
+	token.PERCENT: arithmetic(token.PERCENT, nil),
+
+	token.EQUAL_EQUAL: func(left, right Value) (Value, error) {
+		return isEqual(left, right), nil
+	},
+	token.BANG_EQUAL: func(left, right Value) (Value, error) {
+		return !isEqual(left, right), nil
+	},
+	// Numbers are compared as floats, as in the interpreter, even when both
+	// are integers.
+	token.LESS:          comparison(token.LESS, func(a, b float64) bool { return a < b }),
+	token.LESS_EQUAL:    comparison(token.LESS_EQUAL, func(a, b float64) bool { return a <= b }),
+	token.GREATER:       comparison(token.GREATER, func(a, b float64) bool { return a > b }),
+	token.GREATER_EQUAL: comparison(token.GREATER_EQUAL, func(a, b float64) bool { return a >= b }),
+}
+
+// compoundOperators maps the operator of a compound assignment, such as
+// "+=", to the binary operator it applies.
+var compoundOperators = map[token.TokenType]token.TokenType{
+	token.PLUS_EQUAL:    token.PLUS,
+	token.MINUS_EQUAL:   token.MINUS,
+	token.STAR_EQUAL:    token.STAR,
+	token.SLASH_EQUAL:   token.SLASH,
+	token.PERCENT_EQUAL: token.PERCENT,
+}
+
+// arithmetic returns the operator op, applying ints to two integers if it
+// isn't nil.
+func arithmetic(op token.TokenType, ints func(a, b int64) Value) operator {
+	if ints == nil {
+		return func(left, right Value) (Value, error) {
+			return interpreter.Arithmetic(op, left, right)
+		}
+	}
+	return func(left, right Value) (Value, error) {
+		if a, ok := left.(int64); ok {
+			if b, ok := right.(int64); ok {
+				return ints(a, b), nil
+			}
+		}
+		return interpreter.Arithmetic(op, left, right)
+	}
+}
+
+// comparison returns the operator op, applying floats to two integers.
+func comparison(op token.TokenType, floats func(a, b float64) bool) operator {
+	return func(left, right Value) (Value, error) {
+		if a, ok := left.(int64); ok {
+			if b, ok := right.(int64); ok {
+				return floats(float64(a), float64(b)), nil
+			}
+		}
+		return interpreter.Compare(op, left, right)
+	}
+}
+
+func getProperty(object Value, name token.Token) (Value, error) {
+	if instance, ok := object.(*Instance); ok {
+		return instance.get(name.Lexeme)
+	}
+	return interpreter.GetProperty(object, name)
+}
+
+func checkSetProperty(object Value, name token.Token) error {
+	if _, ok := object.(*Instance); ok {
+		return nil
+	}
+	return interpreter.CheckSetProperty(object, name)
+}
+
+func setProperty(object Value, name token.Token, value Value) {
+	if instance, ok := object.(*Instance); ok {
+		instance.set(name.Lexeme, value)
+		return
+	}
+	interpreter.SetProperty(object, name, value)
+}
@@ -0,0 +1,166 @@
+package closure
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/token"
+)
+
+// declaration is a compiled function body.
+type declaration struct {
+	name        string // Empty for anonymous functions
+	arity       int
+	locals      int // Slots of the parameters and the hoisted variables
+	size        int // Slots of the frame of the body, or 0 if it needs none
+	body        exec
+	initializer bool // Whether the function is the "init" method of a class
+}
+
+// Function is the runtime value of a function: its compiled body and the
+// frame it was declared in.
+type Function struct {
+	declaration *declaration
+	closure     *Frame
+}
+
+// call runs the function. Slots hold the arguments, followed by room for
+// the other variables of the body's frame.
+func (fn *Function) call(slots []Value) (Value, error) {
+	d := fn.declaration
+	frame := fn.closure
+	if d.size > 0 {
+		for indx := d.locals; indx < d.size; indx++ {
+			slots[indx] = undefined{}
+		}
+		frame = &Frame{slots: slots, parent: fn.closure, globals: fn.closure.globals}
+	}
+	value, flow, err := d.body(frame)
+	if err != nil {
+		e, ok := err.(*escape)
+		if !ok || e.flow != flowReturn {
+			return nil, err
+		}
+		value, flow = e.value, flowReturn
+	}
+	if d.initializer {
+		return fn.closure.slots[0], nil
+	}
+	if flow != flowReturn {
+		return nil, nil
+	}
+	return value, nil
+}
+
+// tailCall is a call of a function in tail position, returned by the
+// function making it for its own caller to make in its place.
+type tailCall struct {
+	fn    *Function
+	slots []Value
+	paren token.Token
+}
+
+// bind returns a copy of the method whose enclosing frame holds "this" as
+// the given instance.
+func (fn *Function) bind(instance *Instance) *Function {
+	return &Function{
+		declaration: fn.declaration,
+		closure:     &Frame{slots: []Value{instance}, parent: fn.closure, globals: fn.closure.globals},
+	}
+}
+
+func (fn *Function) String() string {
+	if fn.declaration.name == "" {
+		return "<fn>"
+	}
+	return fmt.Sprintf("<fn %s>", fn.declaration.name)
+}
+
+// Class is the runtime value of a class declaration. Calling a class
+// creates a new instance and runs its "init" method, if any.
+type Class struct {
+	name       string
+	superclass *Class
+	methods    map[string]*Function
+}
+
+// findMethod looks up a method on the class and then on its superclasses.
+func (c *Class) findMethod(name string) (*Function, bool) {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.methods[name]; ok {
+			return method, true
+		}
+	}
+	return nil, false
+}
+
+func (c *Class) arity() int {
+	if initializer, ok := c.findMethod("init"); ok {
+		return initializer.declaration.arity
+	}
+	return 0
+}
+
+func (c *Class) String() string {
+	return fmt.Sprintf("<class %s>", c.name)
+}
+
+// Instance is an object created by calling a class. Fields are created on
+// first assignment and printed in that order.
+type Instance struct {
+	class  *Class
+	names  []string
+	fields map[string]any
+}
+
+// get returns the field with the given name or, failing that, the method
+// of the same name bound to the instance.
+func (i *Instance) get(name string) (any, error) {
+	if value, ok := i.fields[name]; ok {
+		return value, nil
+	}
+	if method, ok := i.class.findMethod(name); ok {
+		return method.bind(i), nil
+	}
+	return nil, diagnostic.Errorf(diagnostic.ErrUndefinedProperty, "undefined property '%s'", name)
+}
+
+func (i *Instance) set(name string, value any) {
+	if _, ok := i.fields[name]; !ok {
+		i.names = append(i.names, name)
+	}
+	i.fields[name] = value
+}
+
+func (i *Instance) String() string {
+	b := &strings.Builder{}
+	b.WriteString(i.class.name)
+	b.WriteString(" {")
+	for indx, name := range i.names {
+		if indx != 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(" ")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(interpreter.Repr(i.fields[name]))
+	}
+	if len(i.names) != 0 {
+		b.WriteString(" ")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// isEqual compares two values as the '==' operator does. Classes and
+// instances of this package are compared by identity, like those of the
+// interpreter.
+func isEqual(a, b any) bool {
+	switch a.(type) {
+	case *Class, *Instance:
+		return a == b
+	}
+	return interpreter.IsEqual(a, b)
+}
@@ -0,0 +1,120 @@
+package compiler
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Toolnado/sludge/token"
+)
+
+// Function is a compiled function, or the compiled top level of a program
+// or module, ready to be called by the vm.
+type Function struct {
+	Name        string // Empty for programs and anonymous functions
+	Arity       int
+	Upvalues    int  // Number of variables captured from enclosing functions
+	Locals      int  // Slots for the callee, the parameters and the local variables
+	Slots       int  // Slots for the locals and the operands of the longest expression
+	Initializer bool // Whether the function is the "init" method of a class
+	Chunk
+}
+
+func (f *Function) String() string {
+	if f.Name == "" {
+		return "<fn>"
+	}
+	return fmt.Sprintf("<fn %s>", f.Name)
+}
+
+// Chunk is a sequence of instructions with the constants they use.
+type Chunk struct {
+	Code      []byte
+	Constants []any
+	positions []position
+}
+
+// position gives the source position of the instructions from offset up
+// to the next entry.
+type position struct {
+	offset int
+	pos    token.Position
+}
+
+// Position returns the position an error raised by the instruction at
+// offset is reported at.
+func (c *Chunk) Position(offset int) token.Position {
+	lo, hi := 0, len(c.positions)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if c.positions[mid].offset <= offset {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == 0 {
+		return token.Position{}
+	}
+	return c.positions[lo-1].pos
+}
+
+// Disassemble writes the instructions of a function, followed by those of
+// the functions it declares, in a readable form.
+func Disassemble(w io.Writer, f *Function) {
+	name := f.Name
+	if name == "" {
+		name = "<fn>"
+	}
+	fmt.Fprintf(w, "== %s ==\n", name)
+	var functions []*Function
+	for offset := 0; offset < len(f.Code); {
+		op := Opcode(f.Code[offset])
+		pos := f.Position(offset)
+		b := &strings.Builder{}
+		fmt.Fprintf(b, "%04d %4d:%-3d %-20s", offset, pos.Line, pos.Column, op)
+		next := offset + 1
+		for _, width := range operands[op] {
+			fmt.Fprintf(b, " %d", read(f.Code, next, width))
+			next += width
+		}
+		switch op {
+		case OpConstant, OpGetGlobal, OpSetGlobal, OpGetName, OpSetName, OpDeclareGlobal,
+			OpDeclareConst, OpHoistGlobal, OpGetProperty, OpGetPropertyKeep, OpCheckProperty, OpSetProperty,
+			OpWith, OpClass, OpMethod, OpGetSuper, OpRecord, OpImport, OpImportName:
+			fmt.Fprintf(b, " %v", f.Constants[read(f.Code, offset+1, 2)])
+		case OpCheckLocal, OpCheckUpvalue:
+			fmt.Fprintf(b, " %v", f.Constants[read(f.Code, offset+2, 2)])
+		case OpJump, OpJumpIfFalse, OpJumpIfFalseOrPop, OpJumpIfTrueOrPop, OpTry:
+			fmt.Fprintf(b, " -> %04d", next+read(f.Code, offset+1, 2))
+		case OpLoop:
+			fmt.Fprintf(b, " -> %04d", next-read(f.Code, offset+1, 2))
+		case OpClosure:
+			function := f.Constants[read(f.Code, offset+1, 2)].(*Function)
+			functions = append(functions, function)
+			fmt.Fprintf(b, " %v", function)
+			for i := 0; i < function.Upvalues; i++ {
+				kind := "upvalue"
+				if f.Code[next] == 1 {
+					kind = "local"
+				}
+				fmt.Fprintf(b, " %s %d", kind, f.Code[next+1])
+				next += 2
+			}
+		}
+		fmt.Fprintln(w, strings.TrimRight(b.String(), " "))
+		offset = next
+	}
+	for _, function := range functions {
+		fmt.Fprintln(w)
+		Disassemble(w, function)
+	}
+}
+
+// read decodes the operand of the given width at offset.
+func read(code []byte, offset, width int) int {
+	if width == 1 {
+		return int(code[offset])
+	}
+	return int(code[offset])<<8 | int(code[offset+1])
+}
@@ -0,0 +1,737 @@
+// Package compiler lowers the syntax tree of a resolved Sludge program to
+// the bytecode run by the vm package.
+//
+// Every function becomes a Function holding its instructions and a pool
+// of the constants they use. Variables the resolver located in a function
+// live in the slots of its stack frame, variables of enclosing functions
+// are captured into closures, and variables of the outermost scope are
+// globals looked up by name, as in the interpreter.
+package compiler
+
+import (
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/resolver"
+	"github.com/Toolnado/sludge/token"
+)
+
+const (
+	maxLocals    = 1 << 8
+	maxUpvalues  = 1 << 8
+	maxArguments = 1<<8 - 1
+	maxConstants = 1 << 16
+)
+
+// compoundOperators maps the operators of compound assignments to the
+// instructions they apply.
+var compoundOperators = map[token.TokenType]Opcode{
+	token.PLUS_EQUAL:    OpAdd,
+	token.MINUS_EQUAL:   OpSubtract,
+	token.STAR_EQUAL:    OpMultiply,
+	token.SLASH_EQUAL:   OpDivide,
+	token.PERCENT_EQUAL: OpModulo,
+}
+
+// binaryOperators maps the binary operators to their instructions.
+var binaryOperators = map[token.TokenType]Opcode{
+	token.PLUS:          OpAdd,
+	token.MINUS:         OpSubtract,
+	token.STAR:          OpMultiply,
+	token.SLASH:         OpDivide,
+	token.PERCENT:       OpModulo,
+	token.EQUAL_EQUAL:   OpEqual,
+	token.BANG_EQUAL:    OpNotEqual,
+	token.LESS:          OpLess,
+	token.LESS_EQUAL:    OpLessEqual,
+	token.GREATER:       OpGreater,
+	token.GREATER_EQUAL: OpGreaterEqual,
+}
+
+// function is the state of a function being compiled.
+type function struct {
+	enclosing *function
+	target    *Function
+	constants map[any]int // Constants already in the pool, by value
+	upvalues  []upvalue
+	slots     int             // Slots taken by the variables of the open scopes
+	captured  [maxLocals]bool // Slots captured by closures
+	depth     int             // Values on the stack above the slots
+	maxDepth  int
+	loops     []*loop
+	tries     []*try         // Handlers of the try statements being compiled, innermost last
+	pos       token.Position // Position of the last instruction that can fail
+}
+
+// upvalue is a variable captured by a closure: a slot of the enclosing
+// function if local is set, or one of its captured variables otherwise.
+type upvalue struct {
+	local bool
+	index int
+}
+
+// scope mirrors a scope of the resolver. Its variables take the slots
+// from base on, in the order the resolver numbered them.
+type scope struct {
+	function *function // Nil for the outermost scope, whose variables are globals
+	base     int
+	declared int // Variables declared so far
+}
+
+// loop is a loop whose body is being compiled.
+type loop struct {
+	depth     int   // Values on the stack when the loop started
+	slots     int   // First slot of the variables declared in the body
+	breaks    []int // Jumps to the end of the loop
+	continues []int // Jumps to the increment of the loop
+}
+
+// try is the handler of a try statement whose body, or whose catch clause
+// followed by a finally block, is being compiled.
+type try struct {
+	loops   int        // Loops open when the handler was installed
+	scopes  int        // Scopes open when the handler was installed
+	finally []ast.Stmt // Finally block to run when leaving the handler's code, if any
+}
+
+// Compiler compiles the syntax tree of a program into bytecode.
+type Compiler struct {
+	slots    map[ast.Expr]resolver.Slot
+	function *function
+	scopes   []*scope
+	err      error
+}
+
+// Compile compiles a program, or a module, into the function that runs
+// it. Slots are the slots the resolver found for its variables.
+func Compile(stmts []ast.Stmt, slots map[ast.Expr]resolver.Slot) (*Function, error) {
+	c := &Compiler{slots: slots}
+	c.begin(&Function{})
+	c.scopes = append(c.scopes, &scope{})
+	for _, v := range ast.HoistedVars(stmts) {
+		c.emitAt(v.Name.Position, OpHoistGlobal, c.identifier(v.Name.Lexeme))
+	}
+	c.statements(stmts)
+	c.emit(OpNil)
+	c.emit(OpReturn)
+	f := c.end()
+	if c.err != nil {
+		return nil, c.err
+	}
+	return f, nil
+}
+
+// begin starts compiling target. Its first slot holds the function being
+// called, or the instance a method is called on.
+func (c *Compiler) begin(target *Function) {
+	c.function = &function{
+		enclosing: c.function,
+		target:    target,
+		constants: make(map[any]int),
+	}
+	c.reserve(1)
+}
+
+// end finishes the current function and returns to the enclosing one.
+func (c *Compiler) end() *Function {
+	f := c.function
+	f.target.Upvalues = len(f.upvalues)
+	f.target.Slots = f.target.Locals + f.maxDepth
+	c.function = f.enclosing
+	return f.target
+}
+
+// closure compiles the body of a function and pushes a closure of it. The
+// body sees its parameters and hoisted variables in a scope of its own,
+// and methods see "this" in the scope just outside of it.
+func (c *Compiler) closure(name string, params []token.Token, body []ast.Stmt, method bool) {
+	target := &Function{Name: name, Arity: len(params)}
+	if len(params) > maxArguments {
+		c.error(params[maxArguments].Position, "can't have more than 255 parameters")
+	}
+	c.begin(target)
+	if method {
+		target.Initializer = name == "init"
+		c.scopes = append(c.scopes, &scope{function: c.function, base: 0, declared: 1})
+	}
+	hoisted := ast.HoistedVars(body)
+	s := c.beginScope(len(params) + len(hoisted) + declarations(body))
+	s.declared = len(params) + len(hoisted)
+	c.undeclare(declarations(body))
+	c.statements(body)
+	c.returnValue(nil)
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	if method {
+		c.scopes = c.scopes[:len(c.scopes)-1]
+	}
+	upvalues := c.function.upvalues
+	c.end()
+
+	c.emit(OpClosure, c.constant(target))
+	for _, u := range upvalues {
+		local := byte(0)
+		if u.local {
+			local = 1
+		}
+		c.function.target.Code = append(c.function.target.Code, local, byte(u.index))
+	}
+}
+
+// returnValue returns the value of expr, or nil if expr is nil, from the
+// current function. Initializers evaluate it but return their instance.
+func (c *Compiler) returnValue(expr ast.Expr) {
+	switch {
+	case c.function.target.Initializer:
+		if expr != nil {
+			c.expression(expr)
+			c.emit(OpPop)
+		}
+		c.emit(OpGetLocal, 0)
+	case expr != nil:
+		// The result of a call returned at once is left to the callee,
+		// which may run in place of the current function, unless a try
+		// statement still has to finish once the call returns.
+		if call, ok := expr.(*ast.CallExpr); ok && len(c.function.tries) == 0 {
+			c.call(call, OpTailCall)
+		} else {
+			c.expression(expr)
+		}
+	default:
+		c.emit(OpNil)
+	}
+	c.leaveTries(0)
+	c.emit(OpReturn)
+}
+
+func (c *Compiler) VisitPrintStmt(stmt *ast.PrintStmt) (any, error) {
+	c.expression(stmt.Expession)
+	c.emit(OpPrint)
+	return nil, nil
+}
+
+func (c *Compiler) VisitEmitStmt(stmt *ast.EmitStmt) (any, error) {
+	c.expression(stmt.Value)
+	c.emit(OpEmit)
+	return nil, nil
+}
+
+func (c *Compiler) VisitExprStmt(stmt *ast.ExprStmt) (any, error) {
+	switch expr := stmt.Expession.(type) {
+	case *ast.BlockStmt, *ast.IfStmt, *ast.WhileStmt:
+		c.compile(expr)
+	case *ast.AssignExpr:
+		c.assign(expr)
+		c.emit(OpPop)
+	default:
+		c.expression(expr)
+		c.emit(OpPop)
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitVarStmt(stmt *ast.VarStmt) (any, error) {
+	if stmt.Keyword.Type == token.VAR {
+		// The variable was hoisted to the top of its function, so only the
+		// initializer is left to assign.
+		if stmt.Initializer != nil {
+			c.expression(stmt.Initializer)
+			c.store(stmt, stmt.Name)
+			c.emit(OpPop)
+		}
+		return nil, nil
+	}
+
+	if stmt.Initializer != nil {
+		c.expression(stmt.Initializer)
+	} else {
+		c.emit(OpNil)
+	}
+	if stmt.Keyword.Type == token.CONST {
+		c.declare(stmt.Name, OpDeclareConst)
+	} else {
+		c.declare(stmt.Name, OpDeclareGlobal)
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitBlockStmt(stmt *ast.BlockStmt) (any, error) {
+	c.block(stmt.Statements)
+	return nil, nil
+}
+
+// block compiles statements that run in a scope of their own.
+func (c *Compiler) block(stmts []ast.Stmt) {
+	size := declarations(stmts)
+	c.beginScope(size)
+	c.undeclare(size)
+	c.statements(stmts)
+	c.endScope()
+}
+
+func (c *Compiler) VisitIfStmt(stmt *ast.IfStmt) (any, error) {
+	c.expression(stmt.Condition)
+	elseJump := c.emitJump(OpJumpIfFalse)
+	c.compile(stmt.ThenBranch)
+	if stmt.ElseBranch == nil {
+		c.patch(elseJump)
+		return nil, nil
+	}
+	endJump := c.emitJump(OpJump)
+	c.patch(elseJump)
+	c.compile(stmt.ElseBranch)
+	c.patch(endJump)
+	return nil, nil
+}
+
+func (c *Compiler) VisitWhileStmt(stmt *ast.WhileStmt) (any, error) {
+	f := c.function
+	start := len(f.target.Code)
+	c.expression(stmt.Condition)
+	exitJump := c.emitJump(OpJumpIfFalse)
+
+	l := &loop{depth: f.depth, slots: f.slots}
+	f.loops = append(f.loops, l)
+	c.compile(stmt.Body)
+	f.loops = f.loops[:len(f.loops)-1]
+
+	for _, jump := range l.continues {
+		c.patch(jump)
+	}
+	if stmt.Increment != nil {
+		c.expression(stmt.Increment)
+		c.emit(OpPop)
+	}
+	c.emitLoop(start)
+	c.patch(exitJump)
+	for _, jump := range l.breaks {
+		c.patch(jump)
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitBreakStmt(stmt *ast.BreakStmt) (any, error) {
+	l := c.leaveLoop()
+	l.breaks = append(l.breaks, c.emitJump(OpJump))
+	return nil, nil
+}
+
+func (c *Compiler) VisitContinueStmt(stmt *ast.ContinueStmt) (any, error) {
+	l := c.leaveLoop()
+	l.continues = append(l.continues, c.emitJump(OpJump))
+	return nil, nil
+}
+
+// leaveLoop drops what the body of the innermost loop left on the stack
+// before a break or continue jumps out of it, leaving the try statements
+// inside the loop on the way, and returns the loop.
+func (c *Compiler) leaveLoop() *loop {
+	f := c.function
+	l := f.loops[len(f.loops)-1]
+	depth := f.depth
+	for i := l.depth; i < depth; i++ {
+		c.emit(OpPop)
+	}
+	c.leaveTries(len(f.loops))
+	f.depth = depth
+	if f.slots > l.slots {
+		c.emit(OpCloseUpvalues, l.slots)
+	}
+	return l
+}
+
+// leaveTries removes the handlers of the try statements installed while
+// more than loops loops were open, innermost first, running their finally
+// blocks, before a jump or return leaves them.
+func (c *Compiler) leaveTries(loops int) {
+	f := c.function
+	tries := f.tries
+	for len(f.tries) > 0 && f.tries[len(f.tries)-1].loops >= loops {
+		t := f.tries[len(f.tries)-1]
+		c.emit(OpEndTry)
+		// The finally block runs outside of the handler, like those of
+		// the enclosing try statements.
+		f.tries = f.tries[:len(f.tries)-1]
+		if t.finally != nil {
+			c.finally(t)
+		}
+	}
+	f.tries = tries
+}
+
+// finally compiles the finally block of t where a jump or return leaves its
+// try statement. The resolver located the variables of the block from the
+// scope of the statement, so the scopes opened inside it are left out
+// while the block is compiled.
+func (c *Compiler) finally(t *try) {
+	open := c.scopes
+	c.scopes = c.scopes[:t.scopes:t.scopes]
+	c.block(t.finally)
+	c.scopes = open
+}
+
+func (c *Compiler) VisitThrowStmt(stmt *ast.ThrowStmt) (any, error) {
+	c.expression(stmt.Value)
+	c.emitAt(stmt.Keyword.Position, OpThrow)
+	return nil, nil
+}
+
+// VisitTryStmt compiles a try statement. A handler for the errors of the
+// body jumps to the catch clause, which gets the error in the first slot
+// of its scope. Another handler, for the errors of the body and the catch
+// clause, runs the finally block and raises the error again. The finally
+// block is also compiled where the statement ends normally and wherever a
+// break, continue or return leaves it.
+func (c *Compiler) VisitTryStmt(stmt *ast.TryStmt) (any, error) {
+	f := c.function
+	slots := f.slots
+	loops := len(f.loops)
+
+	finallyHandler := -1
+	if stmt.Finally != nil {
+		finallyHandler = c.emitJump(OpTry)
+		f.tries = append(f.tries, &try{loops: loops, scopes: len(c.scopes), finally: stmt.Finally})
+	}
+
+	if stmt.Name.Type != token.IDENTIFIER {
+		c.block(stmt.Body)
+	} else {
+		catchHandler := c.emitJump(OpTry)
+		f.tries = append(f.tries, &try{loops: loops})
+		c.block(stmt.Body)
+		f.tries = f.tries[:len(f.tries)-1]
+		c.emit(OpEndTry)
+		end := c.emitJump(OpJump)
+
+		c.patch(catchHandler)
+		c.caught(slots)
+		c.emit(OpCatch)
+		size := 1 + declarations(stmt.Catch)
+		c.beginScope(size)
+		c.declare(stmt.Name, OpDeclareGlobal)
+		c.undeclare(size - 1)
+		c.statements(stmt.Catch)
+		c.endScope()
+		c.patch(end)
+	}
+
+	if finallyHandler >= 0 {
+		f.tries = f.tries[:len(f.tries)-1]
+		c.emit(OpEndTry)
+		c.block(stmt.Finally)
+		end := c.emitJump(OpJump)
+
+		c.patch(finallyHandler)
+		c.caught(slots)
+		c.block(stmt.Finally)
+		c.emit(OpRethrow)
+		c.patch(end)
+	}
+	return nil, nil
+}
+
+// caught starts the code a handler jumps to, with the error on top of the
+// stack. Closures may have captured variables of the statements the error
+// left, from slot on.
+func (c *Compiler) caught(slot int) {
+	c.function.depth++
+	c.emit(OpCloseUpvalues, slot)
+}
+
+func (c *Compiler) VisitFunctionStmt(stmt *ast.FunctionStmt) (any, error) {
+	c.closure(stmt.Name.Lexeme, stmt.Params, stmt.Body, false)
+	c.declare(stmt.Name, OpDeclareGlobal)
+	return nil, nil
+}
+
+func (c *Compiler) VisitFunctionExpr(expr *ast.FunctionExpr) (any, error) {
+	c.closure("", expr.Params, expr.Body, false)
+	return nil, nil
+}
+
+func (c *Compiler) VisitReturnStmt(stmt *ast.ReturnStmt) (any, error) {
+	c.returnValue(stmt.Value)
+	return nil, nil
+}
+
+func (c *Compiler) VisitClassStmt(stmt *ast.ClassStmt) (any, error) {
+	if stmt.Superclass != nil {
+		c.load(stmt.Superclass, stmt.Superclass.Name)
+		c.emitAt(stmt.Superclass.Name.Position, OpCheckSuperclass)
+	}
+
+	// The class is declared before its methods are created, so that they
+	// can refer to it, and assigned once it is complete.
+	outer := c.scopes[len(c.scopes)-1]
+	slot := outer.base + outer.declared
+	c.emit(OpNil)
+	c.declare(stmt.Name, OpDeclareGlobal)
+
+	var super *scope
+	if stmt.Superclass != nil {
+		super = c.beginScope(1)
+		super.declared = 1
+		c.emit(OpSetLocal, super.base)
+		c.emit(OpPop)
+	}
+
+	c.emit(OpClass, c.identifier(stmt.Name.Lexeme))
+	if super != nil {
+		c.emit(OpGetLocal, super.base)
+		c.emit(OpInherit)
+	}
+	for _, method := range stmt.Methods {
+		c.closure(method.Name.Lexeme, method.Params, method.Body, true)
+		c.emit(OpMethod, c.identifier(method.Name.Lexeme))
+	}
+
+	if outer.function == nil {
+		c.emitAt(stmt.Name.Position, OpSetGlobal, c.identifier(stmt.Name.Lexeme))
+	} else {
+		c.emit(OpSetLocal, slot)
+	}
+	c.emit(OpPop)
+	if super != nil {
+		c.endScope()
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitRecordStmt(stmt *ast.RecordStmt) (any, error) {
+	declaration := make([]string, 0, len(stmt.Fields)+1)
+	declaration = append(declaration, stmt.Name.Lexeme)
+	for _, field := range stmt.Fields {
+		declaration = append(declaration, field.Lexeme)
+	}
+	c.emit(OpRecord, c.constant(declaration))
+	c.declare(stmt.Name, OpDeclareGlobal)
+	return nil, nil
+}
+
+func (c *Compiler) VisitImportStmt(stmt *ast.ImportStmt) (any, error) {
+	c.emitAt(stmt.Path.Position, OpImport, c.constant(stmt.Path.Literal.(string)))
+	if stmt.Alias.Type == token.IDENTIFIER {
+		c.emit(OpDup)
+		c.declare(stmt.Alias, OpDeclareGlobal)
+	}
+	for _, name := range stmt.Names {
+		c.emitAt(name.Position, OpImportName, c.identifier(name.Lexeme))
+		c.declare(name, OpDeclareGlobal)
+	}
+	c.emit(OpPop)
+	return nil, nil
+}
+
+func (c *Compiler) VisitLogicalExpr(expr *ast.LogicalExpr) (any, error) {
+	c.expression(expr.Left)
+	op := OpJumpIfFalseOrPop
+	if expr.Operator.Type == token.OR {
+		op = OpJumpIfTrueOrPop
+	}
+	jump := c.emitJump(op)
+	c.expression(expr.Right)
+	c.patch(jump)
+	return nil, nil
+}
+
+func (c *Compiler) VisitCallExpr(expr *ast.CallExpr) (any, error) {
+	c.call(expr, OpCall)
+	return nil, nil
+}
+
+// call compiles a call made by op, OpCall or OpTailCall.
+func (c *Compiler) call(expr *ast.CallExpr, op Opcode) {
+	if len(expr.Arguments) > maxArguments {
+		c.error(expr.Paren.Position, "can't have more than 255 arguments")
+	}
+	c.expression(expr.Callee)
+	for _, argument := range expr.Arguments {
+		c.expression(argument)
+	}
+	c.emitAt(expr.Paren.Position, op, len(expr.Arguments))
+}
+
+func (c *Compiler) VisitBinaryExpr(expr *ast.BinaryExpr) (any, error) {
+	c.expression(expr.Left)
+	c.expression(expr.Right)
+	c.emitAt(expr.Operator.Position, binaryOperators[expr.Operator.Type])
+	return nil, nil
+}
+
+func (c *Compiler) VisitUnaryExpr(expr *ast.UnaryExpr) (any, error) {
+	c.expression(expr.Right)
+	if expr.Operator.Type == token.MINUS {
+		c.emitAt(expr.Operator.Position, OpNegate)
+	} else {
+		c.emit(OpNot)
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitLiteralExpr(expr *ast.LiteralExpr) (any, error) {
+	switch expr.Value {
+	case nil:
+		c.emit(OpNil)
+	case true:
+		c.emit(OpTrue)
+	case false:
+		c.emit(OpFalse)
+	default:
+		c.emit(OpConstant, c.constant(expr.Value))
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitGroupingExpr(expr *ast.GroupingExpr) (any, error) {
+	c.expression(expr.Expession)
+	return nil, nil
+}
+
+func (c *Compiler) VisitVariableExpr(expr *ast.VariableExpr) (any, error) {
+	c.load(expr, expr.Name)
+	return nil, nil
+}
+
+// VisitAssignExpr compiles an assignment, whose value is nil as in the
+// interpreter.
+func (c *Compiler) VisitAssignExpr(expr *ast.AssignExpr) (any, error) {
+	c.assign(expr)
+	c.emit(OpPop)
+	c.emit(OpNil)
+	return nil, nil
+}
+
+// assign compiles an assignment leaving the assigned value on the stack.
+func (c *Compiler) assign(expr *ast.AssignExpr) {
+	c.expression(expr.Value)
+	c.store(expr, expr.Name)
+}
+
+func (c *Compiler) VisitCompoundAssignExpr(expr *ast.CompoundAssignExpr) (any, error) {
+	op := compoundOperators[expr.Operator.Type]
+	switch target := expr.Target.(type) {
+	case *ast.VariableExpr:
+		c.load(target, target.Name)
+		c.expression(expr.Value)
+		c.emitAt(expr.Operator.Position, op)
+		c.store(target, target.Name)
+	case *ast.IndexExpr:
+		c.expression(target.Object)
+		c.expression(target.Index)
+		c.emit(OpDup2)
+		c.emitAt(target.Bracket.Position, OpGetIndex)
+		c.expression(expr.Value)
+		c.emitAt(expr.Operator.Position, op)
+		c.emitAt(target.Bracket.Position, OpSetIndex)
+	case *ast.GetExpr:
+		c.expression(target.Object)
+		c.emitAt(target.Name.Position, OpGetPropertyKeep, c.identifier(target.Name.Lexeme))
+		c.expression(expr.Value)
+		c.emitAt(expr.Operator.Position, op)
+		c.emitAt(target.Name.Position, OpSetProperty, c.identifier(target.Name.Lexeme))
+	default:
+		c.error(expr.Operator.Position, "invalid assignment target")
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitListExpr(expr *ast.ListExpr) (any, error) {
+	for _, element := range expr.Elements {
+		c.expression(element)
+	}
+	c.emit(OpList, len(expr.Elements))
+	return nil, nil
+}
+
+func (c *Compiler) VisitIndexExpr(expr *ast.IndexExpr) (any, error) {
+	c.expression(expr.Object)
+	c.expression(expr.Index)
+	c.emitAt(expr.Bracket.Position, OpGetIndex)
+	return nil, nil
+}
+
+func (c *Compiler) VisitSliceExpr(expr *ast.SliceExpr) (any, error) {
+	c.expression(expr.Object)
+	for _, bound := range []ast.Expr{expr.Start, expr.End} {
+		if bound != nil {
+			c.expression(bound)
+		} else {
+			c.emit(OpNil)
+		}
+	}
+	c.emitAt(expr.Bracket.Position, OpSlice)
+	return nil, nil
+}
+
+func (c *Compiler) VisitIndexSetExpr(expr *ast.IndexSetExpr) (any, error) {
+	c.expression(expr.Object)
+	c.expression(expr.Index)
+	c.expression(expr.Value)
+	c.emitAt(expr.Bracket.Position, OpSetIndex)
+	return nil, nil
+}
+
+func (c *Compiler) VisitMapExpr(expr *ast.MapExpr) (any, error) {
+	c.emit(OpMap)
+	for indx := range expr.Keys {
+		c.expression(expr.Keys[indx])
+		c.expression(expr.Values[indx])
+		c.emitAt(expr.Bracket.Position, OpMapEntry)
+	}
+	return nil, nil
+}
+
+func (c *Compiler) VisitGetExpr(expr *ast.GetExpr) (any, error) {
+	c.expression(expr.Object)
+	c.emitAt(expr.Name.Position, OpGetProperty, c.identifier(expr.Name.Lexeme))
+	return nil, nil
+}
+
+func (c *Compiler) VisitSetExpr(expr *ast.SetExpr) (any, error) {
+	name := c.identifier(expr.Name.Lexeme)
+	c.expression(expr.Object)
+	c.emitAt(expr.Name.Position, OpCheckProperty, name)
+	c.expression(expr.Value)
+	c.emit(OpSetProperty, name)
+	return nil, nil
+}
+
+func (c *Compiler) VisitThisExpr(expr *ast.ThisExpr) (any, error) {
+	c.load(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (c *Compiler) VisitSuperExpr(expr *ast.SuperExpr) (any, error) {
+	// "this" is the only variable of the scope just inside the one
+	// holding "super".
+	slot := c.slots[expr]
+	this := c.scopes[len(c.scopes)-slot.Depth]
+	if this.function == c.function {
+		c.emit(OpGetLocal, this.base)
+	} else {
+		c.emit(OpGetUpvalue, c.upvalue(c.function, this.function, this.base, expr.Keyword))
+	}
+	c.load(expr, expr.Keyword)
+	c.emitAt(expr.Method.Position, OpGetSuper, c.identifier(expr.Method.Lexeme))
+	return nil, nil
+}
+
+func (c *Compiler) VisitWithExpr(expr *ast.WithExpr) (any, error) {
+	c.expression(expr.Object)
+	c.emitAt(expr.Keyword.Position, OpCheckRecord)
+	names := make([]string, len(expr.Names))
+	for indx, name := range expr.Names {
+		names[indx] = name.Lexeme
+		c.expression(expr.Values[indx])
+	}
+	c.emitAt(expr.Keyword.Position, OpWith, c.constant(names))
+	// The operand of OpWith is a constant, so the values it pops are
+	// counted here.
+	c.function.depth -= len(names)
+	return nil, nil
+}
+
+func (c *Compiler) VisitInterpolationExpr(expr *ast.InterpolationExpr) (any, error) {
+	for _, part := range expr.Parts {
+		c.expression(part)
+	}
+	c.emit(OpInterpolate, len(expr.Parts))
+	return nil, nil
+}
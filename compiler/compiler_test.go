@@ -0,0 +1,154 @@
+package compiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+	"github.com/Toolnado/sludge/resolver"
+)
+
+// disassemble compiles the input and returns its disassembly.
+func disassemble(t *testing.T, input string) string {
+	t.Helper()
+	l := lexer.New(strings.NewReader(input))
+	p := parser.New(l.ScanTokens())
+	stmts, err := p.Parse()
+	if err != nil || p.HadError() {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	r := resolver.New("len")
+	if err := r.Resolve(stmts); err != nil {
+		t.Fatalf("unexpected resolve error: %v", err)
+	}
+	f, err := Compile(stmts, r.Slots())
+	if err != nil {
+		t.Fatalf("unexpected compile error: %v", err)
+	}
+	b := &strings.Builder{}
+	Disassemble(b, f)
+	return b.String()
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string // Instructions expected in the disassembly, in order
+	}{
+		{
+			name:  "globals are looked up by name",
+			input: "let a = 1;\nprint a;",
+			want: []string{
+				"0000    0:0   CONSTANT             0 1",
+				"0003    1:5   DECLARE_GLOBAL       1 a",
+				"0006    2:7   GET_GLOBAL           1 a",
+				"0009    2:7   PRINT",
+			},
+		},
+		{
+			name:  "builtins are looked up through the enclosing scopes",
+			input: "print len([]);",
+			want: []string{
+				"GET_NAME             0 len",
+				"LIST                 0",
+				"CALL                 1",
+			},
+		},
+		{
+			name:  "parameters and locals live in slots",
+			input: "function f(a) {\n  let b = a;\n  { let c = b; }\n}",
+			want: []string{
+				"== f ==",
+				"GET_LOCAL            1",
+				"SET_LOCAL            2",
+				"GET_LOCAL            2",
+				"SET_LOCAL            3",
+			},
+		},
+		{
+			name:  "captured variables are closed over",
+			input: "function f() {\n  let a = 1;\n  return function() { return a; };\n}",
+			want: []string{
+				"CLOSURE              1 <fn> local 1",
+				"== <fn> ==",
+				"GET_UPVALUE          0",
+			},
+		},
+		{
+			name:  "loops jump back to their condition",
+			input: "var i = 0;\nwhile (i < 3) i += 1;",
+			want: []string{
+				"0000    1:5   HOIST_GLOBAL         0 i",
+				"0006    1:5   SET_GLOBAL           0 i",
+				"0010    2:8   GET_GLOBAL           0 i",
+				"0016    2:10  LESS",
+				"0017    2:10  JUMP_IF_FALSE        14 -> 0034",
+				"0026    2:17  ADD",
+				"0031    2:15  LOOP                 24 -> 0010",
+			},
+		},
+		{
+			name:  "returned calls are tail calls",
+			input: "function f(n) {\n  print f(n);\n  return f(n);\n}",
+			want: []string{
+				"== f ==",
+				"CALL                 1",
+				"PRINT",
+				"TAIL_CALL            1",
+				"RETURN",
+			},
+		},
+		{
+			name:  "try statements install handlers",
+			input: "function f() {\n  try {\n    return f();\n  } catch (e) {\n    throw e;\n  } finally {\n    print 1;\n  }\n}",
+			want: []string{
+				"== f ==",
+				"TRY                  36 -> 0039",
+				"TRY                  16 -> 0022",
+				"CALL                 0",
+				"END_TRY",
+				"END_TRY",
+				"PRINT",
+				"RETURN",
+				"0022    3:14  CLOSE_UPVALUES       1",
+				"CATCH",
+				"SET_LOCAL            1",
+				"THROW",
+				"END_TRY",
+				"PRINT",
+				"0039    5:5   CLOSE_UPVALUES       1",
+				"PRINT",
+				"RETHROW",
+			},
+		},
+		{
+			name:  "methods see the instance in slot zero",
+			input: "class A {\n  init(x) { this.x = x; }\n}",
+			want: []string{
+				"CLASS                0 A",
+				"METHOD               2 init",
+				"== init ==",
+				"GET_LOCAL            0",
+				"CHECK_PROPERTY       0 x",
+				"GET_LOCAL            1",
+				"SET_PROPERTY         0 x",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := disassemble(t, tt.input)
+			rest := got
+			for _, want := range tt.want {
+				indx := strings.Index(rest, want)
+				if indx < 0 {
+					t.Fatalf("expected %q in order in:\n%s", want, got)
+				}
+				rest = rest[indx+len(want):]
+			}
+		})
+	}
+}
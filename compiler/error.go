@@ -0,0 +1,13 @@
+package compiler
+
+import (
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/token"
+)
+
+// NewError returns the diagnostic of a program that is valid but exceeds a
+// limit of the bytecode, such as the number of local variables of a
+// function.
+func NewError(message string, pos token.Position) diagnostic.Diagnostic {
+	return diagnostic.New(diagnostic.ErrLimit, message, diagnostic.At(pos))
+}
@@ -0,0 +1,332 @@
+package compiler
+
+import (
+	"reflect"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/token"
+)
+
+// compile compiles a single node. Optional nodes may be nil.
+func (c *Compiler) compile(node ast.Expr) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+	node.Accept(c)
+}
+
+func (c *Compiler) statements(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		c.compile(stmt)
+	}
+}
+
+// expression compiles expr so that it leaves its value on the stack.
+// Blocks, conditionals and loops can be used as expressions, and their
+// value is nil as in the interpreter.
+func (c *Compiler) expression(expr ast.Expr) {
+	c.compile(expr)
+	if isStatement(expr) {
+		c.emit(OpNil)
+	}
+}
+
+// isStatement reports whether expr is one of the statements the parser
+// accepts where an expression is expected.
+func isStatement(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.BlockStmt, *ast.IfStmt, *ast.WhileStmt:
+		return true
+	default:
+		return false
+	}
+}
+
+// declarations counts the variables that stmts declare in their own scope.
+// Var declarations belong to the enclosing function and aren't counted.
+func declarations(stmts []ast.Stmt) int {
+	count := 0
+	for _, stmt := range stmts {
+		switch s := stmt.(type) {
+		case *ast.VarStmt:
+			if s.Keyword.Type != token.VAR {
+				count++
+			}
+		case *ast.FunctionStmt, *ast.ClassStmt, *ast.RecordStmt:
+			count++
+		case *ast.ImportStmt:
+			if s.Alias.Type == token.IDENTIFIER {
+				count++
+			}
+			count += len(s.Names)
+		}
+	}
+	return count
+}
+
+// beginScope opens a scope of the current function with room for size
+// variables.
+func (c *Compiler) beginScope(size int) *scope {
+	s := &scope{function: c.function, base: c.function.slots}
+	c.scopes = append(c.scopes, s)
+	c.reserve(size)
+	return s
+}
+
+// undeclare marks the slots of the variables that the innermost scope
+// declares from now on as not declared yet. Their slots may hold values
+// left over from a previous run of the scope or from a sibling scope.
+func (c *Compiler) undeclare(size int) {
+	if size > 0 {
+		s := c.scopes[len(c.scopes)-1]
+		c.emit(OpUndeclare, s.base+s.declared, size)
+	}
+}
+
+// endScope closes the innermost scope, moving the variables closures
+// captured from it off the stack, and frees its slots.
+func (c *Compiler) endScope() {
+	s := c.scopes[len(c.scopes)-1]
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	f := s.function
+	for slot := s.base; slot < f.slots; slot++ {
+		if f.captured[slot] {
+			c.emit(OpCloseUpvalues, s.base)
+			break
+		}
+	}
+	for slot := s.base; slot < f.slots; slot++ {
+		f.captured[slot] = false
+	}
+	f.slots = s.base
+}
+
+// reserve adds size slots for variables to the current function.
+func (c *Compiler) reserve(size int) {
+	f := c.function
+	f.slots += size
+	if f.slots > maxLocals {
+		c.error(f.pos, "too many local variables in function")
+		f.slots = maxLocals
+	}
+	if f.slots > f.target.Locals {
+		f.target.Locals = f.slots
+	}
+}
+
+// declare pops the value on top of the stack into the variable name, the
+// next declaration of the innermost scope. Variables of the outermost
+// scope are globals, declared with op; the others live in slots.
+func (c *Compiler) declare(name token.Token, op Opcode) {
+	s := c.scopes[len(c.scopes)-1]
+	if s.function == nil {
+		c.emitAt(name.Position, op, c.identifier(name.Lexeme))
+		return
+	}
+	c.emit(OpSetLocal, s.base+s.declared)
+	c.emit(OpPop)
+	s.declared++
+}
+
+// variable returns the instructions that read and assign the variable name
+// used by expr, and their operand. Variables the resolver located in a
+// scope of the current function are slots of its frame, those of enclosing
+// functions are captured, and the rest are looked up by name.
+func (c *Compiler) variable(expr ast.Expr, name token.Token) (get, set Opcode, operand int) {
+	slot, ok := c.slots[expr]
+	if !ok {
+		return OpGetName, OpSetName, c.identifier(name.Lexeme)
+	}
+	if slot.Index < 0 {
+		return OpGetGlobal, OpSetGlobal, c.identifier(name.Lexeme)
+	}
+	s := c.scopes[len(c.scopes)-1-slot.Depth]
+	index := s.base + slot.Index
+	if s.function == c.function {
+		return OpGetLocal, OpSetLocal, index
+	}
+	return OpGetUpvalue, OpSetUpvalue, c.upvalue(c.function, s.function, index, name)
+}
+
+// upvalue returns the index of the variable in slot of the function owner
+// among the captured variables of f, capturing it through every function
+// in between.
+func (c *Compiler) upvalue(f, owner *function, slot int, name token.Token) int {
+	u := upvalue{local: true, index: slot}
+	if f.enclosing == owner {
+		owner.captured[slot] = true
+	} else {
+		u = upvalue{index: c.upvalue(f.enclosing, owner, slot, name)}
+	}
+	for indx, existing := range f.upvalues {
+		if existing == u {
+			return indx
+		}
+	}
+	if len(f.upvalues) == maxUpvalues {
+		c.error(name.Position, "too many closure variables in function")
+		return 0
+	}
+	f.upvalues = append(f.upvalues, u)
+	return len(f.upvalues) - 1
+}
+
+// load pushes the value of the variable name used by expr.
+func (c *Compiler) load(expr ast.Expr, name token.Token) {
+	get, _, operand := c.variable(expr, name)
+	c.checkDeclared(expr, name, get, operand)
+	c.emitAt(name.Position, get, operand)
+}
+
+// store assigns the value on top of the stack to the variable name used by
+// expr, leaving the value on the stack.
+func (c *Compiler) store(expr ast.Expr, name token.Token) {
+	get, set, operand := c.variable(expr, name)
+	c.checkDeclared(expr, name, get, operand)
+	c.emitAt(name.Position, set, operand)
+}
+
+// checkDeclared makes the local or captured variable name used by expr fail
+// to be read or assigned before its declaration has run. No check is needed
+// once the declaration has been compiled, as it then runs first.
+func (c *Compiler) checkDeclared(expr ast.Expr, name token.Token, get Opcode, operand int) {
+	if get != OpGetLocal && get != OpGetUpvalue {
+		return
+	}
+	slot := c.slots[expr]
+	if slot.Index < c.scopes[len(c.scopes)-1-slot.Depth].declared {
+		return
+	}
+	op := OpCheckLocal
+	if get == OpGetUpvalue {
+		op = OpCheckUpvalue
+	}
+	c.emitAt(name.Position, op, operand, c.identifier(name.Lexeme))
+}
+
+// emit appends an instruction to the current function.
+func (c *Compiler) emit(op Opcode, args ...int) int {
+	f := c.function
+	offset := len(f.target.Code)
+	f.target.Code = append(f.target.Code, byte(op))
+	for indx, width := range operands[op] {
+		arg := 0
+		if indx < len(args) {
+			arg = args[indx]
+		}
+		if arg < 0 || arg >= 1<<(8*width) {
+			c.error(f.pos, "too many values in one instruction")
+			arg = 0
+		}
+		if width == 2 {
+			f.target.Code = append(f.target.Code, byte(arg>>8))
+		}
+		f.target.Code = append(f.target.Code, byte(arg))
+	}
+
+	f.depth += effect(op, args)
+	if f.depth > f.maxDepth {
+		f.maxDepth = f.depth
+	}
+	return offset
+}
+
+// emitAt appends an instruction whose errors are reported at pos.
+func (c *Compiler) emitAt(pos token.Position, op Opcode, args ...int) int {
+	f := c.function
+	f.pos = pos
+	if n := len(f.target.positions); n > 0 && f.target.positions[n-1].pos == pos {
+		return c.emit(op, args...)
+	}
+	f.target.positions = append(f.target.positions, position{offset: len(f.target.Code), pos: pos})
+	return c.emit(op, args...)
+}
+
+// effect returns how many values an instruction adds to the stack, or
+// removes from it if negative.
+func effect(op Opcode, args []int) int {
+	switch op {
+	case OpConstant, OpNil, OpTrue, OpFalse, OpDup, OpGetLocal, OpGetUpvalue,
+		OpGetGlobal, OpGetName, OpClosure, OpMap, OpGetPropertyKeep, OpClass,
+		OpRecord, OpImport, OpImportName:
+		return 1
+	case OpDup2:
+		return 2
+	case OpPop, OpDeclareGlobal, OpDeclareConst, OpAdd, OpSubtract, OpMultiply,
+		OpDivide, OpModulo, OpEqual, OpNotEqual, OpLess, OpLessEqual, OpGreater,
+		OpGreaterEqual, OpJumpIfFalse, OpJumpIfFalseOrPop, OpJumpIfTrueOrPop,
+		OpReturn, OpGetIndex, OpSetProperty, OpInherit, OpMethod, OpGetSuper,
+		OpPrint, OpEmit, OpThrow, OpRethrow:
+		return -1
+	case OpSetIndex, OpSlice, OpMapEntry:
+		return -2
+	case OpCall, OpTailCall:
+		return -args[0]
+	case OpList, OpInterpolate:
+		return 1 - args[0]
+	default:
+		return 0
+	}
+}
+
+// identifier returns the constant holding a name.
+func (c *Compiler) identifier(name string) int {
+	return c.constant(name)
+}
+
+// constant adds value to the constants of the current function, reusing
+// the slot of an equal number or string.
+func (c *Compiler) constant(value any) int {
+	f := c.function
+	switch value.(type) {
+	case int64, float64, string:
+		if indx, ok := f.constants[value]; ok {
+			return indx
+		}
+	}
+	if len(f.target.Constants) == maxConstants {
+		c.error(f.pos, "too many constants in function")
+		return 0
+	}
+	f.target.Constants = append(f.target.Constants, value)
+	indx := len(f.target.Constants) - 1
+	switch value.(type) {
+	case int64, float64, string:
+		f.constants[value] = indx
+	}
+	return indx
+}
+
+// emitJump appends a jump whose target is set later by patch.
+func (c *Compiler) emitJump(op Opcode) int {
+	return c.emit(op, 0)
+}
+
+// patch makes the jump at offset land on the next instruction.
+func (c *Compiler) patch(offset int) {
+	code := c.function.target.Code
+	distance := len(code) - (offset + 3)
+	if distance >= 1<<16 {
+		c.error(c.function.pos, "too much code to jump over")
+		return
+	}
+	code[offset+1] = byte(distance >> 8)
+	code[offset+2] = byte(distance)
+}
+
+// emitLoop appends a jump back to start.
+func (c *Compiler) emitLoop(start int) {
+	distance := len(c.function.target.Code) + 3 - start
+	if distance >= 1<<16 {
+		c.error(c.function.pos, "loop body too large")
+		distance = 0
+	}
+	c.emit(OpLoop, distance)
+}
+
+// error records the first error found while compiling.
+func (c *Compiler) error(pos token.Position, message string) {
+	if c.err == nil {
+		c.err = NewError(message, pos)
+	}
+}
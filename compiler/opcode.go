@@ -0,0 +1,220 @@
+package compiler
+
+// Opcode is the first byte of an instruction. Operands follow it as
+// unsigned big-endian integers: one byte for slots, upvalues and argument
+// counts, two bytes for constants, counts and jumps.
+type Opcode byte
+
+const (
+	OpConstant Opcode = iota // Push constant [u16]
+	OpNil
+	OpTrue
+	OpFalse
+	OpPop
+	OpDup  // Push the top of the stack again
+	OpDup2 // Push the top two values of the stack again, in the same order
+
+	OpGetLocal   // Push local slot [u8] of the current frame
+	OpSetLocal   // Store the top of the stack in local slot [u8], leaving it there
+	OpGetUpvalue // Push captured variable [u8] of the current closure
+	OpSetUpvalue // Store the top of the stack in captured variable [u8]
+
+	OpGetGlobal       // Push the variable named by constant [u16] of the module's scope
+	OpSetGlobal       // Store the top of the stack in the variable of the module's scope named by constant [u16]
+	OpGetName         // Push the variable named by constant [u16], searching the enclosing scopes too
+	OpSetName         // Like OpSetGlobal, searching the enclosing scopes too
+	OpDeclareGlobal   // Pop a value and declare it as the variable named by constant [u16]
+	OpDeclareConst    // Like OpDeclareGlobal for a constant
+	OpHoistGlobal     // Define the variable named by constant [u16] as nil if it doesn't exist yet
+	OpCloseUpvalues   // Move the variables captured from local slot [u8] upwards off the stack
+	OpUndeclare       // Mark the [u8] local slots from slot [u8] on as not declared yet
+	OpCheckLocal      // Fail unless the variable in local slot [u8], named by constant [u16], is declared
+	OpCheckUpvalue    // Fail unless captured variable [u8], named by constant [u16], is declared
+	OpCheckSuperclass // Fail unless the top of the stack is a class
+
+	OpAdd
+	OpSubtract
+	OpMultiply
+	OpDivide
+	OpModulo
+	OpEqual
+	OpNotEqual
+	OpLess
+	OpLessEqual
+	OpGreater
+	OpGreaterEqual
+	OpNegate
+	OpNot
+
+	OpJump             // Jump forward by [u16]
+	OpJumpIfFalse      // Pop a value and jump forward by [u16] if it is false
+	OpJumpIfFalseOrPop // Jump forward by [u16] if the top of the stack is false, pop it otherwise
+	OpJumpIfTrueOrPop  // Jump forward by [u16] if the top of the stack is true, pop it otherwise
+	OpLoop             // Jump backward by [u16]
+
+	OpTry     // Make the errors raised until the matching OpEndTry jump forward by [u16], the stack as it is now and the error pushed on it
+	OpEndTry  // Stop handling the errors of the innermost OpTry
+	OpThrow   // Pop a value and raise it as an error
+	OpCatch   // Replace the error on top of the stack with the value a catch clause receives, or raise it again if it can't be caught
+	OpRethrow // Pop an error and raise it again
+
+	OpCall     // Call the value below [u8] arguments
+	OpTailCall // Like OpCall, but the call may replace the current one, whose return follows
+	OpClosure  // Push a closure of the function in constant [u16], then [u8 local, u8 index] per upvalue
+	OpReturn   // Return the top of the stack from the current call
+
+	OpList            // Pop [u16] elements and push a list of them
+	OpMap             // Push an empty map
+	OpMapEntry        // Pop a key and a value and store them in the map below
+	OpGetIndex        // Pop an object and an index and push the element
+	OpSetIndex        // Pop an object, an index and a value, store the value and push it
+	OpSlice           // Pop an object, a start and an end and push the slice
+	OpGetProperty     // Pop an object and push its property named by constant [u16]
+	OpGetPropertyKeep // Like OpGetProperty, but leave the object below the property and fail unless the property can be assigned
+	OpCheckProperty   // Fail unless the property named by constant [u16] of the top of the stack can be assigned
+	OpSetProperty     // Pop an object and a value, store the value as property [u16] and push it
+	OpInterpolate     // Pop [u16] values and push their text, joined
+	OpCheckRecord     // Fail unless the top of the stack is a record value
+	OpWith            // Pop a record value and one value per field named by constant [u16] and push the updated record
+
+	OpClass      // Push a class named by constant [u16]
+	OpInherit    // Pop a superclass and make it the superclass of the class below
+	OpMethod     // Pop a closure and add it as method [u16] of the class below
+	OpGetSuper   // Pop an instance and a superclass and push method [u16] of the superclass bound to the instance
+	OpRecord     // Push a record declared by constant [u16], its name followed by its fields
+	OpImport     // Push the module at the path in constant [u16], running it on first use
+	OpImportName // Push the member named by constant [u16] of the module on top of the stack
+
+	OpPrint
+	OpEmit
+)
+
+// operands lists the width in bytes of the operands of each opcode that
+// has some. OpClosure is followed by further bytes for its upvalues.
+var operands = map[Opcode][]int{
+	OpConstant:      {2},
+	OpGetLocal:      {1},
+	OpSetLocal:      {1},
+	OpGetUpvalue:    {1},
+	OpSetUpvalue:    {1},
+	OpGetGlobal:     {2},
+	OpSetGlobal:     {2},
+	OpGetName:       {2},
+	OpSetName:       {2},
+	OpDeclareGlobal: {2},
+	OpDeclareConst:  {2},
+	OpHoistGlobal:   {2},
+	OpCloseUpvalues: {1},
+	OpUndeclare:     {1, 1},
+	OpCheckLocal:    {1, 2},
+	OpCheckUpvalue:  {1, 2},
+
+	OpJump:             {2},
+	OpJumpIfFalse:      {2},
+	OpJumpIfFalseOrPop: {2},
+	OpJumpIfTrueOrPop:  {2},
+	OpLoop:             {2},
+
+	OpTry: {2},
+
+	OpCall:     {1},
+	OpTailCall: {1},
+	OpClosure:  {2},
+
+	OpList:            {2},
+	OpGetProperty:     {2},
+	OpGetPropertyKeep: {2},
+	OpCheckProperty:   {2},
+	OpSetProperty:     {2},
+	OpInterpolate:     {2},
+	OpWith:            {2},
+
+	OpClass:      {2},
+	OpMethod:     {2},
+	OpGetSuper:   {2},
+	OpRecord:     {2},
+	OpImport:     {2},
+	OpImportName: {2},
+}
+
+var names = [...]string{
+	OpConstant:         "CONSTANT",
+	OpNil:              "NIL",
+	OpTrue:             "TRUE",
+	OpFalse:            "FALSE",
+	OpPop:              "POP",
+	OpDup:              "DUP",
+	OpDup2:             "DUP2",
+	OpGetLocal:         "GET_LOCAL",
+	OpSetLocal:         "SET_LOCAL",
+	OpGetUpvalue:       "GET_UPVALUE",
+	OpSetUpvalue:       "SET_UPVALUE",
+	OpGetGlobal:        "GET_GLOBAL",
+	OpSetGlobal:        "SET_GLOBAL",
+	OpGetName:          "GET_NAME",
+	OpSetName:          "SET_NAME",
+	OpDeclareGlobal:    "DECLARE_GLOBAL",
+	OpDeclareConst:     "DECLARE_CONST",
+	OpHoistGlobal:      "HOIST_GLOBAL",
+	OpCloseUpvalues:    "CLOSE_UPVALUES",
+	OpUndeclare:        "UNDECLARE",
+	OpCheckLocal:       "CHECK_LOCAL",
+	OpCheckUpvalue:     "CHECK_UPVALUE",
+	OpCheckSuperclass:  "CHECK_SUPERCLASS",
+	OpAdd:              "ADD",
+	OpSubtract:         "SUBTRACT",
+	OpMultiply:         "MULTIPLY",
+	OpDivide:           "DIVIDE",
+	OpModulo:           "MODULO",
+	OpEqual:            "EQUAL",
+	OpNotEqual:         "NOT_EQUAL",
+	OpLess:             "LESS",
+	OpLessEqual:        "LESS_EQUAL",
+	OpGreater:          "GREATER",
+	OpGreaterEqual:     "GREATER_EQUAL",
+	OpNegate:           "NEGATE",
+	OpNot:              "NOT",
+	OpJump:             "JUMP",
+	OpJumpIfFalse:      "JUMP_IF_FALSE",
+	OpJumpIfFalseOrPop: "JUMP_IF_FALSE_OR_POP",
+	OpJumpIfTrueOrPop:  "JUMP_IF_TRUE_OR_POP",
+	OpLoop:             "LOOP",
+	OpTry:              "TRY",
+	OpEndTry:           "END_TRY",
+	OpThrow:            "THROW",
+	OpCatch:            "CATCH",
+	OpRethrow:          "RETHROW",
+	OpCall:             "CALL",
+	OpTailCall:         "TAIL_CALL",
+	OpClosure:          "CLOSURE",
+	OpReturn:           "RETURN",
+	OpList:             "LIST",
+	OpMap:              "MAP",
+	OpMapEntry:         "MAP_ENTRY",
+	OpGetIndex:         "GET_INDEX",
+	OpSetIndex:         "SET_INDEX",
+	OpSlice:            "SLICE",
+	OpGetProperty:      "GET_PROPERTY",
+	OpGetPropertyKeep:  "GET_PROPERTY_KEEP",
+	OpCheckProperty:    "CHECK_PROPERTY",
+	OpSetProperty:      "SET_PROPERTY",
+	OpInterpolate:      "INTERPOLATE",
+	OpCheckRecord:      "CHECK_RECORD",
+	OpWith:             "WITH",
+	OpClass:            "CLASS",
+	OpInherit:          "INHERIT",
+	OpMethod:           "METHOD",
+	OpGetSuper:         "GET_SUPER",
+	OpRecord:           "RECORD",
+	OpImport:           "IMPORT",
+	OpImportName:       "IMPORT_NAME",
+	OpPrint:            "PRINT",
+	OpEmit:             "EMIT",
+}
+
+func (op Opcode) String() string {
+	if int(op) < len(names) && names[op] != "" {
+		return names[op]
+	}
+	return "UNKNOWN"
+}
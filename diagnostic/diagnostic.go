@@ -0,0 +1,186 @@
+// Package diagnostic defines the errors that the lexer, the parser, the
+// resolver, the compiler and the backends report about programs, so that
+// host code can inspect them: each one has a stable code, a severity, the
+// span of source it is about, a message and optional notes.
+package diagnostic
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Toolnado/sludge/token"
+)
+
+// Severity tells whether a diagnostic stops the program from running.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Span is the part of the source text from Start up to End, which is the
+// position right after its last character. A span whose End is not after
+// its Start is a single position.
+type Span struct {
+	Start token.Position
+	End   token.Position
+}
+
+// At returns the span of the single position pos.
+func At(pos token.Position) Span {
+	return Span{Start: pos, End: pos}
+}
+
+// TokenSpan returns the span of the lexeme of t. Tokens whose lexeme isn't
+// their source text, such as strings and the end of the input, get the
+// span of their position.
+func TokenSpan(t token.Token) Span {
+	switch t.Type {
+	case token.STRING, token.RAW_STRING, token.INTERPOLATION, token.EOF:
+		return At(t.Position)
+	}
+	end := t.Position
+	end.Offset += len(t.Lexeme)
+	end.Column += utf8.RuneCountInString(t.Lexeme)
+	return Span{Start: t.Position, End: end}
+}
+
+// IsPoint reports whether the span is a single position.
+func (s Span) IsPoint() bool {
+	return s.End.Offset <= s.Start.Offset
+}
+
+// Note is a remark attached to a diagnostic, such as where a name was
+// first declared. A note without a span is about the diagnostic as a whole.
+type Note struct {
+	Message string
+	Span    Span
+}
+
+// Diagnostic is an error found in a program. Its code is the code of the
+// kind it was made with, and errors.Is reports the kind, as well as the
+// error it was made from, if any.
+type Diagnostic struct {
+	Code     string
+	Severity Severity
+	Span     Span
+	Message  string
+	Notes    []Note
+
+	kind  *Kind
+	cause error
+}
+
+// New returns an error diagnostic of kind with message about span.
+func New(kind *Kind, message string, span Span) Diagnostic {
+	return Diagnostic{
+		Code:     kind.Code,
+		Severity: SeverityError,
+		Span:     span,
+		Message:  message,
+		kind:     kind,
+	}
+}
+
+// FromError returns an error diagnostic about span with the text of err as
+// the message. Its kind is the kind err was made with by Errorf, or
+// fallback if it has none.
+func FromError(err error, span Span, fallback *Kind) Diagnostic {
+	kind := KindOf(err)
+	if kind == nil {
+		kind = fallback
+	}
+	d := New(kind, err.Error(), span)
+	d.cause = err
+	return d
+}
+
+// WithNote returns the diagnostic with a note of message about span.
+func (d Diagnostic) WithNote(message string, span Span) Diagnostic {
+	d.Notes = append(d.Notes[:len(d.Notes):len(d.Notes)], Note{Message: message, Span: span})
+	return d
+}
+
+// Kind returns the kind the diagnostic was made with.
+func (d Diagnostic) Kind() *Kind {
+	return d.kind
+}
+
+// Error returns the message and the position the diagnostic starts at,
+// followed by a line for each note.
+func (d Diagnostic) Error() string {
+	b := &strings.Builder{}
+	b.WriteString(d.Message)
+	b.WriteString("\n")
+	b.WriteString(FormatPosition(d.Span.Start))
+	for _, note := range d.Notes {
+		b.WriteString("\n  ")
+		b.WriteString(note.Message)
+		if note.Span.Start.Line > 0 {
+			b.WriteString(" at ")
+			b.WriteString(FormatPosition(note.Span.Start))
+		}
+	}
+	return b.String()
+}
+
+// Unwrap returns the error the diagnostic was made from and its kind.
+func (d Diagnostic) Unwrap() []error {
+	var errs []error
+	if d.cause != nil {
+		errs = append(errs, d.cause)
+	}
+	if d.kind != nil {
+		errs = append(errs, d.kind)
+	}
+	return errs
+}
+
+// FormatPosition writes a position as file:line:column. Programs read from
+// no file are called "<input>".
+func FormatPosition(pos token.Position) string {
+	filename := "<input>"
+	if pos.Filename != "" {
+		filename = pos.Filename
+	}
+	return fmt.Sprintf("%s:%d:%d", filename, pos.Line, pos.Column)
+}
+
+// List returns the diagnostics found in err, which may join several
+// errors, in order. Errors that aren't diagnostics are left out.
+func List(err error) []Diagnostic {
+	var d Diagnostic
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case Diagnostic:
+		return []Diagnostic{e}
+	case interface{ As(any) bool }:
+		if e.As(&d) {
+			return []Diagnostic{d}
+		}
+	case interface{ Unwrap() []error }:
+		var list []Diagnostic
+		for _, e := range e.Unwrap() {
+			list = append(list, List(e)...)
+		}
+		return list
+	}
+	if errors.As(err, &d) {
+		return []Diagnostic{d}
+	}
+	return nil
+}
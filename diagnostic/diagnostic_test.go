@@ -0,0 +1,48 @@
+package diagnostic
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Toolnado/sludge/token"
+)
+
+func TestTokenSpan(t *testing.T) {
+	start := token.Position{Offset: 4, Line: 1, Column: 5}
+	span := TokenSpan(token.New(start, token.IDENTIFIER, "größe", nil))
+	if span.End.Column != 10 || span.End.Offset != 11 {
+		t.Errorf("got end %+v, expected column 10 and offset 11", span.End)
+	}
+	if !TokenSpan(token.New(start, token.STRING, "text", "text")).IsPoint() {
+		t.Error("expected the span of a string to be a point")
+	}
+}
+
+func TestKinds(t *testing.T) {
+	err := fmt.Errorf("calling f: %w", Errorf(ErrDivisionByZero, "division by zero"))
+	d := FromError(err, At(token.Position{Line: 2, Column: 3}), ErrRuntime)
+	if d.Code != ErrDivisionByZero.Code || d.Message != "calling f: division by zero" {
+		t.Errorf("got code %s and message %q", d.Code, d.Message)
+	}
+	if !errors.Is(d, ErrDivisionByZero) || errors.Is(d, ErrRuntime) {
+		t.Error("expected the diagnostic to be a division by zero only")
+	}
+	if d.Error() != "calling f: division by zero\n<input>:2:3" {
+		t.Errorf("got error %q", d.Error())
+	}
+
+	d = FromError(errors.New("boom"), Span{}, ErrRuntime)
+	if d.Kind() != ErrRuntime {
+		t.Errorf("got kind %v, expected the fallback", d.Kind())
+	}
+}
+
+func TestList(t *testing.T) {
+	first := New(ErrSyntax, "first", Span{})
+	second := New(ErrUndefinedVariable, "second", Span{})
+	list := List(errors.Join(first, errors.New("not a diagnostic"), second))
+	if len(list) != 2 || list[0].Message != "first" || list[1].Message != "second" {
+		t.Errorf("got %v, expected the two diagnostics in order", list)
+	}
+}
@@ -0,0 +1,83 @@
+package diagnostic
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind is a kind of problem, identified by a stable code. Kinds are
+// sentinel errors: errors.Is(err, ErrDivisionByZero) reports whether err
+// is a division by zero, whichever package reported it.
+type Kind struct {
+	Code    string
+	Summary string
+}
+
+func (k *Kind) Error() string {
+	return k.Summary
+}
+
+// Lexical errors.
+var (
+	ErrInvalidToken = &Kind{"E0101", "invalid token"}
+	ErrUnterminated = &Kind{"E0102", "unterminated literal"}
+)
+
+// Syntax errors.
+var (
+	ErrSyntax = &Kind{"E0201", "syntax error"}
+)
+
+// Errors found before running a program, by the resolver and the compiler.
+// Redeclarations and assignments to constants are also reported at runtime
+// in programs that the resolver didn't check.
+var (
+	ErrInvalidUse = &Kind{"E0301", "invalid use of a name or statement"}
+	ErrRedeclared = &Kind{"E0302", "name already declared"}
+	ErrConstant   = &Kind{"E0303", "assignment to a constant"}
+	ErrLimit      = &Kind{"E0304", "compiler limit exceeded"}
+)
+
+// Runtime errors. ErrUndefinedVariable is also reported by the resolver.
+var (
+	ErrRuntime           = &Kind{"E0401", "runtime error"}
+	ErrUndefinedVariable = &Kind{"E0402", "undefined variable"}
+	ErrUndefinedProperty = &Kind{"E0403", "undefined property"}
+	ErrDivisionByZero    = &Kind{"E0404", "division by zero"}
+	ErrType              = &Kind{"E0405", "operand of the wrong type"}
+	ErrIndexOutOfRange   = &Kind{"E0406", "index out of range"}
+	ErrNotCallable       = &Kind{"E0407", "value is not callable"}
+	ErrArity             = &Kind{"E0408", "wrong number of arguments"}
+	ErrStackOverflow     = &Kind{"E0409", "stack overflow"}
+	ErrUncaught          = &Kind{"E0410", "uncaught throw"}
+	ErrImport            = &Kind{"E0411", "module can't be imported"}
+)
+
+// kindError is an error of a kind whose message is its own.
+type kindError struct {
+	kind    *Kind
+	message string
+}
+
+// Errorf returns an error of kind with a message formatted as fmt.Sprintf
+// does. Diagnostics made from it by FromError get its kind.
+func Errorf(kind *Kind, format string, args ...any) error {
+	return kindError{kind: kind, message: fmt.Sprintf(format, args...)}
+}
+
+func (k kindError) Error() string {
+	return k.message
+}
+
+func (k kindError) Unwrap() error {
+	return k.kind
+}
+
+// KindOf returns the kind of err, or nil if it has none.
+func KindOf(err error) *Kind {
+	var kind *Kind
+	if errors.As(err, &kind) {
+		return kind
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package diagnostic
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Toolnado/sludge/token"
+)
+
+// FileSet holds the source text of the files diagnostics point into, by
+// the filename of their positions. Programs read from no file have an
+// empty filename. Files it doesn't hold are read with its loader, if any.
+type FileSet struct {
+	lines  map[string][]string
+	loader func(filename string) ([]byte, error)
+}
+
+// NewFileSet returns an empty file set that reads files with loader, which
+// may be nil.
+func NewFileSet(loader func(filename string) ([]byte, error)) *FileSet {
+	return &FileSet{
+		lines:  map[string][]string{},
+		loader: loader,
+	}
+}
+
+// Source returns a file set holding only source, the text of filename.
+func Source(filename string, source []byte) *FileSet {
+	files := NewFileSet(nil)
+	files.Add(filename, source)
+	return files
+}
+
+// Add records source as the text of filename.
+func (s *FileSet) Add(filename string, source []byte) {
+	lines := strings.Split(string(source), "\n")
+	for indx, line := range lines {
+		lines[indx] = strings.TrimSuffix(line, "\r")
+	}
+	s.lines[filename] = lines
+}
+
+// line returns the text of the line with number n of filename, loading the
+// file on first use.
+func (s *FileSet) line(filename string, n int) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	lines, ok := s.lines[filename]
+	if !ok && s.loader != nil {
+		if source, err := s.loader(filename); err == nil {
+			s.Add(filename, source)
+			lines = s.lines[filename]
+		} else {
+			s.lines[filename] = nil // Don't try again
+		}
+	}
+	if n < 1 || n > len(lines) {
+		return "", false
+	}
+	return lines[n-1], true
+}
+
+// ANSI escape sequences of the colors of the parts of a diagnostic.
+const (
+	colorReset   = "\x1b[0m"
+	colorBold    = "\x1b[1m"
+	colorError   = "\x1b[1;31m"
+	colorWarning = "\x1b[1;33m"
+	colorGutter  = "\x1b[1;34m"
+)
+
+// Renderer writes diagnostics for people to read. Each shows the source
+// lines it is about, with its span underlined by carets and the spans of
+// its notes by dashes, labelled with their messages.
+//
+//	error[E0404]: division by zero
+//	 --> script.sludge:2:12
+//	  |
+//	2 |   return a / b;
+//	  |            ^
+//	...
+//	5 | print div(1, 0);
+//	  |               - div called
+type Renderer struct {
+	files *FileSet
+	color bool
+}
+
+// RendererOption configures a Renderer.
+type RendererOption func(*Renderer)
+
+// WithColor makes the renderer color its output with ANSI escape
+// sequences, for terminals.
+func WithColor(color bool) RendererOption {
+	return func(r *Renderer) {
+		r.color = color
+	}
+}
+
+// NewRenderer returns a renderer that shows the source lines of files. With
+// no files, it shows the positions of diagnostics only.
+func NewRenderer(files *FileSet, options ...RendererOption) *Renderer {
+	r := &Renderer{files: files}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// Render writes every diagnostic found in err, which may join several of
+// them, separated by blank lines. An error without diagnostics is written
+// as its text.
+func (r *Renderer) Render(w io.Writer, err error) error {
+	list := List(err)
+	if len(list) == 0 {
+		_, err := fmt.Fprintln(w, err)
+		return err
+	}
+	bw := bufio.NewWriter(w)
+	for indx, d := range list {
+		if indx > 0 {
+			bw.WriteString("\n")
+		}
+		r.render(bw, d)
+	}
+	return bw.Flush()
+}
+
+// RenderDiagnostic writes d.
+func (r *Renderer) RenderDiagnostic(w io.Writer, d Diagnostic) error {
+	bw := bufio.NewWriter(w)
+	r.render(bw, d)
+	return bw.Flush()
+}
+
+// label is a span shown under a source line, with the message of a note.
+type label struct {
+	span    Span
+	message string
+	primary bool
+}
+
+func (r *Renderer) render(w *bufio.Writer, d Diagnostic) {
+	severity := colorError
+	if d.Severity == SeverityWarning {
+		severity = colorWarning
+	}
+	r.paint(w, severity, d.Severity.String())
+	if d.Code != "" {
+		r.paint(w, severity, "["+d.Code+"]")
+	}
+	r.paint(w, colorBold, ": "+d.Message)
+	w.WriteString("\n")
+
+	// Labels are shown by file, the file of the diagnostic first. Notes
+	// about lines that can't be shown are written at the end, like notes
+	// without a span.
+	labels := []label{{span: d.Span, primary: true}}
+	var trailing []Note
+	for _, note := range d.Notes {
+		if note.Span.Start.Line > 0 {
+			labels = append(labels, label{span: note.Span, message: note.Message})
+		} else {
+			trailing = append(trailing, note)
+		}
+	}
+	var files []string
+	byFile := map[string][]label{}
+	width := 0
+	for _, l := range labels {
+		pos := l.span.Start
+		if _, ok := r.files.line(pos.Filename, pos.Line); !ok {
+			if l.primary {
+				r.arrow(w, "-->", pos, len(strconv.Itoa(pos.Line)))
+			} else {
+				trailing = append(trailing, Note{Message: l.message, Span: l.span})
+			}
+			continue
+		}
+		if _, ok := byFile[pos.Filename]; !ok {
+			files = append(files, pos.Filename)
+		}
+		byFile[pos.Filename] = append(byFile[pos.Filename], l)
+		width = max(width, len(strconv.Itoa(pos.Line)))
+	}
+
+	for indx, filename := range files {
+		r.snippet(w, byFile[filename], indx == 0 && byFile[filename][0].primary, width)
+	}
+	for _, note := range trailing {
+		r.paint(w, colorGutter, strings.Repeat(" ", width+1)+"= ")
+		r.paint(w, colorBold, "note")
+		w.WriteString(": " + note.Message)
+		if note.Span.Start.Line > 0 {
+			w.WriteString(" at " + FormatPosition(note.Span.Start))
+		}
+		w.WriteString("\n")
+	}
+}
+
+// snippet writes the source lines of labels, which are all in the same
+// file, with the labels under them. The file is introduced with an arrow
+// for the diagnostic itself, or with ":::" for notes only.
+func (r *Renderer) snippet(w *bufio.Writer, labels []label, primary bool, width int) {
+	arrow, pos := "-->", labels[0].span.Start
+	sort.SliceStable(labels, func(i, j int) bool {
+		a, b := labels[i].span.Start, labels[j].span.Start
+		return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+	})
+	if !primary {
+		arrow, pos = ":::", labels[0].span.Start
+	}
+	r.arrow(w, arrow, pos, width)
+	r.gutter(w, "", width)
+	w.WriteString("\n")
+
+	previous := 0
+	for _, l := range labels {
+		pos := l.span.Start
+		if pos.Line != previous {
+			if previous > 0 && pos.Line > previous+1 {
+				r.paint(w, colorGutter, "...")
+				w.WriteString("\n")
+			}
+			text, _ := r.files.line(pos.Filename, pos.Line)
+			r.gutter(w, strconv.Itoa(pos.Line), width)
+			if text != "" {
+				w.WriteString(" " + text)
+			}
+			w.WriteString("\n")
+			previous = pos.Line
+		}
+		r.underline(w, l, width)
+	}
+}
+
+// underline writes the row of carets or dashes under the span of l, and
+// the message of l after them.
+func (r *Renderer) underline(w *bufio.Writer, l label, width int) {
+	pos := l.span.Start
+	text, _ := r.files.line(pos.Filename, pos.Line)
+	length := 1
+	if l.span.End.Line == pos.Line && l.span.End.Column > pos.Column {
+		length = l.span.End.Column - pos.Column
+	} else if l.span.End.Line > pos.Line {
+		length = max(1, utf8.RuneCountInString(text)-pos.Column+1)
+	}
+
+	// The padding keeps the tabs of the line, so that the marks line up
+	// with the text above them however tabs are shown.
+	padding := &strings.Builder{}
+	column := 1
+	for _, ch := range text {
+		if column >= pos.Column {
+			break
+		}
+		if ch == '\t' {
+			padding.WriteRune('\t')
+		} else {
+			padding.WriteRune(' ')
+		}
+		column++
+	}
+	padding.WriteString(strings.Repeat(" ", max(0, pos.Column-column)))
+
+	r.gutter(w, "", width)
+	w.WriteString(" " + padding.String())
+	mark, color := "-", colorGutter
+	if l.primary {
+		mark, color = "^", colorError
+	}
+	r.paint(w, color, strings.Repeat(mark, length))
+	if l.message != "" {
+		w.WriteString(" ")
+		r.paint(w, color, l.message)
+	}
+	w.WriteString("\n")
+}
+
+// arrow writes the line pointing at the position a snippet is about.
+func (r *Renderer) arrow(w *bufio.Writer, arrow string, pos token.Position, width int) {
+	w.WriteString(strings.Repeat(" ", width))
+	r.paint(w, colorGutter, arrow)
+	w.WriteString(" " + FormatPosition(pos) + "\n")
+}
+
+// gutter writes the column of line numbers, with number right-aligned.
+func (r *Renderer) gutter(w *bufio.Writer, number string, width int) {
+	r.paint(w, colorGutter, fmt.Sprintf("%*s |", width, number))
+}
+
+// paint writes text in color if the renderer colors its output.
+func (r *Renderer) paint(w *bufio.Writer, color, text string) {
+	if r.color {
+		w.WriteString(color + text + colorReset)
+		return
+	}
+	w.WriteString(text)
+}
@@ -0,0 +1,99 @@
+package diagnostic
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/token"
+)
+
+func TestRender(t *testing.T) {
+	source := "let total = 1;\n\n\tlet total = 2;\n"
+	first := token.Position{Filename: "main.sl", Offset: 4, Line: 1, Column: 5}
+	second := token.Position{Filename: "main.sl", Offset: 21, Line: 3, Column: 6}
+	redeclared := New(ErrRedeclared, "'total' is already declared in this scope", TokenSpan(token.New(second, token.IDENTIFIER, "total", nil))).
+		WithNote("first declared here", TokenSpan(token.New(first, token.IDENTIFIER, "total", nil))).
+		WithNote("rename one of them", Span{})
+	elsewhere := New(ErrImport, "module 'lib.sl' has syntax errors", At(token.Position{Filename: "lib.sl", Line: 2, Column: 1})).
+		WithNote("expect expression", At(token.Position{Filename: "main.sl", Line: 1, Column: 13}))
+
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name: "notes in the same file",
+			err:  redeclared,
+			expected: `error[E0302]: 'total' is already declared in this scope
+ --> main.sl:3:6
+  |
+1 | let total = 1;
+  |     ----- first declared here
+...
+3 | 	let total = 2;
+  | 	    ^^^^^
+  = note: rename one of them
+`,
+		},
+		{
+			name: "source not available",
+			err:  elsewhere,
+			expected: `error[E0411]: module 'lib.sl' has syntax errors
+ --> lib.sl:2:1
+ ::: main.sl:1:13
+  |
+1 | let total = 1;
+  |             - expect expression
+`,
+		},
+		{
+			name: "several diagnostics",
+			err:  errors.Join(New(ErrSyntax, "first", At(first)), errors.New("not a diagnostic"), New(ErrSyntax, "second", At(first))),
+			expected: `error[E0201]: first
+ --> main.sl:1:5
+  |
+1 | let total = 1;
+  |     ^
+
+error[E0201]: second
+ --> main.sl:1:5
+  |
+1 | let total = 1;
+  |     ^
+`,
+		},
+		{
+			name:     "no diagnostic",
+			err:      errors.New("boom"),
+			expected: "boom\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &strings.Builder{}
+			if err := NewRenderer(Source("main.sl", []byte(source))).Render(b, tt.err); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if b.String() != tt.expected {
+				t.Errorf("got\n%s\nexpected\n%s", b, tt.expected)
+			}
+		})
+	}
+}
+
+func TestRenderColor(t *testing.T) {
+	d := New(ErrSyntax, "expect expression", At(token.Position{Line: 1, Column: 9}))
+	b := &strings.Builder{}
+	if err := NewRenderer(Source("", []byte("let a = ;")), WithColor(true)).RenderDiagnostic(b, d); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(b.String(), colorError+"^"+colorReset) {
+		t.Errorf("got %q, expected a colored caret", b)
+	}
+	if !strings.Contains(b.String(), "<input>:1:9") {
+		t.Errorf("got %q, expected the position", b)
+	}
+}
@@ -1,46 +1,190 @@
 package environment
 
 import (
-	"fmt"
-
+	"github.com/Toolnado/sludge/diagnostic"
 	"github.com/Toolnado/sludge/token"
 )
 
+// slot holds one variable of a scope.
+type slot struct {
+	name     string
+	value    any
+	constant bool // Whether the variable was declared with "const"
+}
+
+// Environment is a scope of variables. Variables are kept in slots, in the
+// order they are declared, so that the interpreter can reach a variable
+// the resolver located by its depth and index without looking its name up.
+//
+// Scopes created by NewGlobal also index their slots by name. They are
+// meant for the outermost scopes of a program, such as globals and
+// modules, which grow beyond what the resolver of one program sees and are
+// searched by name.
 type Environment struct {
 	enclosing *Environment
-	values    map[string]any
+	slots     []slot
+	index     map[string]int // Slot of every name, in scopes created by NewGlobal
 }
 
 func New(enclosing *Environment) *Environment {
 	return &Environment{
 		enclosing: enclosing,
-		values:    make(map[string]any),
 	}
 }
 
+// NewSized creates a scope with room for size variables, such as the
+// parameters and hoisted variables of a function call.
+func NewSized(enclosing *Environment, size int) *Environment {
+	return &Environment{
+		enclosing: enclosing,
+		slots:     make([]slot, 0, size),
+	}
+}
+
+// NewGlobal creates a scope whose variables are looked up by name.
+func NewGlobal(enclosing *Environment) *Environment {
+	return &Environment{
+		enclosing: enclosing,
+		index:     make(map[string]int),
+	}
+}
+
+// find returns the slot of a name defined directly in this scope, or -1.
+func (e *Environment) find(name string) int {
+	if e.index != nil {
+		if indx, ok := e.index[name]; ok {
+			return indx
+		}
+		return -1
+	}
+	for indx := len(e.slots) - 1; indx >= 0; indx-- {
+		if e.slots[indx].name == name {
+			return indx
+		}
+	}
+	return -1
+}
+
+// add appends a new slot to this scope.
+func (e *Environment) add(s slot) {
+	if e.index != nil {
+		e.index[s.name] = len(e.slots)
+	}
+	e.slots = append(e.slots, s)
+}
+
+// Define binds name in this scope, replacing any previous binding. It is
+// meant for names the interpreter provides, such as parameters and natives;
+// declarations in programs use Declare.
 func (e *Environment) Define(name string, value any) {
-	e.values[name] = value
+	if indx := e.find(name); indx >= 0 {
+		e.slots[indx] = slot{name: name, value: value}
+		return
+	}
+	e.add(slot{name: name, value: value})
+}
+
+// Declare binds a name declared by a program in this scope. Unlike Define
+// it fails if the name is already declared in this scope.
+func (e *Environment) Declare(name token.Token, value any) error {
+	if e.find(name.Lexeme) >= 0 {
+		return diagnostic.Errorf(diagnostic.ErrRedeclared, "'%s' is already declared in this scope", name.Lexeme)
+	}
+	e.add(slot{name: name.Lexeme, value: value})
+	return nil
+}
+
+// DeclareConst declares a name like Declare whose value can't be assigned
+// afterwards.
+func (e *Environment) DeclareConst(name token.Token, value any) error {
+	if e.find(name.Lexeme) >= 0 {
+		return diagnostic.Errorf(diagnostic.ErrRedeclared, "'%s' is already declared in this scope", name.Lexeme)
+	}
+	e.add(slot{name: name.Lexeme, value: value, constant: true})
+	return nil
+}
+
+// Lookup returns the value of a name defined directly in this scope,
+// without consulting enclosing scopes.
+func (e *Environment) Lookup(name string) (any, bool) {
+	if indx := e.find(name); indx >= 0 {
+		return e.slots[indx].value, true
+	}
+	return nil, false
+}
+
+// Names returns the names defined directly in this scope, in the order of
+// their slots.
+func (e *Environment) Names() []string {
+	names := make([]string, len(e.slots))
+	for indx, s := range e.slots {
+		names[indx] = s.name
+	}
+	return names
+}
+
+// ancestor returns the scope distance levels out from this one.
+func (e *Environment) ancestor(distance int) *Environment {
+	env := e
+	for i := 0; i < distance; i++ {
+		env = env.enclosing
+	}
+	return env
+}
+
+// GetAt returns the value of a variable of the scope distance levels out
+// from this one, as located by the resolver. Index is the slot of the
+// variable in that scope, or -1 to find it by name.
+func (e *Environment) GetAt(distance, index int, name token.Token) (any, error) {
+	env := e.ancestor(distance)
+	if index < 0 {
+		index = env.find(name.Lexeme)
+	}
+	// A slot that doesn't exist yet belongs to a declaration that hasn't
+	// run, such as a let read by a closure before its declaration.
+	if index < 0 || index >= len(env.slots) {
+		return nil, diagnostic.Errorf(diagnostic.ErrUndefinedVariable, "undefined variable '%s'", name.Lexeme)
+	}
+	return env.slots[index].value, nil
+}
+
+// AssignAt assigns a variable of the scope distance levels out from this
+// one, located like in GetAt.
+func (e *Environment) AssignAt(distance, index int, name token.Token, value any) (any, error) {
+	env := e.ancestor(distance)
+	if index < 0 {
+		index = env.find(name.Lexeme)
+	}
+	if index < 0 || index >= len(env.slots) {
+		return nil, diagnostic.Errorf(diagnostic.ErrUndefinedVariable, "undefined variable '%s'", name.Lexeme)
+	}
+	return nil, env.assign(index, value)
+}
+
+func (e *Environment) assign(index int, value any) error {
+	if e.slots[index].constant {
+		return diagnostic.Errorf(diagnostic.ErrConstant, "can't assign to constant '%s'", e.slots[index].name)
+	}
+	e.slots[index].value = value
+	return nil
 }
 
 func (e *Environment) Get(name token.Token) (any, error) {
-	value, ok := e.values[name.Lexeme]
-	if ok {
-		return value, nil
+	if indx := e.find(name.Lexeme); indx >= 0 {
+		return e.slots[indx].value, nil
 	}
 	if e.enclosing != nil {
 		return e.enclosing.Get(name)
 	}
-	return nil, fmt.Errorf("undefined variable '%s'", name.Lexeme)
+	return nil, diagnostic.Errorf(diagnostic.ErrUndefinedVariable, "undefined variable '%s'", name.Lexeme)
 }
 
 func (e *Environment) Assign(name token.Token, value any) (any, error) {
-	_, ok := e.values[name.Lexeme]
-	if ok {
-		e.values[name.Lexeme] = value
-		return nil, nil
+	if indx := e.find(name.Lexeme); indx >= 0 {
+		return nil, e.assign(indx, value)
 	}
 	if e.enclosing != nil {
 		return e.enclosing.Assign(name, value)
 	}
-	return nil, fmt.Errorf("undefined variable '%s'", name.Lexeme)
+	return nil, diagnostic.Errorf(diagnostic.ErrUndefinedVariable, "undefined variable '%s'", name.Lexeme)
 }
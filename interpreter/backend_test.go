@@ -0,0 +1,45 @@
+package interpreter_test
+
+import (
+	"io"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/closure"
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/optimizer"
+	"github.com/Toolnado/sludge/vm"
+)
+
+// The other backends share the test programs of the interpreter, so that
+// all of them are held to the same output and errors. So does the
+// interpreter running programs rewritten by the optimizer.
+func init() {
+	tree := interpreter.Backends["tree"]
+	interpreter.Backends["optimized"] = func(stmts []ast.Stmt, out io.Writer, loader interpreter.Loader) error {
+		return tree(optimizer.Optimize(stmts), out, loader)
+	}
+	interpreter.Backends["vm"] = func(stmts []ast.Stmt, out io.Writer, loader interpreter.Loader) error {
+		options := []vm.Option{vm.WithOutput(out)}
+		if loader != nil {
+			options = append(options, vm.WithLoader(loader))
+		}
+		v := vm.New(options...)
+		f, err := v.Compile(stmts)
+		if err != nil {
+			return err
+		}
+		return v.Run(f)
+	}
+	interpreter.Backends["closure"] = func(stmts []ast.Stmt, out io.Writer, loader interpreter.Loader) error {
+		options := []closure.Option{closure.WithOutput(out)}
+		if loader != nil {
+			options = append(options, closure.WithLoader(loader))
+		}
+		i := closure.New(options...)
+		p, err := i.Compile(stmts)
+		if err != nil {
+			return err
+		}
+		return i.Run(p)
+	}
+}
@@ -0,0 +1,116 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/token"
+)
+
+var (
+	thisToken  = token.New(token.Position{}, token.THIS, "this", nil)
+	superToken = token.New(token.Position{}, token.SUPER, "super", nil)
+)
+
+// Class is the runtime value of a class declaration. Calling a class
+// creates a new instance and runs its "init" method, if any.
+type Class struct {
+	name       string
+	superclass *Class
+	methods    map[string]Function
+}
+
+func NewClass(name string, superclass *Class, methods map[string]Function) *Class {
+	return &Class{
+		name:       name,
+		superclass: superclass,
+		methods:    methods,
+	}
+}
+
+// findMethod looks up a method on the class and then on its superclasses.
+func (c *Class) findMethod(name string) (Function, bool) {
+	if method, ok := c.methods[name]; ok {
+		return method, true
+	}
+	if c.superclass != nil {
+		return c.superclass.findMethod(name)
+	}
+	return Function{}, false
+}
+
+func (c *Class) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	instance := NewInstance(c)
+	if initializer, ok := c.findMethod("init"); ok {
+		if _, err := initializer.bind(instance).Call(interpreter, arguments); err != nil {
+			return nil, err
+		}
+	}
+	return instance, nil
+}
+
+func (c *Class) Arity() int {
+	if initializer, ok := c.findMethod("init"); ok {
+		return initializer.Arity()
+	}
+	return 0
+}
+
+func (c *Class) String() string {
+	return fmt.Sprintf("<class %s>", c.name)
+}
+
+// Instance is an object created by calling a class. Fields are created on
+// first assignment and printed in that order.
+type Instance struct {
+	class  *Class
+	names  []string
+	fields map[string]any
+}
+
+func NewInstance(class *Class) *Instance {
+	return &Instance{
+		class:  class,
+		fields: make(map[string]any),
+	}
+}
+
+// Get returns the field with the given name or, failing that, the method
+// of the same name bound to the instance.
+func (i *Instance) Get(name token.Token) (any, error) {
+	if value, ok := i.fields[name.Lexeme]; ok {
+		return value, nil
+	}
+	if method, ok := i.class.findMethod(name.Lexeme); ok {
+		return method.bind(i), nil
+	}
+	return nil, diagnostic.Errorf(diagnostic.ErrUndefinedProperty, "undefined property '%s'", name.Lexeme)
+}
+
+func (i *Instance) Set(name token.Token, value any) {
+	if _, ok := i.fields[name.Lexeme]; !ok {
+		i.names = append(i.names, name.Lexeme)
+	}
+	i.fields[name.Lexeme] = value
+}
+
+func (i *Instance) String() string {
+	b := &strings.Builder{}
+	b.WriteString(i.class.name)
+	b.WriteString(" {")
+	for indx, name := range i.names {
+		if indx != 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(" ")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(Repr(i.fields[name]))
+	}
+	if len(i.names) != 0 {
+		b.WriteString(" ")
+	}
+	b.WriteString("}")
+	return b.String()
+}
@@ -2,26 +2,156 @@ package interpreter
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/Toolnado/sludge/diagnostic"
 	"github.com/Toolnado/sludge/token"
 )
 
+// InterpreterError is a runtime error. It is the diagnostic of the position
+// it was raised at and, once traced, reports the calls that were running.
+// errors.As also finds the diagnostic itself in it.
 type InterpreterError struct {
-	pos     token.Position
-	message string
+	diagnostic.Diagnostic
+	Stack  []CallFrame // Calls running when the error was raised, outermost first
+	traced bool        // Whether the stack has been recorded
+	value  any         // Value of the throw statement that raised the error
+	thrown bool        // Whether a throw statement raised the error
 }
 
+// NewError returns a runtime error of no particular kind raised at pos.
 func NewError(message string, pos token.Position) InterpreterError {
 	return InterpreterError{
-		pos:     pos,
-		message: message,
+		Diagnostic: diagnostic.New(diagnostic.ErrRuntime, message, diagnostic.At(pos)),
 	}
 }
 
+// Error returns the message and position of the error, followed by a
+// traceback of the calls that were running, innermost first.
 func (t InterpreterError) Error() string {
-	filename := "<input>"
-	if t.pos.Filename != "" {
-		filename = t.pos.Filename
+	b := &strings.Builder{}
+	b.WriteString(t.Diagnostic.Error())
+	writeTraceback(b, t.Stack)
+	return b.String()
+}
+
+// As sets target to the diagnostic of the error if it is a
+// *diagnostic.Diagnostic. The calls of its traceback are added as notes.
+func (t InterpreterError) As(target any) bool {
+	if d, ok := target.(*diagnostic.Diagnostic); ok {
+		*d = t.Diagnostic
+		d.Notes = append(d.Notes[:len(d.Notes):len(d.Notes)], tracebackNotes(t.Stack)...)
+		return true
+	}
+	return false
+}
+
+// Wrap makes an error that isn't a runtime error one raised at pos, with
+// its text as the message and the kind it was made with. Runtime errors
+// keep the position they were raised at, however many expressions they
+// leave.
+func Wrap(err error, pos token.Position) error {
+	if _, ok := err.(InterpreterError); ok {
+		return err
+	}
+	return InterpreterError{
+		Diagnostic: diagnostic.FromError(err, diagnostic.At(pos), diagnostic.ErrRuntime),
+	}
+}
+
+// Throw returns the error a throw statement at pos raises with value.
+// Uncaught, it reports the value, or the message of an error it rethrows.
+func Throw(value any, pos token.Position) error {
+	message := fmt.Sprintf("uncaught %s", Repr(value))
+	if r, ok := value.(*RecordValue); ok && r.record == errorRecord {
+		message = Stringify(r.values[0])
+	}
+	e := InterpreterError{
+		Diagnostic: diagnostic.New(diagnostic.ErrUncaught, message, diagnostic.At(pos)),
+	}
+	e.value, e.thrown = value, true
+	return e
+}
+
+// Trace records stack, the calls running when err was raised, outermost
+// first, in a runtime error that has none yet. It is called as the error
+// leaves a call, or is caught, with the calls running at that point.
+func Trace(err error, stack []CallFrame) error {
+	e, ok := err.(InterpreterError)
+	if !ok || e.traced {
+		return err
+	}
+	e.Stack, e.traced = append([]CallFrame(nil), stack...), true
+	return e
+}
+
+// errorRecord is the record of the values that catch clauses receive for
+// runtime errors not raised by a throw statement.
+var errorRecord = NewRecord("Error", []string{"message", "position", "stack"})
+
+// Caught returns the value a catch clause receives for err: the value
+// thrown, or else an Error record with the message and position of the
+// runtime error and the calls running, innermost first. It reports false
+// for errors that aren't runtime errors, which can't be caught.
+func Caught(err error) (any, bool) {
+	e, ok := err.(InterpreterError)
+	if !ok {
+		return nil, false
 	}
-	return fmt.Sprintf("%s\n%s:%d:%d", t.message, filename, t.pos.Line, t.pos.Column)
+	if e.thrown {
+		return e.value, true
+	}
+	stack := make([]any, len(e.Stack))
+	for indx, frame := range e.Stack {
+		stack[len(stack)-1-indx] = frame.String()
+	}
+	return &RecordValue{
+		record: errorRecord,
+		values: []any{e.Message, diagnostic.FormatPosition(e.Span.Start), NewList(stack)},
+	}, true
+}
+
+// returnSignal unwinds the interpreter from a return statement, through any
+// enclosing blocks and loops, back to the function call being executed.
+type returnSignal struct {
+	keyword token.Token
+	value   any
+}
+
+func (r returnSignal) Error() string {
+	return NewError("can't return from top-level code", r.keyword.Position).Error()
+}
+
+// tailCallSignal unwinds the interpreter from a return statement whose
+// value is a call of a function, like returnSignal. The function call being
+// executed then makes that call instead of returning.
+type tailCallSignal struct {
+	keyword  token.Token
+	function Function
+	args     []any
+	paren    token.Token // Closing parenthesis of the call
+}
+
+func (t tailCallSignal) Error() string {
+	return returnSignal{keyword: t.keyword}.Error()
+}
+
+// breakSignal unwinds the interpreter from a break statement to the
+// innermost enclosing loop, which then stops iterating.
+type breakSignal struct {
+	keyword token.Token
+}
+
+func (b breakSignal) Error() string {
+	return NewError("can't use 'break' outside of a loop", b.keyword.Position).Error()
+}
+
+// continueSignal unwinds the interpreter from a continue statement to the
+// innermost enclosing loop, which then starts its next iteration.
+type continueSignal struct {
+	keyword token.Token
+}
+
+func (c continueSignal) Error() string {
+	return NewError("can't use 'continue' outside of a loop", c.keyword.Position).Error()
 }
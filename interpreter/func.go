@@ -1,34 +1,95 @@
 package interpreter
 
 import (
+	"fmt"
+
 	"github.com/Toolnado/sludge/ast"
 	"github.com/Toolnado/sludge/environment"
+	"github.com/Toolnado/sludge/token"
 )
 
 type Callable interface {
-	Call(interpreter *Interpreter, arguments []any) any
+	Call(interpreter *Interpreter, arguments []any) (any, error)
 	Arity() int
 }
 
 type Function struct {
-	declaration ast.FunctionStmt
+	declaration   ast.FunctionStmt
+	closure       *environment.Environment // Scope the function was declared in
+	isInitializer bool                     // Whether the function is a class "init" method
+	vars          []*ast.VarStmt           // Var declarations hoisted to the top of the body
 }
 
-func NewFunction(declaration ast.FunctionStmt) Function {
+func NewFunction(declaration ast.FunctionStmt, closure *environment.Environment) Function {
 	return Function{
 		declaration: declaration,
+		closure:     closure,
+		vars:        ast.HoistedVars(declaration.Body),
+	}
+}
+
+// Call runs the function and then each function it calls in tail
+// position, in its place.
+func (f Function) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	for {
+		value, err := f.run(interpreter, arguments)
+		tail, ok := err.(tailCallSignal)
+		if !ok {
+			return value, err
+		}
+		interpreter.calls[len(interpreter.calls)-1] = newCallFrame(tail.function.declaration.Name, tail.paren)
+		f, arguments = tail.function, tail.args
 	}
 }
 
-func (f Function) Call(interpreter *Interpreter, arguments []any) any {
-	environment := environment.New(interpreter.globals)
+// run runs the body of the function once.
+func (f Function) run(interpreter *Interpreter, arguments []any) (any, error) {
+	environment := environment.NewSized(f.closure, len(f.declaration.Params)+len(f.vars))
 	for i := 0; i < len(f.declaration.Params); i++ {
 		environment.Define(f.declaration.Params[i].Lexeme, arguments[i])
 	}
-	interpreter.excecuteBlock(f.declaration.Body, environment)
-	return nil
+	interpreter.hoist(f.vars, environment)
+	// The try statements being run belong to the caller.
+	tries := interpreter.tries
+	interpreter.tries = 0
+	_, err := interpreter.excecuteBlock(f.declaration.Body, environment)
+	interpreter.tries = tries
+	if err != nil {
+		r, ok := err.(returnSignal)
+		if !ok {
+			return nil, err
+		}
+		if !f.isInitializer {
+			return r.value, nil
+		}
+	}
+	if f.isInitializer {
+		return f.closure.Get(thisToken)
+	}
+	return nil, nil
 }
 
 func (f Function) Arity() int {
 	return len(f.declaration.Params)
 }
+
+// bind returns a copy of the method whose closure defines "this" as the
+// given instance.
+func (f Function) bind(instance *Instance) Function {
+	environment := environment.New(f.closure)
+	environment.Define(thisToken.Lexeme, instance)
+	return Function{
+		declaration:   f.declaration,
+		closure:       environment,
+		isInitializer: f.isInitializer,
+		vars:          f.vars,
+	}
+}
+
+func (f Function) String() string {
+	// Anonymous functions carry the "function" or "=>" token instead of a name.
+	if f.declaration.Name.Type != token.IDENTIFIER {
+		return "<fn>"
+	}
+	return fmt.Sprintf("<fn %s>", f.declaration.Name.Lexeme)
+}
@@ -2,30 +2,121 @@ package interpreter
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/diagnostic"
 	"github.com/Toolnado/sludge/environment"
-	"github.com/Toolnado/sludge/syslib/time"
+	"github.com/Toolnado/sludge/resolver"
 	"github.com/Toolnado/sludge/token"
 )
 
 type Interpreter struct {
+	builtins    *environment.Environment // Natives, which programs may shadow
 	globals     *environment.Environment
 	environment *environment.Environment
+	out         io.Writer
+	loader      Loader                     // Reads the source of imported modules
+	modules     map[string]*Module         // Modules that have already run, by path
+	loading     []string                   // Paths of the modules currently running
+	locals      map[ast.Expr]resolver.Slot // Slots of resolved variables
+
+	calls        []CallFrame // Calls of functions written in Sludge that are running
+	maxCallDepth int         // How many of them may run at once
+	tailCalls    bool        // Whether calls in tail position replace the calling function
+	tries        int         // Try statements of the running function that a return can't leave early
 }
 
-func New() *Interpreter {
-	base := environment.New(nil)
-	i := &Interpreter{
-		globals:     base,
-		environment: base,
+// Option configures an Interpreter created by New.
+type Option func(*Interpreter)
+
+// WithLoader sets the loader used to read imported modules. By default
+// modules are read from disk relative to the working directory.
+func WithLoader(loader Loader) Option {
+	return func(i *Interpreter) {
+		i.loader = loader
+	}
+}
+
+// WithOutput sets the writer that print statements and template text are
+// written to. By default it is os.Stdout.
+func WithOutput(w io.Writer) Option {
+	return func(i *Interpreter) {
+		i.out = w
 	}
+}
 
-	i.globals.Define("clock", time.New())
+// WithMaxCallDepth sets how many calls of functions written in Sludge can
+// run at once. A call beyond that fails with a stack overflow instead of
+// exhausting the Go stack. By default it is DefaultMaxCallDepth, and it is
+// at most MaxRecursiveCallDepth.
+func WithMaxCallDepth(depth int) Option {
+	return func(i *Interpreter) {
+		i.maxCallDepth = min(depth, MaxRecursiveCallDepth)
+	}
+}
+
+// WithTailCalls sets whether a function that returns the result of
+// calling a function written in Sludge makes that call in its own place,
+// so that it runs in constant space. Turning it off keeps every call on
+// the call stack of errors. By default it is on.
+func WithTailCalls(enabled bool) Option {
+	return func(i *Interpreter) {
+		i.tailCalls = enabled
+	}
+}
+
+func New(options ...Option) *Interpreter {
+	builtins := Builtins()
+	globals := environment.NewGlobal(builtins)
+	i := &Interpreter{
+		builtins:     builtins,
+		globals:      globals,
+		environment:  globals,
+		out:          os.Stdout,
+		maxCallDepth: DefaultMaxCallDepth,
+		tailCalls:    true,
+		loader:       NewFileLoader("."),
+		modules:      make(map[string]*Module),
+		locals:       make(map[ast.Expr]resolver.Slot),
+	}
+	for _, option := range options {
+		option(i)
+	}
 	return i
 }
 
+// Define binds name to value in the global environment, so that the
+// programs interpreted afterwards can refer to it.
+func (i *Interpreter) Define(name string, value any) {
+	i.globals.Define(name, value)
+}
+
+// Resolve runs the resolver over a program before it is interpreted and
+// records the slots of its variables, so that they are read and assigned
+// directly in the scope that declares them. Names already defined in the
+// global environment are known to the resolver. Programs that aren't
+// resolved still run, looking every variable up by name.
+func (i *Interpreter) Resolve(stmts []ast.Stmt) error {
+	return i.resolve(stmts, append(i.builtins.Names(), i.globals.Names()...))
+}
+
+// resolve resolves stmts like Resolve, knowing the predefined names only.
+func (i *Interpreter) resolve(stmts []ast.Stmt, predefined []string) error {
+	r := resolver.New(predefined...)
+	if err := r.Resolve(stmts); err != nil {
+		return err
+	}
+	for expr, slot := range r.Slots() {
+		i.locals[expr] = slot
+	}
+	return nil
+}
+
 func (i *Interpreter) Interpret(stmts []ast.Stmt) (any, error) {
+	i.hoist(ast.HoistedVars(stmts), i.environment)
 	for _, stmt := range stmts {
 		_, err := i.execute(stmt)
 		if err != nil {
@@ -53,12 +144,22 @@ func (i *Interpreter) VisitWhileStmt(stmt *ast.WhileStmt) (any, error) {
 		if err != nil {
 			return nil, err
 		}
-		if !i.isTruthy(value) {
+		if !IsTruthy(value) {
 			break
 		}
 		_, err = i.execute(stmt.Body)
 		if err != nil {
-			return nil, err
+			if _, ok := err.(breakSignal); ok {
+				break
+			}
+			if _, ok := err.(continueSignal); !ok {
+				return nil, err
+			}
+		}
+		if stmt.Increment != nil {
+			if _, err := i.evaluate(stmt.Increment); err != nil {
+				return nil, err
+			}
 		}
 	}
 	return nil, nil
@@ -69,7 +170,20 @@ func (i *Interpreter) VisitPrintStmt(stmt *ast.PrintStmt) (any, error) {
 	if err != nil {
 		return nil, err
 	}
-	fmt.Println(value)
+	fmt.Fprintln(i.out, Stringify(value))
+	return nil, nil
+}
+
+// VisitEmitStmt writes template text to the output. Unlike print it adds
+// no newline, so text and values come out exactly as the template has them.
+func (i *Interpreter) VisitEmitStmt(stmt *ast.EmitStmt) (any, error) {
+	value, err := i.evaluate(stmt.Value)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := fmt.Fprint(i.out, Stringify(value)); err != nil {
+		return nil, err
+	}
 	return nil, nil
 }
 
@@ -96,34 +210,100 @@ func (i *Interpreter) excecuteBlock(stmts []ast.Stmt, env *environment.Environme
 func (i *Interpreter) VisitAssignExpr(expr *ast.AssignExpr) (any, error) {
 	value, err := i.evaluate(expr.Value)
 	if err != nil {
-		return nil, NewError(err.Error(), expr.Name.Position)
+		return nil, Wrap(err, expr.Name.Position)
 	}
-	_, err = i.environment.Assign(expr.Name, value)
-	if err != nil {
-		return nil, NewError(err.Error(), expr.Name.Position)
+	if err := i.assignVariable(expr.Name, expr, value); err != nil {
+		return nil, err
 	}
 	return nil, nil
 }
 
 func (i *Interpreter) VisitVariableExpr(expr *ast.VariableExpr) (any, error) {
-	return i.environment.Get(expr.Name)
+	return i.lookUpVariable(expr.Name, expr)
+}
+
+// lookUpVariable returns the value of the variable name used by expr. It
+// goes straight to the declaring scope if the resolver found it, and
+// searches the enclosing scopes by name otherwise.
+func (i *Interpreter) lookUpVariable(name token.Token, expr ast.Expr) (any, error) {
+	var (
+		value any
+		err   error
+	)
+	if slot, ok := i.locals[expr]; ok {
+		value, err = i.environment.GetAt(slot.Depth, slot.Index, name)
+	} else {
+		value, err = i.environment.Get(name)
+	}
+	if err != nil {
+		return nil, Wrap(err, name.Position)
+	}
+	return value, nil
+}
+
+// assignVariable assigns the variable name used by expr, like lookUpVariable
+// finds it.
+func (i *Interpreter) assignVariable(name token.Token, expr ast.Expr, value any) error {
+	var err error
+	if slot, ok := i.locals[expr]; ok {
+		_, err = i.environment.AssignAt(slot.Depth, slot.Index, name, value)
+	} else {
+		_, err = i.environment.Assign(name, value)
+	}
+	if err != nil {
+		return Wrap(err, name.Position)
+	}
+	return nil
 }
 
 func (i *Interpreter) VisitVarStmt(stmt *ast.VarStmt) (any, error) {
 	var value any
 	if stmt.Initializer != nil {
-		value, _ = i.evaluate(stmt.Initializer)
+		v, err := i.evaluate(stmt.Initializer)
+		if err != nil {
+			return nil, err
+		}
+		value = v
+	}
+	switch stmt.Keyword.Type {
+	case token.VAR:
+		// The variable was hoisted when its function started running, so
+		// only the initializer is left to assign.
+		if stmt.Initializer == nil {
+			return nil, nil
+		}
+		if err := i.assignVariable(stmt.Name, stmt, value); err != nil {
+			return nil, err
+		}
+	case token.CONST:
+		if err := i.environment.DeclareConst(stmt.Name, value); err != nil {
+			return nil, Wrap(err, stmt.Name.Position)
+		}
+	default:
+		if err := i.environment.Declare(stmt.Name, value); err != nil {
+			return nil, Wrap(err, stmt.Name.Position)
+		}
 	}
-	i.environment.Define(stmt.Name.Lexeme, value)
 	return nil, nil
 }
 
+// hoist defines the var declarations of a function body or program in the
+// environment it runs in. Variables that already exist, such as parameters
+// or globals of an earlier program, keep their value.
+func (i *Interpreter) hoist(vars []*ast.VarStmt, env *environment.Environment) {
+	for _, v := range vars {
+		if _, ok := env.Lookup(v.Name.Lexeme); !ok {
+			env.Define(v.Name.Lexeme, nil)
+		}
+	}
+}
+
 func (i *Interpreter) VisitIfStmt(stmt *ast.IfStmt) (any, error) {
 	condition, err := i.evaluate(stmt.Condition)
 	if err != nil {
 		return nil, err
 	}
-	if i.isTruthy(condition) {
+	if IsTruthy(condition) {
 		_, err = i.execute(stmt.ThenBranch)
 	} else if stmt.ElseBranch != nil {
 		_, err = i.execute(stmt.ElseBranch)
@@ -134,18 +314,18 @@ func (i *Interpreter) VisitIfStmt(stmt *ast.IfStmt) (any, error) {
 func (i *Interpreter) VisitUnaryExpr(expr *ast.UnaryExpr) (any, error) {
 	right, err := i.evaluate(expr.Right)
 	if err != nil {
-		return nil, NewError(err.Error(), expr.Operator.Position)
+		return nil, Wrap(err, expr.Operator.Position)
 	}
 
 	switch expr.Operator.Type {
 	case token.MINUS:
-		value, err := i.negate(right)
+		value, err := Negate(right)
 		if err != nil {
-			return nil, NewError(err.Error(), expr.Operator.Position)
+			return nil, Wrap(err, expr.Operator.Position)
 		}
 		return value, nil
 	case token.BANG:
-		return i.logicalNot(right), nil
+		return !IsTruthy(right), nil
 	default:
 		return nil, NewError("unsupported unary operator", expr.Operator.Position)
 	}
@@ -154,34 +334,34 @@ func (i *Interpreter) VisitUnaryExpr(expr *ast.UnaryExpr) (any, error) {
 func (i *Interpreter) VisitBinaryExpr(expr *ast.BinaryExpr) (any, error) {
 	left, err := i.evaluate(expr.Left)
 	if err != nil {
-		return nil, NewError(err.Error(), expr.Operator.Position)
+		return nil, Wrap(err, expr.Operator.Position)
 	}
 
 	right, err := i.evaluate(expr.Right)
 	if err != nil {
-		return nil, NewError(err.Error(), expr.Operator.Position)
+		return nil, Wrap(err, expr.Operator.Position)
 	}
 
 	switch expr.Operator.Type {
 	case token.PLUS:
-		value, err := i.add(left, right, expr.Operator)
+		value, err := Add(left, right)
 		if err != nil {
-			return nil, NewError(err.Error(), expr.Operator.Position)
+			return nil, Wrap(err, expr.Operator.Position)
 		}
 		return value, nil
 	case token.MINUS, token.STAR, token.SLASH, token.PERCENT:
-		value, err := i.performNumericOp(expr.Operator, left, right)
+		value, err := Arithmetic(expr.Operator.Type, left, right)
 		if err != nil {
-			return nil, NewError(err.Error(), expr.Operator.Position)
+			return nil, Wrap(err, expr.Operator.Position)
 		}
 		return value, nil
 
 	case token.EQUAL_EQUAL, token.BANG_EQUAL,
 		token.GREATER, token.GREATER_EQUAL,
 		token.LESS, token.LESS_EQUAL:
-		value, err := i.compareValues(expr.Operator, left, right)
+		value, err := Compare(expr.Operator.Type, left, right)
 		if err != nil {
-			return nil, NewError(err.Error(), expr.Operator.Position)
+			return nil, Wrap(err, expr.Operator.Position)
 		}
 		return value, nil
 
@@ -191,33 +371,62 @@ func (i *Interpreter) VisitBinaryExpr(expr *ast.BinaryExpr) (any, error) {
 }
 
 func (i *Interpreter) VisitCallExpr(expr *ast.CallExpr) (any, error) {
+	function, args, err := i.callee(expr)
+	if err != nil {
+		return nil, err
+	}
+	return i.call(function, args, expr.Paren)
+}
+
+// callee evaluates the callee and the arguments of a call, checking that
+// the callee can take them.
+func (i *Interpreter) callee(expr *ast.CallExpr) (Callable, []any, error) {
 	callee, err := i.evaluate(expr.Callee)
 	if err != nil {
-		return nil, NewError(err.Error(), expr.Paren.Position)
+		return nil, nil, Wrap(err, expr.Paren.Position)
 	}
 
 	args := make([]any, len(expr.Arguments))
 	for indx, item := range expr.Arguments {
 		result, err := i.evaluate(item)
 		if err != nil {
-			return nil, NewError(err.Error(), expr.Paren.Position)
+			return nil, nil, Wrap(err, expr.Paren.Position)
 		}
 		args[indx] = result
 	}
 
 	function, ok := callee.(Callable)
 	if !ok {
-		return nil, NewError("can only call functions and classes", expr.Paren.Position)
+		return nil, nil, Wrap(diagnostic.Errorf(diagnostic.ErrNotCallable, "can only call functions and classes"), expr.Paren.Position)
 	}
 
 	if len(args) != function.Arity() {
-		return nil, NewError(
-			fmt.Sprintf("expected %d arguments, but got %d", function.Arity(), len(args)),
+		return nil, nil, Wrap(
+			diagnostic.Errorf(diagnostic.ErrArity, "expected %d arguments, but got %d", function.Arity(), len(args)),
 			expr.Paren.Position,
 		)
 	}
+	return function, args, nil
+}
 
-	return function.Call(i, args), nil
+// call calls function with args, as the call whose closing parenthesis is
+// paren.
+func (i *Interpreter) call(function Callable, args []any, paren token.Token) (any, error) {
+	entered, err := i.enter(function, paren)
+	if err != nil {
+		return nil, err
+	}
+	value, err := function.Call(i, args)
+	if entered {
+		if err != nil {
+			err = Trace(err, i.calls)
+		}
+		i.leave()
+	}
+	if _, ok := function.(Native); ok && err != nil {
+		return nil, Wrap(err, paren.Position)
+	}
+	return value, err
 }
 
 func (i *Interpreter) VisitLogicalExpr(expr *ast.LogicalExpr) (any, error) {
@@ -227,11 +436,11 @@ func (i *Interpreter) VisitLogicalExpr(expr *ast.LogicalExpr) (any, error) {
 	}
 
 	if expr.Operator.Type == token.OR {
-		if i.isTruthy(left) {
+		if IsTruthy(left) {
 			return left, nil
 		}
 	} else {
-		if !i.isTruthy(left) {
+		if !IsTruthy(left) {
 			return left, nil
 		}
 	}
@@ -240,7 +449,446 @@ func (i *Interpreter) VisitLogicalExpr(expr *ast.LogicalExpr) (any, error) {
 }
 
 func (i *Interpreter) VisitFunctionStmt(stmt *ast.FunctionStmt) (any, error) {
-	fn := NewFunction(*stmt)
-	i.environment.Define(stmt.Name.Lexeme, fn)
+	fn := NewFunction(*stmt, i.environment)
+	if err := i.environment.Declare(stmt.Name, fn); err != nil {
+		return nil, Wrap(err, stmt.Name.Position)
+	}
+	return nil, nil
+}
+
+func (i *Interpreter) VisitFunctionExpr(expr *ast.FunctionExpr) (any, error) {
+	declaration := ast.NewFunctionStmt(expr.Keyword, expr.Params, expr.Body)
+	return NewFunction(*declaration, i.environment), nil
+}
+
+func (i *Interpreter) VisitReturnStmt(stmt *ast.ReturnStmt) (any, error) {
+	if call, ok := stmt.Value.(*ast.CallExpr); ok && i.tailCalls && i.tries == 0 {
+		function, args, err := i.callee(call)
+		if err != nil {
+			return nil, err
+		}
+		// The function being left calls a function written in Sludge in
+		// place of itself, so that recursion through calls in tail
+		// position doesn't nest.
+		if f, ok := function.(Function); ok {
+			return nil, tailCallSignal{keyword: stmt.Keyword, function: f, args: args, paren: call.Paren}
+		}
+		value, err := i.call(function, args, call.Paren)
+		if err != nil {
+			return nil, err
+		}
+		return nil, returnSignal{keyword: stmt.Keyword, value: value}
+	}
+
+	var value any
+	if stmt.Value != nil {
+		v, err := i.evaluate(stmt.Value)
+		if err != nil {
+			return nil, err
+		}
+		value = v
+	}
+	return nil, returnSignal{keyword: stmt.Keyword, value: value}
+}
+
+func (i *Interpreter) VisitThrowStmt(stmt *ast.ThrowStmt) (any, error) {
+	value, err := i.evaluate(stmt.Value)
+	if err != nil {
+		return nil, err
+	}
+	return nil, Throw(value, stmt.Keyword.Position)
+}
+
+// VisitTryStmt runs the body of a try statement, then the catch clause if
+// the body raised a runtime error, and the finally block however they end.
+// An error or a return, break or continue of the finally block replaces
+// how the others ended.
+func (i *Interpreter) VisitTryStmt(stmt *ast.TryStmt) (any, error) {
+	// A call in tail position would only run once the try statement is
+	// left, so the returns of the parts the statement still has to finish
+	// call as usual.
+	i.tries++
+	_, err := i.excecuteBlock(stmt.Body, environment.New(i.environment))
+	i.tries--
+
+	if err != nil && stmt.Name.Type == token.IDENTIFIER {
+		if value, ok := Caught(Trace(err, i.calls)); ok {
+			env := environment.New(i.environment)
+			env.Define(stmt.Name.Lexeme, value)
+			if stmt.Finally != nil {
+				i.tries++
+			}
+			_, err = i.excecuteBlock(stmt.Catch, env)
+			if stmt.Finally != nil {
+				i.tries--
+			}
+		}
+	}
+
+	if stmt.Finally != nil {
+		if _, ferr := i.excecuteBlock(stmt.Finally, environment.New(i.environment)); ferr != nil {
+			return nil, ferr
+		}
+	}
+	return nil, err
+}
+
+func (i *Interpreter) VisitBreakStmt(stmt *ast.BreakStmt) (any, error) {
+	return nil, breakSignal{keyword: stmt.Keyword}
+}
+
+func (i *Interpreter) VisitContinueStmt(stmt *ast.ContinueStmt) (any, error) {
+	return nil, continueSignal{keyword: stmt.Keyword}
+}
+
+func (i *Interpreter) VisitListExpr(expr *ast.ListExpr) (any, error) {
+	elements := make([]any, len(expr.Elements))
+	for indx, item := range expr.Elements {
+		value, err := i.evaluate(item)
+		if err != nil {
+			return nil, err
+		}
+		elements[indx] = value
+	}
+	return NewList(elements), nil
+}
+
+func (i *Interpreter) VisitIndexExpr(expr *ast.IndexExpr) (any, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	index, err := i.evaluate(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+	return i.getIndex(object, index, expr.Bracket)
+}
+
+// getIndex returns the element of a list, string or map at index.
+func (i *Interpreter) getIndex(object, index any, bracket token.Token) (any, error) {
+	value, err := GetIndex(object, index)
+	if err != nil {
+		return nil, Wrap(err, bracket.Position)
+	}
+	return value, nil
+}
+
+func (i *Interpreter) VisitSliceExpr(expr *ast.SliceExpr) (any, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	var start, end any
+	if expr.Start != nil {
+		if start, err = i.evaluate(expr.Start); err != nil {
+			return nil, err
+		}
+	}
+	if expr.End != nil {
+		if end, err = i.evaluate(expr.End); err != nil {
+			return nil, err
+		}
+	}
+
+	value, err := Slice(object, start, end)
+	if err != nil {
+		return nil, Wrap(err, expr.Bracket.Position)
+	}
+	return value, nil
+}
+
+func (i *Interpreter) VisitIndexSetExpr(expr *ast.IndexSetExpr) (any, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	index, err := i.evaluate(expr.Index)
+	if err != nil {
+		return nil, err
+	}
+	value, err := i.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.setIndex(object, index, value, expr.Bracket); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// setIndex stores value as the element of a list or map at index.
+func (i *Interpreter) setIndex(object, index, value any, bracket token.Token) error {
+	if err := SetIndex(object, index, value); err != nil {
+		return Wrap(err, bracket.Position)
+	}
+	return nil
+}
+
+func (i *Interpreter) VisitMapExpr(expr *ast.MapExpr) (any, error) {
+	m := NewMap()
+	for indx := range expr.Keys {
+		key, err := i.evaluate(expr.Keys[indx])
+		if err != nil {
+			return nil, err
+		}
+		value, err := i.evaluate(expr.Values[indx])
+		if err != nil {
+			return nil, err
+		}
+		if err := m.Set(key, value); err != nil {
+			return nil, Wrap(err, expr.Bracket.Position)
+		}
+	}
+	return m, nil
+}
+
+func (i *Interpreter) VisitGetExpr(expr *ast.GetExpr) (any, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	return i.getProperty(object, expr.Name)
+}
+
+// getProperty returns the property name of an instance, record, module or map.
+func (i *Interpreter) getProperty(object any, name token.Token) (any, error) {
+	value, err := GetProperty(object, name)
+	if err != nil {
+		return nil, Wrap(err, name.Position)
+	}
+	return value, nil
+}
+
+func (i *Interpreter) VisitSetExpr(expr *ast.SetExpr) (any, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.checkSetProperty(object, expr.Name); err != nil {
+		return nil, err
+	}
+	value, err := i.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+	SetProperty(object, expr.Name, value)
+	return value, nil
+}
+
+// checkSetProperty reports whether the property name of object can be
+// assigned, before the assigned value is evaluated.
+func (i *Interpreter) checkSetProperty(object any, name token.Token) error {
+	if err := CheckSetProperty(object, name); err != nil {
+		return Wrap(err, name.Position)
+	}
+	return nil
+}
+
+// VisitCompoundAssignExpr applies an operator such as "+=" to a variable,
+// element or property. The object and index of the target are evaluated
+// once, before the value on the right.
+func (i *Interpreter) VisitCompoundAssignExpr(expr *ast.CompoundAssignExpr) (any, error) {
+	var (
+		current any
+		store   func(value any) error
+		err     error
+	)
+	switch target := expr.Target.(type) {
+	case *ast.VariableExpr:
+		if current, err = i.lookUpVariable(target.Name, target); err != nil {
+			return nil, err
+		}
+		store = func(value any) error {
+			return i.assignVariable(target.Name, target, value)
+		}
+	case *ast.IndexExpr:
+		object, err := i.evaluate(target.Object)
+		if err != nil {
+			return nil, err
+		}
+		index, err := i.evaluate(target.Index)
+		if err != nil {
+			return nil, err
+		}
+		if current, err = i.getIndex(object, index, target.Bracket); err != nil {
+			return nil, err
+		}
+		store = func(value any) error {
+			return i.setIndex(object, index, value, target.Bracket)
+		}
+	case *ast.GetExpr:
+		object, err := i.evaluate(target.Object)
+		if err != nil {
+			return nil, err
+		}
+		if current, err = i.getProperty(object, target.Name); err != nil {
+			return nil, err
+		}
+		if err := i.checkSetProperty(object, target.Name); err != nil {
+			return nil, err
+		}
+		store = func(value any) error {
+			SetProperty(object, target.Name, value)
+			return nil
+		}
+	default:
+		return nil, NewError("invalid assignment target", expr.Operator.Position)
+	}
+
+	operand, err := i.evaluate(expr.Value)
+	if err != nil {
+		return nil, err
+	}
+	value, err := i.arithmetic(expr.Operator, current, operand)
+	if err != nil {
+		return nil, Wrap(err, expr.Operator.Position)
+	}
+	if err := store(value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (i *Interpreter) VisitWithExpr(expr *ast.WithExpr) (any, error) {
+	object, err := i.evaluate(expr.Object)
+	if err != nil {
+		return nil, err
+	}
+	record, ok := object.(*RecordValue)
+	if !ok {
+		return nil, Wrap(diagnostic.Errorf(diagnostic.ErrType, "can only use 'with' on records"), expr.Keyword.Position)
+	}
+
+	names := make([]string, len(expr.Names))
+	values := make([]any, len(expr.Values))
+	for indx, name := range expr.Names {
+		names[indx] = name.Lexeme
+		value, err := i.evaluate(expr.Values[indx])
+		if err != nil {
+			return nil, err
+		}
+		values[indx] = value
+	}
+
+	updated, err := record.With(names, values)
+	if err != nil {
+		return nil, Wrap(err, expr.Keyword.Position)
+	}
+	return updated, nil
+}
+
+func (i *Interpreter) VisitRecordStmt(stmt *ast.RecordStmt) (any, error) {
+	fields := make([]string, len(stmt.Fields))
+	for indx, field := range stmt.Fields {
+		fields[indx] = field.Lexeme
+	}
+	if err := i.environment.Declare(stmt.Name, NewRecord(stmt.Name.Lexeme, fields)); err != nil {
+		return nil, Wrap(err, stmt.Name.Position)
+	}
+	return nil, nil
+}
+
+func (i *Interpreter) VisitImportStmt(stmt *ast.ImportStmt) (any, error) {
+	module, err := i.importModule(stmt)
+	if err != nil {
+		return nil, err
+	}
+	if stmt.Alias.Type == token.IDENTIFIER {
+		if err := i.environment.Declare(stmt.Alias, module); err != nil {
+			return nil, Wrap(err, stmt.Alias.Position)
+		}
+	}
+	for _, name := range stmt.Names {
+		value, err := module.Get(name)
+		if err != nil {
+			return nil, Wrap(err, name.Position)
+		}
+		if err := i.environment.Declare(name, value); err != nil {
+			return nil, Wrap(err, name.Position)
+		}
+	}
 	return nil, nil
 }
+
+func (i *Interpreter) VisitThisExpr(expr *ast.ThisExpr) (any, error) {
+	value, err := i.lookUpVariable(expr.Keyword, expr)
+	if err != nil {
+		return nil, NewError("can't use 'this' outside of a class", expr.Keyword.Position)
+	}
+	return value, nil
+}
+
+func (i *Interpreter) VisitSuperExpr(expr *ast.SuperExpr) (any, error) {
+	value, err := i.lookUpVariable(expr.Keyword, expr)
+	if err != nil {
+		return nil, NewError("can't use 'super' in a class with no superclass", expr.Keyword.Position)
+	}
+	superclass := value.(*Class)
+	// "this" is the only variable of the scope just inside the one
+	// holding "super".
+	var this any
+	if slot, ok := i.locals[expr]; ok {
+		this, err = i.environment.GetAt(slot.Depth-1, 0, thisToken)
+	} else {
+		this, err = i.environment.Get(thisToken)
+	}
+	if err != nil {
+		return nil, Wrap(err, expr.Keyword.Position)
+	}
+	method, ok := superclass.findMethod(expr.Method.Lexeme)
+	if !ok {
+		return nil, Wrap(diagnostic.Errorf(diagnostic.ErrUndefinedProperty, "undefined property '%s'", expr.Method.Lexeme), expr.Method.Position)
+	}
+	return method.bind(this.(*Instance)), nil
+}
+
+func (i *Interpreter) VisitClassStmt(stmt *ast.ClassStmt) (any, error) {
+	var superclass *Class
+	if stmt.Superclass != nil {
+		value, err := i.evaluate(stmt.Superclass)
+		if err != nil {
+			return nil, err
+		}
+		class, ok := value.(*Class)
+		if !ok {
+			return nil, Wrap(diagnostic.Errorf(diagnostic.ErrType, "superclass must be a class"), stmt.Superclass.Name.Position)
+		}
+		superclass = class
+	}
+
+	if err := i.environment.Declare(stmt.Name, nil); err != nil {
+		return nil, Wrap(err, stmt.Name.Position)
+	}
+
+	closure := i.environment
+	if superclass != nil {
+		closure = environment.New(i.environment)
+		closure.Define(superToken.Lexeme, superclass)
+	}
+
+	methods := make(map[string]Function, len(stmt.Methods))
+	for _, method := range stmt.Methods {
+		fn := NewFunction(*method, closure)
+		fn.isInitializer = method.Name.Lexeme == "init"
+		methods[method.Name.Lexeme] = fn
+	}
+
+	class := NewClass(stmt.Name.Lexeme, superclass, methods)
+	if _, err := i.environment.Assign(stmt.Name, class); err != nil {
+		return nil, Wrap(err, stmt.Name.Position)
+	}
+	return nil, nil
+}
+
+func (i *Interpreter) VisitInterpolationExpr(expr *ast.InterpolationExpr) (any, error) {
+	b := &strings.Builder{}
+	for _, part := range expr.Parts {
+		value, err := i.evaluate(part)
+		if err != nil {
+			return nil, err
+		}
+		b.WriteString(Stringify(value))
+	}
+	return b.String(), nil
+}
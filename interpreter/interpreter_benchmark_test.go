@@ -0,0 +1,83 @@
+package interpreter
+
+import (
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+)
+
+// benchmarks are programs dominated by variable access: a tight loop over
+// locals and a recursive function.
+var benchmarks = []struct {
+	name   string
+	source string
+}{
+	{
+		name: "loop",
+		source: `
+			function sum(n) {
+				let total = 0;
+				for (let i = 0; i < n; i += 1) {
+					let square = i * i;
+					total += square % 7;
+				}
+				return total;
+			}
+			sum(100000);
+		`,
+	},
+	{
+		name: "recursion",
+		source: `
+			function fib(n) {
+				if (n < 2) {
+					return n;
+				}
+				return fib(n - 1) + fib(n - 2);
+			}
+			fib(20);
+		`,
+	},
+}
+
+// byName runs a program on the tree interpreter without resolving it, so
+// that every variable is looked up by name through the enclosing scopes.
+// It is the baseline the slots found by the resolver are measured against.
+func byName(stmts []ast.Stmt, out io.Writer, _ Loader) error {
+	_, err := New(WithOutput(out)).Interpret(stmts)
+	return err
+}
+
+func BenchmarkInterpret(b *testing.B) {
+	names := make([]string, 0, len(Backends))
+	for name := range Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = append(names, "tree-by-name")
+	for _, bm := range benchmarks {
+		l := lexer.New(strings.NewReader(bm.source))
+		stmts, err := parser.New(l.ScanTokens()).Parse()
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, name := range names {
+			backend := Backends[name]
+			if name == "tree-by-name" {
+				backend = byName
+			}
+			b.Run(bm.name+"/"+name, func(b *testing.B) {
+				for n := 0; n < b.N; n++ {
+					if err := backend(stmts, io.Discard, nil); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,980 @@
+package interpreter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+)
+
+// Backend runs a parsed program, writing its output to out and loading
+// imported modules with loader, if it isn't nil.
+type Backend func(stmts []ast.Stmt, out io.Writer, loader Loader) error
+
+// Backends are the backends the test programs run on, by name. They must
+// all give the same output and errors. External tests add the vm.
+var Backends = map[string]Backend{
+	"tree": func(stmts []ast.Stmt, out io.Writer, loader Loader) error {
+		i := New(WithOutput(out))
+		if loader != nil {
+			i.loader = loader
+		}
+		if err := i.Resolve(stmts); err != nil {
+			return err
+		}
+		_, err := i.Interpret(stmts)
+		return err
+	},
+}
+
+// run lexes and parses the input and runs it on backend, returning
+// everything written by print statements.
+func run(backend Backend, input string, loader Loader) (string, error) {
+	l := lexer.New(strings.NewReader(input))
+	p := parser.New(l.ScanTokens())
+	stmts, err := p.Parse()
+	if err != nil {
+		return "", err
+	}
+	out := &bytes.Buffer{}
+	err = backend(stmts, out, loader)
+	return out.String(), err
+}
+
+// forEachBackend runs a subtest per backend, in the order of their names.
+func forEachBackend(t *testing.T, test func(t *testing.T, backend Backend)) {
+	names := make([]string, 0, len(Backends))
+	for name := range Backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		backend := Backends[name]
+		t.Run(name, func(t *testing.T) {
+			test(t, backend)
+		})
+	}
+}
+
+func TestInterpret(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name: "return value",
+			input: `
+				function add(a, b) {
+					return a + b;
+				}
+				print add(1, 2);
+			`,
+			expected: "3\n",
+		},
+		{
+			name: "bare return",
+			input: `
+				function f() {
+					print 1;
+					return;
+					print 2;
+				}
+				print f();
+			`,
+			expected: "1\n<nil>\n",
+		},
+		{
+			name: "return from nested loop",
+			input: `
+				function find() {
+					for (var i = 0; i < 10; i = i + 1) {
+						while (true) {
+							if (i == 3) {
+								return i;
+							}
+							i = i + 1;
+						}
+					}
+				}
+				print find();
+			`,
+			expected: "3\n",
+		},
+		{
+			name: "recursion",
+			input: `
+				function fib(n) {
+					if (n < 2) {
+						return n;
+					}
+					return fib(n - 1) + fib(n - 2);
+				}
+				print fib(10);
+			`,
+			expected: "55\n",
+		},
+		{
+			name: "calls in tail position don't nest",
+			input: `
+				function even(n) {
+					if (n == 0) return true;
+					return odd(n - 1);
+				}
+				function odd(n) {
+					if (n == 0) return false;
+					return even(n - 1);
+				}
+				class Counter {
+					count(n, total) {
+						if (n == 0) return total;
+						return this.count(n - 1, total + 1);
+					}
+				}
+				function wrap(xs) {
+					return len(xs);
+				}
+				print even(100001);
+				print Counter().count(50000, 0);
+				print wrap([1, 2]);
+			`,
+			expected: "false\n50000\n2\n",
+		},
+		{
+			name: "runtime errors are caught as error values",
+			input: `
+				function div(a, b) {
+					return a / b;
+				}
+				function early() {
+					return later;
+				}
+				try {
+					div(1, 0);
+				} catch (e) {
+					print e.message;
+					print e.position;
+					print e.stack;
+				}
+				try {
+					early();
+				} catch (e) {
+					print e.message;
+				}
+				try {
+					div(1);
+				} catch (e) {
+					print e.message;
+				}
+				let later = 1;
+			`,
+			expected: "division by zero\n<input>:3:15\n[\"div called at <input>:9:14\"]\n" +
+				"undefined variable 'later'\nexpected 2 arguments, but got 1\n",
+		},
+		{
+			name: "thrown values are caught as they are",
+			input: `
+				function fail() {
+					throw ["code": 42];
+				}
+				try {
+					fail();
+					print "not reached";
+				} catch (e) {
+					print e["code"];
+				}
+			`,
+			expected: "42\n",
+		},
+		{
+			name: "finally runs however the statement ends",
+			input: `
+				function f() {
+					try {
+						return "returned";
+					} finally {
+						print "finally";
+					}
+				}
+				print f();
+				var i = 0;
+				while (i < 3) {
+					i = i + 1;
+					try {
+						if (i == 2) continue;
+						if (i == 3) break;
+						print i;
+					} finally {
+						print -i;
+					}
+				}
+				function g() {
+					try {
+						throw "lost";
+					} finally {
+						return "overridden";
+					}
+				}
+				print g();
+			`,
+			expected: "finally\nreturned\n1\n-1\n-2\n-3\noverridden\n",
+		},
+		{
+			name: "errors of catch clauses and rethrown errors",
+			input: `
+				try {
+					try {
+						throw 1;
+					} catch (e) {
+						throw e + 1;
+					} finally {
+						print "inner";
+					}
+				} catch (e) {
+					print e;
+				}
+				try {
+					try {
+						print 1 / 0;
+					} catch (e) {
+						throw e;
+					}
+				} catch (e) {
+					print e.message;
+				}
+			`,
+			expected: "inner\n2\ndivision by zero\n",
+		},
+		{
+			name: "catch clauses get a fresh scope",
+			input: `
+				let fs = [null, null];
+				var k = 0;
+				while (k < 2) {
+					try {
+						let v = k;
+						fs[k] = function() { return v; };
+						throw v * 10;
+					} catch (e) {
+						let w = e + 1;
+						print w;
+					}
+					k = k + 1;
+				}
+				print fs[0]() + fs[1]();
+			`,
+			expected: "1\n11\n1\n",
+		},
+		{
+			name: "break out of while",
+			input: `
+				var i = 0;
+				while (true) {
+					if (i == 3) {
+						break;
+					}
+					print i;
+					i = i + 1;
+				}
+			`,
+			expected: "0\n1\n2\n",
+		},
+		{
+			name: "continue runs for increment",
+			input: `
+				for (var i = 0; i < 5; i = i + 1) {
+					if (i % 2 == 0) {
+						continue;
+					}
+					print i;
+				}
+			`,
+			expected: "1\n3\n",
+		},
+		{
+			name: "break leaves only the inner loop",
+			input: `
+				for (var i = 0; i < 2; i = i + 1) {
+					for (var j = 0; j < 10; j = j + 1) {
+						if (j == 1) {
+							break;
+						}
+						print j;
+					}
+					print i;
+				}
+			`,
+			expected: "0\n0\n0\n1\n",
+		},
+		{
+			name: "closure counter",
+			input: `
+				function makeCounter() {
+					var count = 0;
+					function counter() {
+						count = count + 1;
+						return count;
+					}
+					return counter;
+				}
+				var a = makeCounter();
+				var b = makeCounter();
+				print a();
+				print a();
+				print b();
+			`,
+			expected: "1\n2\n1\n",
+		},
+		{
+			name: "nested function sees enclosing locals",
+			input: `
+				function outer(x) {
+					function inner(y) {
+						return x + y;
+					}
+					return inner(2);
+				}
+				print outer(1);
+			`,
+			expected: "3\n",
+		},
+		{
+			name: "function expression as initializer",
+			input: `
+				var square = function (x) {
+					return x * x;
+				};
+				print square(4);
+			`,
+			expected: "16\n",
+		},
+		{
+			name: "arrow lambdas as arguments",
+			input: `
+				function apply(f, a, b) {
+					return f(a, b);
+				}
+				print apply((a, b) => a + b, 1, 2);
+				print apply((a, b) => { return a * b; }, 3, 4);
+			`,
+			expected: "3\n12\n",
+		},
+		{
+			name: "returned arrow closes over parameter",
+			input: `
+				function adder(n) {
+					return x => x + n;
+				}
+				var add2 = adder(2);
+				print add2(5);
+				print (() => 7)();
+			`,
+			expected: "7\n7\n",
+		},
+		{
+			name: "printing functions",
+			input: `
+				function named() {}
+				print named;
+				print function () {};
+			`,
+			expected: "<fn named>\n<fn>\n",
+		},
+		{
+			name: "list literal and indexing",
+			input: `
+				var xs = [1, "two", [3]];
+				print xs;
+				print xs[0];
+				print xs[-1][0];
+				print [];
+			`,
+			expected: "[1, \"two\", [3]]\n1\n3\n[]\n",
+		},
+		{
+			name: "slicing lists and strings",
+			input: `
+				var xs = [1, 2, 3, 4];
+				print xs[1:3];
+				print xs[:2];
+				print xs[-2:];
+				print "hello"[1:-1];
+			`,
+			expected: "[2, 3]\n[1, 2]\n[3, 4]\nell\n",
+		},
+		{
+			name: "index assignment is shared",
+			input: `
+				var xs = [1, 2, 3];
+				var ys = xs;
+				ys[-1] = 30;
+				xs[0] = xs[1] = 20;
+				print xs;
+			`,
+			expected: "[20, 20, 30]\n",
+		},
+		{
+			name: "boolean and float literals",
+			input: `
+				if (false) print "then"; else print "else";
+				print !true;
+				print 1.5 * 2;
+			`,
+			expected: "else\nfalse\n3\n",
+		},
+		{
+			name: "map literal keeps insertion order",
+			input: `
+				var m = ["b": 1, "a": 2, 3: "three", true: false];
+				print m;
+				print keys(m);
+				print values(m);
+				print [:];
+			`,
+			expected: "[\"b\": 1, \"a\": 2, 3: \"three\", true: false]\n[\"b\", \"a\", 3, true]\n[1, 2, \"three\", false]\n[:]\n",
+		},
+		{
+			name: "map key access and assignment",
+			input: `
+				var m = ["host": "localhost"];
+				m["port"] = 8080;
+				m.debug = true;
+				m.host = "example.com";
+				print m.host;
+				print m["port"];
+				print m.missing;
+				print len(m);
+				print m;
+			`,
+			expected: "example.com\n8080\n<nil>\n3\n[\"host\": \"example.com\", \"port\": 8080, \"debug\": true]\n",
+		},
+		{
+			name: "numeric keys follow isEqual",
+			input: `
+				var m = [1: "one"];
+				m[1.0] = "uno";
+				print m[1];
+				print has(m, 1.0);
+				print delete(m, 1);
+				print m;
+			`,
+			expected: "uno\ntrue\ntrue\n[:]\n",
+		},
+		{
+			name: "float keys beyond the integers stay floats",
+			input: `
+				var m = [9223372036854775808.0: "big"];
+				print has(m, -9223372036854775807 - 1);
+				print m[9223372036854775808.0];
+			`,
+			expected: "false\nbig\n",
+		},
+		{
+			name: "integers beyond 2^53 are not rounded to floats",
+			input: `
+				print 9007199254740993 == 9007199254740992.0;
+				print 9007199254740992 == 9007199254740992.0;
+				var m = [9007199254740993: "int"];
+				m[9007199254740992.0] = "float";
+				print len(m);
+				print m[9007199254740993];
+			`,
+			expected: "false\ntrue\n2\nint\n",
+		},
+		{
+			name: "class with constructor, fields and methods",
+			input: `
+				class Point {
+					init(x, y) {
+						this.x = x;
+						this.y = y;
+					}
+					sum() {
+						return this.x + this.y;
+					}
+				}
+				var p = Point(1, 2);
+				print p.sum();
+				p.x = 10;
+				var sum = p.sum;
+				print sum();
+				print p;
+				print Point;
+			`,
+			expected: "3\n12\nPoint { x: 10, y: 2 }\n<class Point>\n",
+		},
+		{
+			name: "init returns the instance",
+			input: `
+				class Empty {
+					init() {
+						return;
+					}
+				}
+				var e = Empty();
+				print e.init() == e;
+				print e;
+			`,
+			expected: "true\nEmpty {}\n",
+		},
+		{
+			name: "inheritance and super calls",
+			input: `
+				class Animal {
+					init(name) {
+						this.name = name;
+					}
+					speak() {
+						return this.name + " makes a sound";
+					}
+				}
+				class Dog < Animal {
+					speak() {
+						return super.speak() + " (woof)";
+					}
+				}
+				print Dog("Rex").speak();
+			`,
+			expected: "Rex makes a sound (woof)\n",
+		},
+		{
+			name: "records with value semantics",
+			input: `
+				record Point(x, y);
+				var p = Point(1, 2);
+				var q = p with { x: 3 };
+				print p;
+				print q.x;
+				print q.y;
+				print p == Point(1, 2);
+				print p == q;
+				print q == p with { x: 3.0 };
+				print Point;
+			`,
+			expected: "Point(x: 1, y: 2)\n3\n2\ntrue\nfalse\ntrue\n<record Point>\n",
+		},
+		{
+			name: "records of different types are not equal",
+			input: `
+				record A(v);
+				record B(v);
+				print A(1) == B(1);
+				print A([1]) == A([1]);
+				print A("s") with { v: "t" };
+			`,
+			expected: "false\nfalse\nA(v: \"t\")\n",
+		},
+		{
+			name: "interpolation in all string forms",
+			input: `
+				var name = 'John \'No\'';
+				print "Hello ${name}!";
+				print 'Hi ${name}';
+				print ` + "`${1 + 2} and ${[1, 2]}`" + `;
+				print "${true}${null}";
+			`,
+			expected: "Hello John 'No'!\nHi John 'No'\n3 and [1, 2]\ntrue<nil>\n",
+		},
+		{
+			name: "interpolated expressions with braces and strings",
+			input: `
+				function first(m) {
+					return m["a"];
+				}
+				print ` + "`value: ${first([\"a\": \"}\"])}`" + `;
+				print "nested ${ 'inner ${ 1 + 1 }' }";
+				print "\${not} interpolated";
+			`,
+			expected: "value: }\nnested inner 2\n${not} interpolated\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, backend Backend) {
+				got, err := run(backend, tt.input, nil)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got != tt.expected {
+					t.Errorf("got output %q, expected %q", got, tt.expected)
+				}
+			})
+		})
+	}
+}
+
+func TestInterpretErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name: "error inside function body",
+			input: `
+				function f() {
+					return 1 / 0;
+				}
+				var x = f();
+			`,
+			wantErr: "division by zero",
+		},
+		{
+			name:    "index out of range",
+			input:   "var xs = [1, 2];\nprint xs[2];",
+			wantErr: "index 2 out of range for length 2\n<input>:2:9",
+		},
+		{
+			name:    "negative index out of range",
+			input:   "var xs = [1, 2];\nxs[-3] = 1;",
+			wantErr: "index -3 out of range for length 2\n<input>:2:3",
+		},
+		{
+			name:    "slice out of range",
+			input:   "print [1, 2][1:5];",
+			wantErr: "slice bounds [1:5] out of range for length 2",
+		},
+		{
+			name:    "invalid map key",
+			input:   "var m = [:];\nm[[1]] = 2;",
+			wantErr: "map keys must be strings, numbers or booleans\n<input>:2:2",
+		},
+		{
+			name:    "NaN map key",
+			input:   "let big = 1000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000000.0;\nlet inf = big * big * big * big;\nlet m = [:];\nm[inf - inf] = 1;",
+			wantErr: "map keys can't be NaN\n<input>:4:2",
+		},
+		{
+			name:    "native argument error",
+			input:   "len(1);",
+			wantErr: "len expects a string, list or map\n<input>:1:6",
+		},
+		{
+			name:    "undefined property",
+			input:   "class A {}\nA().missing;",
+			wantErr: "undefined property 'missing'\n<input>:2:5",
+		},
+		{
+			name:    "superclass must be a class",
+			input:   "var A = 1;\nclass B < A {}",
+			wantErr: "superclass must be a class\n<input>:2:11",
+		},
+		{
+			name:    "record fields are read-only",
+			input:   "record P(x);\nvar p = P(1);\np.x = 2;",
+			wantErr: "can't assign to field 'x' of record P\n<input>:3:3",
+		},
+		{
+			name:    "with on unknown field",
+			input:   "record P(x);\nP(1) with { y: 2 };",
+			wantErr: "undefined field 'y' on record P",
+		},
+		{
+			name:    "record constructor arity",
+			input:   "record P(x, y);\nP(1);",
+			wantErr: "expected 2 arguments, but got 1",
+		},
+		{
+			name:    "error inside interpolation keeps its position",
+			input:   "print \"a ${1 / 0} b\";",
+			wantErr: "division by zero\n<input>:1:14",
+		},
+		{
+			name:    "compound assignment type error points at operator",
+			input:   "var s = \"a\";\ns -= 1;",
+			wantErr: "left operand is not a number\n<input>:2:3",
+		},
+		{
+			name:    "compound assignment to record field",
+			input:   "record P(x);\nvar p = P(1);\np.x += 1;",
+			wantErr: "can't assign to field 'x' of record P\n<input>:3:3",
+		},
+		{
+			name:    "assignment to constant",
+			input:   "const c = 1;\nc = 2;",
+			wantErr: "can't assign to constant 'c'\n<input>:2:1",
+		},
+		{
+			name:    "compound assignment to constant",
+			input:   "const c = 1;\nfunction f() { c += 1; }",
+			wantErr: "can't assign to constant 'c'\n<input>:2:16",
+		},
+		{
+			name:    "redeclaration in the same scope",
+			input:   "let a = 1;\nconst a = 2;",
+			wantErr: "'a' is already declared in this scope\n<input>:2:7",
+		},
+		{
+			name:    "var redeclared in the same function",
+			input:   "function f(a) {\n  if (true) { var a = 1; }\n}",
+			wantErr: "'a' is already declared in this scope\n<input>:2:19",
+		},
+		{
+			name:    "let redeclaring a var in the same function",
+			input:   "function f() {\n  if (true) { var a = 1; }\n  let a = 2;\n}",
+			wantErr: "'a' is already declared in this scope\n<input>:3:7",
+		},
+		{
+			name:    "var captured by an enclosing let",
+			input:   "{\n  let a = 1;\n  { var a = 2; }\n}",
+			wantErr: "'a' is already declared in an enclosing block\n<input>:3:9",
+		},
+		{
+			name:    "compound assignment to undefined variable",
+			input:   "missing += 1;",
+			wantErr: "undefined variable 'missing'",
+		},
+		{
+			name:    "block local read before its declaration",
+			input:   "{\n  let a = 1;\n}\n{\n  print b;\n  let b = 2;\n}",
+			wantErr: "undefined variable 'b'\n<input>:5:9",
+		},
+		{
+			name:    "function local assigned before its declaration",
+			input:   "function f() {\n  c = 1;\n  let c = 2;\n}\nf();",
+			wantErr: "undefined variable 'c'\n<input>:2:3",
+		},
+		{
+			name:    "captured local read before its declaration",
+			input:   "{\n  function f() { return d; }\n  f();\n  let d = 1;\n}",
+			wantErr: "undefined variable 'd'\n<input>:2:25",
+		},
+		{
+			name:    "uncaught throw",
+			input:   "function f() {\n  throw \"oops\";\n}\nf();",
+			wantErr: "uncaught \"oops\"\n<input>:2:3",
+		},
+		{
+			name:    "rethrown error keeps its message",
+			input:   "try {\n  1 / 0;\n} catch (e) {\n  throw e;\n}",
+			wantErr: "division by zero\n<input>:4:3",
+		},
+		{
+			name:    "error of a finally block replaces the error",
+			input:   "try {\n  throw 1;\n} finally {\n  missing += 1;\n}",
+			wantErr: "undefined variable 'missing'\n<input>:4:3",
+		},
+		{
+			name:    "runaway recursion",
+			input:   "function f() {\n  f();\n}\nf();",
+			wantErr: "stack overflow: more than 10000 nested calls\n<input>:2:5\n  f called at <input>:2:5 (9999 times)\n  f called at <input>:4:3",
+		},
+		{
+			name:    "runaway recursion through initializers",
+			input:   "class A {\n  init() { A(); }\n}\nA();",
+			wantErr: "stack overflow: more than 10000 nested calls\n<input>:2:14\n  init called at <input>:2:14 (9999 times)\n  init called at <input>:4:3",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, backend Backend) {
+				_, err := run(backend, tt.input, nil)
+				if err == nil {
+					t.Fatalf("expected error %q but got none", tt.wantErr)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("got error %q, expected it to contain %q", err, tt.wantErr)
+				}
+			})
+		})
+	}
+}
+
+func TestTraceback(t *testing.T) {
+	input := "function div(a, b) {\n  return a / b;\n}\nfunction half(n) {\n  return 1 + div(n, 0) * 2;\n}\nprint half(1);"
+	// The error is reported where the division failed, not at the
+	// operators and calls it left on its way out.
+	wantErr := "division by zero\n<input>:2:12\n  div called at <input>:5:22\n  half called at <input>:7:13"
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		_, err := run(backend, input, nil)
+		if err == nil || err.Error() != wantErr {
+			t.Errorf("got error %v, expected %q", err, wantErr)
+		}
+	})
+}
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		kind       *diagnostic.Kind
+		start, end string
+	}{
+		{
+			name:  "division by zero",
+			input: "function div(a, b) {\n  return a / b;\n}\nprint div(1, 0);",
+			kind:  diagnostic.ErrDivisionByZero,
+			start: "<input>:2:12",
+			end:   "<input>:2:12",
+		},
+		{
+			name:  "undefined variable",
+			input: "print 1;\nprint count;",
+			kind:  diagnostic.ErrUndefinedVariable,
+			start: "<input>:2:7",
+			end:   "<input>:2:12",
+		},
+		{
+			name:  "arity",
+			input: "function f(a) {}\nf();",
+			kind:  diagnostic.ErrArity,
+			start: "<input>:2:3",
+			end:   "<input>:2:3",
+		},
+		{
+			name:  "index out of range",
+			input: "let l = [1];\nprint l[3];",
+			kind:  diagnostic.ErrIndexOutOfRange,
+			start: "<input>:2:8",
+			end:   "<input>:2:8",
+		},
+		{
+			name:  "uncaught throw",
+			input: "throw \"boom\";",
+			kind:  diagnostic.ErrUncaught,
+			start: "<input>:1:1",
+			end:   "<input>:1:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, backend Backend) {
+				_, err := run(backend, tt.input, nil)
+				if !errors.Is(err, tt.kind) {
+					t.Fatalf("got error %v, expected one of kind %q", err, tt.kind)
+				}
+				var d diagnostic.Diagnostic
+				if !errors.As(err, &d) {
+					t.Fatalf("got error %v, expected a diagnostic", err)
+				}
+				if d.Code != tt.kind.Code || d.Severity != diagnostic.SeverityError {
+					t.Errorf("got code %s and severity %s, expected %s and error", d.Code, d.Severity, tt.kind.Code)
+				}
+				start, end := diagnostic.FormatPosition(d.Span.Start), diagnostic.FormatPosition(d.Span.End)
+				if start != tt.start || end != tt.end {
+					t.Errorf("got span %s to %s, expected %s to %s", start, end, tt.start, tt.end)
+				}
+			})
+		})
+	}
+}
+
+func TestDiagnosticStack(t *testing.T) {
+	input := "function div(a, b) {\n  return a / b;\n}\nprint div(1, 0);"
+	forEachBackend(t, func(t *testing.T, backend Backend) {
+		_, err := run(backend, input, nil)
+		var e InterpreterError
+		if !errors.As(err, &e) {
+			t.Fatalf("got error %v, expected a runtime error", err)
+		}
+		if len(e.Stack) != 1 || e.Stack[0].String() != "div called at <input>:4:15" {
+			t.Errorf("got stack %v, expected the call of div", e.Stack)
+		}
+	})
+}
+
+// TestConstAtRuntime checks the runtime guards of declarations, which
+// matter for programs that didn't go through the resolver.
+func TestConstAtRuntime(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "assignment to constant",
+			input:   "const c = 1;\nc = 2;",
+			wantErr: "can't assign to constant 'c'\n<input>:2:1",
+		},
+		{
+			name:    "redeclaration",
+			input:   "let a = 1;\nfunction a() {}",
+			wantErr: "'a' is already declared in this scope\n<input>:2:10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := lexer.New(strings.NewReader(tt.input))
+			stmts, err := parser.New(l.ScanTokens()).Parse()
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			i := New()
+			i.out = &bytes.Buffer{}
+			_, err = i.Interpret(stmts)
+			if err == nil {
+				t.Fatalf("expected error %q but got none", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %q, expected it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMaxCallDepth(t *testing.T) {
+	l := lexer.New(strings.NewReader("function f(n) {\n  if (n > 0) f(n - 1);\n}\nf(2);\nf(3);"))
+	stmts, err := parser.New(l.ScanTokens()).Parse()
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	i := New(WithMaxCallDepth(3), WithOutput(&bytes.Buffer{}))
+	if err := i.Resolve(stmts); err != nil {
+		t.Fatalf("unexpected resolve error: %v", err)
+	}
+
+	// f(2) makes three calls, which the limit allows, and f(3) one more.
+	_, err = i.Interpret(stmts)
+	wantErr := "stack overflow: more than 3 nested calls\n<input>:2:21\n  f called at <input>:2:21 (2 times)\n  f called at <input>:5:4"
+	if err == nil || !strings.HasPrefix(err.Error(), wantErr) {
+		t.Fatalf("got error %v, expected it to start with %q", err, wantErr)
+	}
+	if len(i.calls) != 0 {
+		t.Errorf("got %d calls running after the error, expected none", len(i.calls))
+	}
+}
+
+// TestMaxCallDepthLimit checks that a depth too large for the Go stack is
+// lowered to MaxRecursiveCallDepth, which still fails with a stack overflow.
+func TestMaxCallDepthLimit(t *testing.T) {
+	l := lexer.New(strings.NewReader("function f(n) {\n  try {\n    while (true) {\n      return 1 + [f(n + 1)][0];\n    }\n  } finally {}\n}\nf(0);"))
+	stmts, err := parser.New(l.ScanTokens()).Parse()
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	_, err = New(WithMaxCallDepth(1<<30), WithOutput(&bytes.Buffer{})).Interpret(stmts)
+	want := fmt.Sprintf("stack overflow: more than %d nested calls", MaxRecursiveCallDepth)
+	if err == nil || !strings.HasPrefix(err.Error(), want) {
+		t.Fatalf("got error %v, expected it to start with %q", err, want)
+	}
+}
+
+func TestTailCallsOff(t *testing.T) {
+	l := lexer.New(strings.NewReader("function f(n) {\n  if (n > 0) return f(n - 1);\n}\nf(2);\nf(3);"))
+	stmts, err := parser.New(l.ScanTokens()).Parse()
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	i := New(WithMaxCallDepth(3), WithTailCalls(false), WithOutput(&bytes.Buffer{}))
+	if err := i.Resolve(stmts); err != nil {
+		t.Fatalf("unexpected resolve error: %v", err)
+	}
+
+	_, err = i.Interpret(stmts)
+	wantErr := "stack overflow: more than 3 nested calls\n<input>:2:28\n  f called at <input>:2:28 (2 times)\n  f called at <input>:5:4"
+	if err == nil || !strings.HasPrefix(err.Error(), wantErr) {
+		t.Fatalf("got error %v, expected it to start with %q", err, wantErr)
+	}
+}
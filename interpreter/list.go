@@ -0,0 +1,42 @@
+package interpreter
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// List is the runtime value of a list literal. Lists are shared by
+// reference, so an index assignment is visible through every variable
+// that holds the same list.
+type List struct {
+	Elements []any
+}
+
+func NewList(elements []any) *List {
+	return &List{
+		Elements: elements,
+	}
+}
+
+func (l *List) String() string {
+	b := &strings.Builder{}
+	b.WriteString("[")
+	for i, element := range l.Elements {
+		if i != 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(Repr(element))
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// Repr formats a value nested inside a collection, quoting strings so they
+// can be told apart from other values.
+func Repr(value any) string {
+	if s, ok := value.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,118 @@
+package interpreter
+
+import (
+	"math"
+	"strings"
+
+	"github.com/Toolnado/sludge/diagnostic"
+)
+
+// Map is the runtime value of a map literal. Keys are strings, numbers or
+// booleans and follow the same equality rules as IsEqual, so 1 and 1.0 name
+// the same entry. Entries are kept in insertion order. Like lists, maps are
+// shared by reference.
+type Map struct {
+	keys   []any       // Keys in insertion order, as first written
+	values map[any]any // Values by normalized key
+}
+
+func NewMap() *Map {
+	return &Map{
+		values: make(map[any]any),
+	}
+}
+
+// mapKey normalizes a key so that keys considered equal by IsEqual are also
+// equal as Go map keys: floats that are integers become int64, like IsEqual
+// compares them. NaN is equal to nothing, so it can't be a key.
+func mapKey(key any) (any, error) {
+	switch k := key.(type) {
+	case string, bool, int64:
+		return k, nil
+	case float64:
+		if math.IsNaN(k) {
+			return nil, diagnostic.Errorf(diagnostic.ErrType, "map keys can't be NaN")
+		}
+		// As a float, MaxInt64 rounds up to 2^63, which is out of range.
+		if k == math.Trunc(k) && k >= math.MinInt64 && k < math.MaxInt64 {
+			return int64(k), nil
+		}
+		return k, nil
+	default:
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "map keys must be strings, numbers or booleans")
+	}
+}
+
+// Get returns the value stored under key and whether it was present.
+func (m *Map) Get(key any) (any, bool, error) {
+	k, err := mapKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	value, ok := m.values[k]
+	return value, ok, nil
+}
+
+// Set stores value under key. A new key is appended to the iteration order,
+// an existing one keeps its place.
+func (m *Map) Set(key any, value any) error {
+	k, err := mapKey(key)
+	if err != nil {
+		return err
+	}
+	if _, ok := m.values[k]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[k] = value
+	return nil
+}
+
+// Delete removes key from the map and reports whether it was present.
+func (m *Map) Delete(key any) (bool, error) {
+	k, err := mapKey(key)
+	if err != nil {
+		return false, err
+	}
+	if _, ok := m.values[k]; !ok {
+		return false, nil
+	}
+	delete(m.values, k)
+	for i, existing := range m.keys {
+		if normalized, _ := mapKey(existing); normalized == k {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+	return true, nil
+}
+
+// Keys returns the keys of the map in insertion order.
+func (m *Map) Keys() []any {
+	keys := make([]any, len(m.keys))
+	copy(keys, m.keys)
+	return keys
+}
+
+// Len returns the number of entries in the map.
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+func (m *Map) String() string {
+	if len(m.keys) == 0 {
+		return "[:]"
+	}
+	b := &strings.Builder{}
+	b.WriteString("[")
+	for i, key := range m.keys {
+		if i != 0 {
+			b.WriteString(", ")
+		}
+		value, _, _ := m.Get(key)
+		b.WriteString(Repr(key))
+		b.WriteString(": ")
+		b.WriteString(Repr(value))
+	}
+	b.WriteString("]")
+	return b.String()
+}
@@ -0,0 +1,159 @@
+package interpreter
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/environment"
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+	"github.com/Toolnado/sludge/token"
+)
+
+// Loader reads the source of a module. Paths are slash-separated and
+// already resolved against the importing module.
+type Loader interface {
+	Load(path string) ([]byte, error)
+}
+
+// FSLoader loads modules from a file system, such as an embed.FS.
+type FSLoader struct {
+	fsys fs.FS
+}
+
+func NewFSLoader(fsys fs.FS) FSLoader {
+	return FSLoader{
+		fsys: fsys,
+	}
+}
+
+func (l FSLoader) Load(path string) ([]byte, error) {
+	return fs.ReadFile(l.fsys, path)
+}
+
+// FileLoader loads modules from disk, relative to a root directory.
+type FileLoader struct {
+	root string
+}
+
+func NewFileLoader(root string) FileLoader {
+	return FileLoader{
+		root: root,
+	}
+}
+
+func (l FileLoader) Load(path string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(l.root, filepath.FromSlash(path)))
+}
+
+// Module is the runtime value of an imported file. Every top-level name
+// declared by the module can be read from it with the '.' operator.
+type Module struct {
+	path        string
+	environment *environment.Environment
+}
+
+// NewModule returns the module at path whose top-level names are the
+// variables of env.
+func NewModule(path string, env *environment.Environment) *Module {
+	return &Module{
+		path:        path,
+		environment: env,
+	}
+}
+
+// Get returns the value of a top-level name declared by the module.
+func (m *Module) Get(name token.Token) (any, error) {
+	value, ok := m.environment.Lookup(name.Lexeme)
+	if !ok {
+		return nil, diagnostic.Errorf(diagnostic.ErrUndefinedProperty, "module '%s' has no member '%s'", m.path, name.Lexeme)
+	}
+	return value, nil
+}
+
+func (m *Module) String() string {
+	return fmt.Sprintf("<module %s>", m.path)
+}
+
+// ResolveModule resolves an import path against the module being loaded,
+// the last of loading.
+func ResolveModule(loading []string, name string) string {
+	if len(loading) > 0 && !path.IsAbs(name) {
+		name = path.Join(path.Dir(loading[len(loading)-1]), name)
+	}
+	return path.Clean(name)
+}
+
+// ParseModule reads and parses the module name, as resolved by
+// ResolveModule, with loader. Modules that are still being loaded form an
+// import cycle. Errors about the module itself are reported at pos, the
+// position of the path in the import statement.
+func ParseModule(loader Loader, loading []string, name string, pos token.Position) ([]ast.Stmt, error) {
+	for indx, l := range loading {
+		if l == name {
+			cycle := append(append([]string{}, loading[indx:]...), name)
+			return nil, Wrap(
+				diagnostic.Errorf(diagnostic.ErrImport, "import cycle detected: %s", strings.Join(cycle, " -> ")),
+				pos,
+			)
+		}
+	}
+
+	source, err := loader.Load(name)
+	if err != nil {
+		return nil, Wrap(diagnostic.Errorf(diagnostic.ErrImport, "can't load module '%s': %s", name, err), pos)
+	}
+
+	l := lexer.NewFile(bytes.NewReader(source), name)
+	tokens := l.ScanTokens()
+	errs := l.Errors()
+	stmts, err := parser.New(tokens).Parse()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		// The errors are listed as notes, which point into the module.
+		d := diagnostic.New(diagnostic.ErrImport, fmt.Sprintf("module '%s' has syntax errors", name), diagnostic.At(pos))
+		for _, e := range diagnostic.List(errors.Join(errs...)) {
+			d = d.WithNote(e.Message, e.Span)
+		}
+		return nil, InterpreterError{Diagnostic: d}
+	}
+	return stmts, nil
+}
+
+// importModule returns the module at the given import path, running it on
+// first use. A module runs in an environment of its own, which sees the
+// builtins but not the globals of the program that imports it.
+func (i *Interpreter) importModule(stmt *ast.ImportStmt) (*Module, error) {
+	name := ResolveModule(i.loading, stmt.Path.Literal.(string))
+	if module, ok := i.modules[name]; ok {
+		return module, nil
+	}
+	stmts, err := ParseModule(i.loader, i.loading, name, stmt.Path.Position)
+	if err != nil {
+		return nil, err
+	}
+	if err := i.resolve(stmts, i.builtins.Names()); err != nil {
+		return nil, err
+	}
+
+	module := NewModule(name, environment.NewGlobal(i.builtins))
+	i.hoist(ast.HoistedVars(stmts), module.environment)
+	i.loading = append(i.loading, name)
+	_, err = i.excecuteBlock(stmts, module.environment)
+	i.loading = i.loading[:len(i.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+	i.modules[name] = module
+	return module, nil
+}
@@ -0,0 +1,120 @@
+package interpreter
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestImport(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/math.sludge": {Data: []byte(`
+			print "loading math";
+			var pi = 3;
+			function square(x) {
+				return x * x;
+			}
+		`)},
+		"lib/geometry.sludge": {Data: []byte(`
+			import { pi, square } from "math.sludge";
+			function area(r) {
+				return pi * square(r);
+			}
+		`)},
+		"cycle/a.sludge": {Data: []byte(`import "b.sludge";`)},
+		"cycle/b.sludge": {Data: []byte(`import "a.sludge";`)},
+		"broken.sludge":  {Data: []byte("let x = ;\nprint (1;")},
+		"own.sludge":     {Data: []byte(`var secret = 2; print len("abc");`)},
+		"peek.sludge":    {Data: []byte("print secret;\nsecret = 42;")},
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+		wantErr  string
+	}{
+		{
+			name: "import as module value",
+			input: `
+				import "lib/math.sludge" as m;
+				print m.square(m.pi);
+				print m;
+			`,
+			expected: "loading math\n9\n<module lib/math.sludge>\n",
+		},
+		{
+			name: "import names with relative paths",
+			input: `
+				import { area } from "lib/geometry.sludge";
+				print area(2);
+			`,
+			expected: "loading math\n12\n",
+		},
+		{
+			name: "modules run once",
+			input: `
+				import "lib/math.sludge" as a;
+				import { pi } from "lib/math.sludge";
+				import "lib/geometry.sludge";
+				print pi;
+			`,
+			expected: "loading math\n3\n",
+		},
+		{
+			name: "modules have globals of their own",
+			input: `
+				var secret = 1;
+				import "own.sludge" as m;
+				print secret;
+				print m.secret;
+			`,
+			expected: "3\n1\n2\n",
+		},
+		{
+			name:    "modules don't see the importer's globals",
+			input:   "var secret = 1;\nimport \"peek.sludge\";",
+			wantErr: "undefined variable 'secret'\npeek.sludge:1:7",
+		},
+		{
+			name:    "missing export",
+			input:   `import { tau } from "lib/math.sludge";`,
+			wantErr: "module 'lib/math.sludge' has no member 'tau'",
+		},
+		{
+			name:    "missing module",
+			input:   `import "nope.sludge";`,
+			wantErr: "can't load module 'nope.sludge'",
+		},
+		{
+			name:    "import cycle",
+			input:   `import "cycle/a.sludge";`,
+			wantErr: "import cycle detected: cycle/a.sludge -> cycle/b.sludge -> cycle/a.sludge\ncycle/b.sludge:1:8",
+		},
+		{
+			name:    "syntax errors",
+			input:   `import "broken.sludge";`,
+			wantErr: "module 'broken.sludge' has syntax errors\n<input>:1:8\n  expect expression at broken.sludge:1:9\n  expect ')' after expression at broken.sludge:2:9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, backend Backend) {
+				got, err := run(backend, tt.input, NewFSLoader(fsys))
+				if tt.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+						t.Fatalf("got error %v, expected it to contain %q", err, tt.wantErr)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if got != tt.expected {
+					t.Errorf("got output %q, expected %q", got, tt.expected)
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/Toolnado/sludge/diagnostic"
+)
+
+// Native is a Callable implemented in Go and exposed to scripts as a global.
+type Native struct {
+	name  string
+	arity int
+	fn    func(interpreter *Interpreter, arguments []any) (any, error)
+}
+
+func NewNative(name string, arity int, fn func(interpreter *Interpreter, arguments []any) (any, error)) Native {
+	return Native{
+		name:  name,
+		arity: arity,
+		fn:    fn,
+	}
+}
+
+func (n Native) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	return n.fn(interpreter, arguments)
+}
+
+func (n Native) Arity() int {
+	return n.arity
+}
+
+func (n Native) String() string {
+	return fmt.Sprintf("<native fn %s>", n.name)
+}
+
+// natives are the built-in functions defined by Builtins.
+var natives = []Native{
+	NewNative("len", 1, nativeLen),
+	NewNative("keys", 1, nativeKeys),
+	NewNative("values", 1, nativeValues),
+	NewNative("has", 2, nativeHas),
+	NewNative("delete", 2, nativeDelete),
+}
+
+func nativeLen(_ *Interpreter, arguments []any) (any, error) {
+	switch v := arguments[0].(type) {
+	case string:
+		return int64(len([]rune(v))), nil
+	case *List:
+		return int64(len(v.Elements)), nil
+	case *Map:
+		return int64(v.Len()), nil
+	default:
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "len expects a string, list or map")
+	}
+}
+
+func nativeKeys(_ *Interpreter, arguments []any) (any, error) {
+	m, ok := arguments[0].(*Map)
+	if !ok {
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "keys expects a map")
+	}
+	return NewList(m.Keys()), nil
+}
+
+func nativeValues(_ *Interpreter, arguments []any) (any, error) {
+	m, ok := arguments[0].(*Map)
+	if !ok {
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "values expects a map")
+	}
+	values := make([]any, 0, m.Len())
+	for _, key := range m.Keys() {
+		value, _, _ := m.Get(key)
+		values = append(values, value)
+	}
+	return NewList(values), nil
+}
+
+func nativeHas(_ *Interpreter, arguments []any) (any, error) {
+	m, ok := arguments[0].(*Map)
+	if !ok {
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "has expects a map")
+	}
+	_, found, err := m.Get(arguments[1])
+	return found, err
+}
+
+func nativeDelete(_ *Interpreter, arguments []any) (any, error) {
+	m, ok := arguments[0].(*Map)
+	if !ok {
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "delete expects a map")
+	}
+	return m.Delete(arguments[1])
+}
@@ -0,0 +1,92 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Toolnado/sludge/diagnostic"
+)
+
+// Record is the runtime value of a record declaration. Calling a record
+// creates a RecordValue holding one argument per field.
+type Record struct {
+	name   string
+	fields []string
+}
+
+func NewRecord(name string, fields []string) *Record {
+	return &Record{
+		name:   name,
+		fields: fields,
+	}
+}
+
+func (r *Record) Call(interpreter *Interpreter, arguments []any) (any, error) {
+	values := make([]any, len(arguments))
+	copy(values, arguments)
+	return &RecordValue{record: r, values: values}, nil
+}
+
+func (r *Record) Arity() int {
+	return len(r.fields)
+}
+
+// field returns the position of the named field.
+func (r *Record) field(name string) (int, bool) {
+	for i, field := range r.fields {
+		if field == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (r *Record) String() string {
+	return fmt.Sprintf("<record %s>", r.name)
+}
+
+// RecordValue is an immutable instance of a record. Two record values are
+// equal when they belong to the same record and all their fields are equal.
+type RecordValue struct {
+	record *Record
+	values []any
+}
+
+// Get returns the value of the named field.
+func (r *RecordValue) Get(name string) (any, error) {
+	i, ok := r.record.field(name)
+	if !ok {
+		return nil, diagnostic.Errorf(diagnostic.ErrUndefinedProperty, "undefined field '%s' on record %s", name, r.record.name)
+	}
+	return r.values[i], nil
+}
+
+// With returns a copy of the record value with the named fields replaced.
+func (r *RecordValue) With(names []string, values []any) (*RecordValue, error) {
+	updated := make([]any, len(r.values))
+	copy(updated, r.values)
+	for indx, name := range names {
+		i, ok := r.record.field(name)
+		if !ok {
+			return nil, diagnostic.Errorf(diagnostic.ErrUndefinedProperty, "undefined field '%s' on record %s", name, r.record.name)
+		}
+		updated[i] = values[indx]
+	}
+	return &RecordValue{record: r.record, values: updated}, nil
+}
+
+func (r *RecordValue) String() string {
+	b := &strings.Builder{}
+	b.WriteString(r.record.name)
+	b.WriteString("(")
+	for i, field := range r.record.fields {
+		if i != 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(field)
+		b.WriteString(": ")
+		b.WriteString(Repr(r.values[i]))
+	}
+	b.WriteString(")")
+	return b.String()
+}
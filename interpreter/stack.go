@@ -0,0 +1,155 @@
+package interpreter
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/token"
+)
+
+// DefaultMaxCallDepth is how many calls of functions written in Sludge can
+// run at once unless configured otherwise. It leaves the tree-walking
+// backends, which recurse on the Go stack, far from exhausting it.
+const DefaultMaxCallDepth = 10000
+
+// MaxRecursiveCallDepth is the largest call depth the tree-walking
+// backends accept. They recurse on the Go stack, whose 1 GB limit deeper
+// calls could exceed, which kills the process instead of failing with a
+// stack overflow. The vm keeps its frames on the heap and has no limit.
+const MaxRecursiveCallDepth = 50000
+
+// tracebackLines is how many of the innermost and of the outermost lines
+// of a long list of calls are shown.
+const tracebackLines = 5
+
+// CallFrame is a call of a function written in Sludge that is running.
+type CallFrame struct {
+	Function string         // Name of the function, empty if anonymous
+	Position token.Position // Where the function was called
+}
+
+func (f CallFrame) String() string {
+	name := f.Function
+	if name == "" {
+		name = "<fn>"
+	}
+	return fmt.Sprintf("%s called at %s", name, diagnostic.FormatPosition(f.Position))
+}
+
+// StackOverflow returns the error of a call that would make more than max
+// calls run at once. Like other runtime errors, it lists the calls running
+// once traced.
+func StackOverflow(max int) error {
+	return diagnostic.Errorf(diagnostic.ErrStackOverflow, "stack overflow: more than %d nested calls", max)
+}
+
+// tracebackLine is a line of a traceback: a call, made count times in a
+// row, or, with no call, count calls left out.
+type tracebackLine struct {
+	frame CallFrame
+	count int
+}
+
+// traceback returns the lines of a traceback of stack, which holds the
+// calls outermost first, innermost first. Runs of the same call, as in a
+// recursion, take a single line, and only the innermost and outermost
+// lines of a long list are kept.
+func traceback(stack []CallFrame) []tracebackLine {
+	var runs []tracebackLine
+	for indx := len(stack) - 1; indx >= 0; indx-- {
+		if n := len(runs); n > 0 && runs[n-1].frame == stack[indx] {
+			runs[n-1].count++
+			continue
+		}
+		runs = append(runs, tracebackLine{frame: stack[indx], count: 1})
+	}
+	if len(runs) <= 2*tracebackLines {
+		return runs
+	}
+
+	hidden := 0
+	for _, r := range runs[tracebackLines : len(runs)-tracebackLines] {
+		hidden += r.count
+	}
+	lines := append([]tracebackLine(nil), runs[:tracebackLines]...)
+	lines = append(lines, tracebackLine{count: hidden})
+	return append(lines, runs[len(runs)-tracebackLines:]...)
+}
+
+// writeTraceback writes the traceback of stack, one line per call.
+func writeTraceback(b *strings.Builder, stack []CallFrame) {
+	for _, line := range traceback(stack) {
+		if line.frame == (CallFrame{}) {
+			fmt.Fprintf(b, "\n  ... %d more calls", line.count)
+			continue
+		}
+		fmt.Fprintf(b, "\n  %s", line.frame)
+		if line.count > 1 {
+			fmt.Fprintf(b, " (%d times)", line.count)
+		}
+	}
+}
+
+// tracebackNotes returns the traceback of stack as notes, which point at
+// the calls.
+func tracebackNotes(stack []CallFrame) []diagnostic.Note {
+	var notes []diagnostic.Note
+	for _, line := range traceback(stack) {
+		if line.frame == (CallFrame{}) {
+			notes = append(notes, diagnostic.Note{Message: fmt.Sprintf("... %d more calls", line.count)})
+			continue
+		}
+		name := line.frame.Function
+		if name == "" {
+			name = "<fn>"
+		}
+		message := name + " called"
+		if line.count > 1 {
+			message += fmt.Sprintf(" (%d times)", line.count)
+		}
+		notes = append(notes, diagnostic.Note{Message: message, Span: diagnostic.At(line.frame.Position)})
+	}
+	return notes
+}
+
+// enter records the start of a call to callee at paren, failing if there
+// are too many calls running already. It reports whether the call runs a
+// function written in Sludge, which leave has to be called for once it
+// returns.
+func (i *Interpreter) enter(callee Callable, paren token.Token) (bool, error) {
+	var name token.Token
+	switch c := callee.(type) {
+	case Function:
+		name = c.declaration.Name
+	case *Class:
+		initializer, ok := c.findMethod("init")
+		if !ok {
+			return false, nil
+		}
+		name = initializer.declaration.Name
+	default:
+		return false, nil
+	}
+	if len(i.calls) >= i.maxCallDepth {
+		return false, Wrap(StackOverflow(i.maxCallDepth), paren.Position)
+	}
+	i.calls = append(i.calls, newCallFrame(name, paren))
+	return true, nil
+}
+
+// newCallFrame returns the frame of a call at paren to the function
+// declared with name.
+func newCallFrame(name, paren token.Token) CallFrame {
+	frame := CallFrame{Position: paren.Position}
+	// Anonymous functions carry the "function" or "=>" token instead of a name.
+	if name.Type == token.IDENTIFIER {
+		frame.Function = name.Lexeme
+	}
+	return frame
+}
+
+// leave records the end of the innermost call.
+func (i *Interpreter) leave() {
+	i.calls = i.calls[:len(i.calls)-1]
+}
@@ -0,0 +1,412 @@
+package interpreter
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/environment"
+	"github.com/Toolnado/sludge/syslib/time"
+	"github.com/Toolnado/sludge/token"
+)
+
+// The functions in this file define what the operators of Sludge do to its
+// values. The interpreter uses them, and so do other backends such as the
+// vm package, so that a program gives the same results and errors however
+// it runs. Their errors carry no position: callers add the position of the
+// expression that failed.
+
+// Builtins returns a new environment holding the built-in functions, such
+// as clock and len.
+func Builtins() *environment.Environment {
+	builtins := environment.NewGlobal(nil)
+	builtins.Define("clock", time.New())
+	for _, n := range natives {
+		builtins.Define(n.name, n)
+	}
+	return builtins
+}
+
+// IsTruthy reports whether a value counts as true in a condition. Only nil
+// and false are false.
+func IsTruthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	default:
+		return true
+	}
+}
+
+// equalIntFloat reports whether i and f are the same number. Converting i
+// to a float would round integers beyond 2^53, making them equal to floats
+// they are not, so f is converted to an integer instead when it is one.
+func equalIntFloat(i int64, f float64) bool {
+	// As a float, MaxInt64 rounds up to 2^63, which is out of range.
+	return f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 && int64(f) == i
+}
+
+// IsEqual reports whether two values are equal, as the '==' operator does.
+// Numbers are compared by their exact value whatever their type, lists,
+// maps, classes, instances and modules by identity, and record values
+// field by field.
+func IsEqual(a, b any) bool {
+	switch x := a.(type) {
+	case nil:
+		return b == nil
+	case int64:
+		switch y := b.(type) {
+		case int64:
+			return x == y
+		case float64:
+			return equalIntFloat(x, y)
+		}
+	case float64:
+		switch y := b.(type) {
+		case float64:
+			return x == y
+		case int64:
+			return equalIntFloat(y, x)
+		}
+	case string:
+		if y, ok := b.(string); ok {
+			return x == y
+		}
+	case bool:
+		if y, ok := b.(bool); ok {
+			return x == y
+		}
+	case *List:
+		if y, ok := b.(*List); ok {
+			return x == y
+		}
+	case *Map:
+		if y, ok := b.(*Map); ok {
+			return x == y
+		}
+	case *Instance:
+		if y, ok := b.(*Instance); ok {
+			return x == y
+		}
+	case *Class:
+		if y, ok := b.(*Class); ok {
+			return x == y
+		}
+	case *Record:
+		if y, ok := b.(*Record); ok {
+			return x == y
+		}
+	case *Module:
+		if y, ok := b.(*Module); ok {
+			return x == y
+		}
+	case *RecordValue:
+		y, ok := b.(*RecordValue)
+		if !ok || x.record != y.record {
+			return false
+		}
+		for indx := range x.values {
+			if !IsEqual(x.values[indx], y.values[indx]) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// Stringify returns the text of a value as print writes it.
+func Stringify(value any) string {
+	return fmt.Sprint(value)
+}
+
+// Negate applies the unary '-' operator.
+func Negate(value any) (any, error) {
+	switch v := value.(type) {
+	case int64:
+		return -v, nil
+	case float64:
+		return -v, nil
+	default:
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "unary '-' expects number")
+	}
+}
+
+// Add applies the '+' operator, which adds numbers and concatenates
+// strings.
+func Add(left, right any) (any, error) {
+	switch l := left.(type) {
+	case float64, int64:
+		return Arithmetic(token.PLUS, left, right)
+	case string:
+		r, ok := right.(string)
+		if !ok {
+			return nil, diagnostic.Errorf(diagnostic.ErrType, "cannot concatenate string")
+		}
+		return l + r, nil
+	default:
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "unsupported operand types for '+'")
+	}
+}
+
+// Arithmetic applies one of the numeric operators '+', '-', '*', '/' and
+// '%'. Integers stay integers, except that division always gives a float.
+func Arithmetic(op token.TokenType, left, right any) (any, error) {
+	// Пробуем int → int
+	if li, lok := left.(int64); lok {
+		if ri, rok := right.(int64); rok {
+			switch op {
+			case token.PLUS:
+				return li + ri, nil
+			case token.MINUS:
+				return li - ri, nil
+			case token.STAR:
+				return li * ri, nil
+			case token.SLASH:
+				if ri == 0 {
+					return nil, diagnostic.Errorf(diagnostic.ErrDivisionByZero, "division by zero")
+				}
+				return float64(li) / float64(ri), nil // Деление всё равно float
+			case token.PERCENT:
+				if ri == 0 {
+					return nil, diagnostic.Errorf(diagnostic.ErrDivisionByZero, "modulo by zero")
+				}
+				return li % ri, nil
+			}
+		}
+	}
+
+	// Fallback to float64
+	lf, err := toFloat64(left)
+	if err != nil {
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "left operand is not a number")
+	}
+
+	rf, err := toFloat64(right)
+	if err != nil {
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "right operand is not a number")
+	}
+
+	switch op {
+	case token.PLUS:
+		return lf + rf, nil
+	case token.MINUS:
+		return lf - rf, nil
+	case token.STAR:
+		return lf * rf, nil
+	case token.SLASH:
+		if rf == 0 {
+			return nil, diagnostic.Errorf(diagnostic.ErrDivisionByZero, "division by zero")
+		}
+		return lf / rf, nil
+	default:
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "unsupported numeric op on float")
+	}
+}
+
+// Compare applies one of the operators '==', '!=', '<', '<=', '>' and
+// '>='.
+func Compare(op token.TokenType, left, right any) (any, error) {
+	switch op {
+	case token.EQUAL_EQUAL:
+		return IsEqual(left, right), nil
+	case token.BANG_EQUAL:
+		return !IsEqual(left, right), nil
+	}
+
+	lf, err := toFloat64(left)
+	if err != nil {
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "left not number for comparison")
+	}
+	rf, err := toFloat64(right)
+	if err != nil {
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "right not number for comparison")
+	}
+
+	switch op {
+	case token.LESS:
+		return lf < rf, nil
+	case token.LESS_EQUAL:
+		return lf <= rf, nil
+	case token.GREATER:
+		return lf > rf, nil
+	case token.GREATER_EQUAL:
+		return lf >= rf, nil
+	default:
+		return nil, diagnostic.Errorf(diagnostic.ErrRuntime, "unknown comparison op")
+	}
+}
+
+func toFloat64(v any) (float64, error) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case float64:
+		return n, nil
+	default:
+		return 0, diagnostic.Errorf(diagnostic.ErrType, "value %v (type %T) is not numeric", v, v)
+	}
+}
+
+// GetIndex returns the element of a list, string or map at index.
+func GetIndex(object, index any) (any, error) {
+	switch o := object.(type) {
+	case *List:
+		indx, err := position(index, len(o.Elements))
+		if err != nil {
+			return nil, err
+		}
+		return o.Elements[indx], nil
+	case string:
+		runes := []rune(o)
+		indx, err := position(index, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[indx]), nil
+	case *Map:
+		value, _, err := o.Get(index)
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	default:
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "can only index lists, strings and maps")
+	}
+}
+
+// SetIndex stores value as the element of a list or map at index.
+func SetIndex(object, index, value any) error {
+	switch o := object.(type) {
+	case *List:
+		indx, err := position(index, len(o.Elements))
+		if err != nil {
+			return err
+		}
+		o.Elements[indx] = value
+		return nil
+	case *Map:
+		return o.Set(index, value)
+	default:
+		return diagnostic.Errorf(diagnostic.ErrType, "can only assign to list and map elements")
+	}
+}
+
+// Slice returns the part of a list or string between start and end, either
+// of which may be nil.
+func Slice(object, start, end any) (any, error) {
+	switch o := object.(type) {
+	case *List:
+		low, high, err := sliceBounds(start, end, len(o.Elements))
+		if err != nil {
+			return nil, err
+		}
+		elements := make([]any, high-low)
+		copy(elements, o.Elements[low:high])
+		return NewList(elements), nil
+	case string:
+		runes := []rune(o)
+		low, high, err := sliceBounds(start, end, len(runes))
+		if err != nil {
+			return nil, err
+		}
+		return string(runes[low:high]), nil
+	default:
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "can only slice lists and strings")
+	}
+}
+
+// position converts an index value into a position in a sequence of the
+// given length. Negative indexes count from the end of the sequence.
+func position(value any, length int) (int, error) {
+	n, ok := value.(int64)
+	if !ok {
+		return 0, diagnostic.Errorf(diagnostic.ErrType, "index must be an integer")
+	}
+	index := int(n)
+	if index < 0 {
+		index += length
+	}
+	if index < 0 || index >= length {
+		return 0, diagnostic.Errorf(diagnostic.ErrIndexOutOfRange, "index %d out of range for length %d", n, length)
+	}
+	return index, nil
+}
+
+// sliceBounds converts the optional start and end of a slice into positions
+// in a sequence of the given length. Missing bounds default to the start and
+// the end of the sequence, and negative bounds count from the end.
+func sliceBounds(start, end any, length int) (int, int, error) {
+	bound := func(value any, fallback int) (int, error) {
+		if value == nil {
+			return fallback, nil
+		}
+		n, ok := value.(int64)
+		if !ok {
+			return 0, diagnostic.Errorf(diagnostic.ErrType, "slice bounds must be integers")
+		}
+		if n < 0 {
+			n += int64(length)
+		}
+		return int(n), nil
+	}
+
+	low, err := bound(start, 0)
+	if err != nil {
+		return 0, 0, err
+	}
+	high, err := bound(end, length)
+	if err != nil {
+		return 0, 0, err
+	}
+	if low < 0 || high > length || low > high {
+		return 0, 0, diagnostic.Errorf(diagnostic.ErrIndexOutOfRange, "slice bounds [%v:%v] out of range for length %d", start, end, length)
+	}
+	return low, high, nil
+}
+
+// GetProperty returns the property name of an instance, record, module or
+// map.
+func GetProperty(object any, name token.Token) (any, error) {
+	switch o := object.(type) {
+	case *Instance:
+		return o.Get(name)
+	case *RecordValue:
+		return o.Get(name.Lexeme)
+	case *Module:
+		return o.Get(name)
+	case *Map:
+		value, _, _ := o.Get(name.Lexeme)
+		return value, nil
+	default:
+		return nil, diagnostic.Errorf(diagnostic.ErrType, "only instances, records, modules and maps have properties")
+	}
+}
+
+// CheckSetProperty reports whether the property name of object can be
+// assigned. Backends check it before they evaluate the assigned value.
+func CheckSetProperty(object any, name token.Token) error {
+	switch o := object.(type) {
+	case *Instance, *Map:
+		return nil
+	case *RecordValue:
+		return diagnostic.Errorf(diagnostic.ErrConstant, "can't assign to field '%s' of record %s", name.Lexeme, o.record.name)
+	default:
+		return diagnostic.Errorf(diagnostic.ErrType, "only instances and maps have fields")
+	}
+}
+
+// SetProperty assigns value to the property name of an object accepted by
+// CheckSetProperty.
+func SetProperty(object any, name token.Token, value any) {
+	switch o := object.(type) {
+	case *Instance:
+		o.Set(name, value)
+	case *Map:
+		o.Set(name.Lexeme, value)
+	}
+}
@@ -2,10 +2,10 @@
 package lexer
 
 import (
-	"fmt"
 	"io"
 	"text/scanner"
 
+	"github.com/Toolnado/sludge/diagnostic"
 	"github.com/Toolnado/sludge/token"
 )
 
@@ -24,23 +24,38 @@ func New(r io.Reader) *Lexer {
 	lexer := &Lexer{}
 	lexer.scanner.Init(r)
 
-	// Configure scanner mode
+	// Configure scanner mode. String literals are scanned by the lexer
+	// itself so that interpolated expressions can contain quotes and braces.
 	lexer.scanner.Mode = scanner.ScanIdents |
 		scanner.ScanFloats |
 		scanner.ScanInts |
-		scanner.ScanStrings |
-		scanner.ScanRawStrings |
 		scanner.ScanComments |
 		scanner.SkipComments
 
 	// Configure error handling
 	lexer.scanner.Error = func(s *scanner.Scanner, msg string) {
-		lexer.hadError = true
-		lexer.errors = append(lexer.errors, fmt.Errorf("[%d:%d] --> scanner error: %s", s.Position.Line, s.Position.Column, msg))
+		pos := s.Position
+		if !pos.IsValid() {
+			pos = s.Pos()
+		}
+		lexer.addError(diagnostic.ErrInvalidToken, token.Position{
+			Filename: pos.Filename,
+			Offset:   pos.Offset,
+			Line:     pos.Line,
+			Column:   pos.Column,
+		}, msg)
 	}
 	return lexer
 }
 
+// NewFile creates a Lexer like New and records filename in the position of
+// every token, so that errors point at the file they come from.
+func NewFile(r io.Reader, filename string) *Lexer {
+	lexer := New(r)
+	lexer.scanner.Filename = filename
+	return lexer
+}
+
 // Errors returns all errors encountered during lexical analysis.
 func (l *Lexer) Errors() []error {
 	return l.errors
@@ -58,7 +73,7 @@ func (l *Lexer) ScanTokens() []token.Token {
 	if len(l.tokens) == 0 || l.tokens[len(l.tokens)-1].Type != token.EOF {
 		l.addToken(token.Token{
 			Type:     token.EOF,
-			Position: l.position(),
+			Position: l.nextPosition(),
 			Literal:  "",
 		})
 	}
@@ -1,9 +1,11 @@
 package lexer
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
+	"github.com/Toolnado/sludge/diagnostic"
 	"github.com/Toolnado/sludge/token"
 )
 
@@ -128,3 +130,135 @@ func TestErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestScanInterpolation(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []token.Token
+	}{
+		{
+			name:  "double-quoted",
+			input: `"Hello ${name}!"`,
+			expected: []token.Token{
+				{Type: token.INTERPOLATION, Literal: "Hello ", Position: token.Position{Line: 1, Column: 1}},
+				{Type: token.IDENTIFIER, Literal: "name", Position: token.Position{Line: 1, Column: 10}},
+				{Type: token.STRING, Literal: "!", Position: token.Position{Line: 1, Column: 1}},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+		{
+			name:  "nested braces and quotes",
+			input: "x = `${f({a: \"}\"})}`",
+			expected: []token.Token{
+				{Type: token.IDENTIFIER, Literal: "x", Position: token.Position{Line: 1, Column: 1}},
+				{Type: token.EQUAL, Literal: "=", Position: token.Position{Line: 1, Column: 3}},
+				{Type: token.INTERPOLATION, Literal: "", Position: token.Position{Line: 1, Column: 5}},
+				{Type: token.IDENTIFIER, Literal: "f", Position: token.Position{Line: 1, Column: 8}},
+				{Type: token.LEFT_PAREN, Literal: "(", Position: token.Position{Line: 1, Column: 9}},
+				{Type: token.LEFT_BRACE, Literal: "{", Position: token.Position{Line: 1, Column: 10}},
+				{Type: token.IDENTIFIER, Literal: "a", Position: token.Position{Line: 1, Column: 11}},
+				{Type: token.COLON, Literal: ":", Position: token.Position{Line: 1, Column: 12}},
+				{Type: token.STRING, Literal: "}", Position: token.Position{Line: 1, Column: 14}},
+				{Type: token.RIGHT_BRACE, Literal: "}", Position: token.Position{Line: 1, Column: 17}},
+				{Type: token.RIGHT_PAREN, Literal: ")", Position: token.Position{Line: 1, Column: 18}},
+				{Type: token.RAW_STRING, Literal: "", Position: token.Position{Line: 1, Column: 5}},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+		{
+			name:  "multi-line position",
+			input: "'a\n  ${ b }'",
+			expected: []token.Token{
+				{Type: token.INTERPOLATION, Literal: "a\n  ", Position: token.Position{Line: 1, Column: 1}},
+				{Type: token.IDENTIFIER, Literal: "b", Position: token.Position{Line: 2, Column: 6}},
+				{Type: token.STRING, Literal: "", Position: token.Position{Line: 1, Column: 1}},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+		{
+			name:  "escaped interpolation",
+			input: `"\${x}"`,
+			expected: []token.Token{
+				{Type: token.STRING, Literal: "${x}", Position: token.Position{Line: 1, Column: 1}},
+				{Type: token.EOF, Literal: ""},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(strings.NewReader(tt.input))
+			tokens := l.ScanTokens()
+			if errs := l.Errors(); len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs)
+			}
+
+			if len(tokens) != len(tt.expected) {
+				t.Fatalf("ScanTokens() returned %d tokens, expected %d: %v", len(tokens), len(tt.expected), tokens)
+			}
+
+			for i, tok := range tokens {
+				want := tt.expected[i]
+				if tok.Type != want.Type || tok.Literal != want.Literal {
+					t.Errorf("token %d: got %v %q, expected %v %q", i, tok.Type, tok.Literal, want.Type, want.Literal)
+				}
+				if tok.Type != token.EOF &&
+					(tok.Position.Line != want.Position.Line || tok.Position.Column != want.Position.Column) {
+					t.Errorf("token %d: got position %d:%d, expected %d:%d", i,
+						tok.Position.Line, tok.Position.Column, want.Position.Line, want.Position.Column)
+				}
+			}
+		})
+	}
+}
+
+func TestErrorDiagnostics(t *testing.T) {
+	tests := []struct {
+		name       string
+		input      string
+		kind       *diagnostic.Kind
+		start, end string
+	}{
+		{
+			name:  "unterminated string",
+			input: "x = \"abc",
+			kind:  diagnostic.ErrUnterminated,
+			start: "<input>:1:5",
+			end:   "<input>:1:9",
+		},
+		{
+			name:  "unexpected character sequence",
+			input: "a # b",
+			kind:  diagnostic.ErrInvalidToken,
+			start: "<input>:1:3",
+			end:   "<input>:1:4",
+		},
+		{
+			name:  "in an embedded expression",
+			input: "x = \"n: ${a # b}\"",
+			kind:  diagnostic.ErrInvalidToken,
+			start: "<input>:1:13",
+			end:   "<input>:1:14",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(strings.NewReader(tt.input))
+			l.ScanTokens()
+			errs := l.Errors()
+			if len(errs) != 1 {
+				t.Fatalf("got errors %v, expected one", errs)
+			}
+			var d diagnostic.Diagnostic
+			if !errors.As(errs[0], &d) || !errors.Is(d, tt.kind) {
+				t.Fatalf("got error %v, expected a diagnostic of kind %q", errs[0], tt.kind)
+			}
+			start, end := diagnostic.FormatPosition(d.Span.Start), diagnostic.FormatPosition(d.Span.End)
+			if start != tt.start || end != tt.end {
+				t.Errorf("got span %s to %s, expected %s to %s", start, end, tt.start, tt.end)
+			}
+		})
+	}
+}
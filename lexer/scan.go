@@ -4,9 +4,9 @@ package lexer
 import (
 	"fmt"
 	"strconv"
-	"strings"
 	"text/scanner"
 
+	"github.com/Toolnado/sludge/diagnostic"
 	"github.com/Toolnado/sludge/token"
 )
 
@@ -87,10 +87,12 @@ func (l *Lexer) scanOperator(ch rune, pos token.Position) token.Token {
 	if typ, ok := operatorsMap[text]; ok {
 		ttype = typ
 	} else {
-		l.addError(fmt.Sprintf("[%d:%d] --> Unexpected character sequence: %s", pos.Line, pos.Column, text))
+		l.addError(diagnostic.ErrInvalidToken, pos, fmt.Sprintf("unexpected character sequence: %s", text))
 	}
 
-	return l.createToken(ttype)
+	// The scanner forgets the token position and text once a second
+	// character has been read with next, so the token is built from pos.
+	return token.New(pos, ttype, text, l.parseLiteral(ttype, text))
 }
 
 // scanFloat processes floating-point numbers and returns a FLOAT token.
@@ -114,12 +116,6 @@ func (l *Lexer) parseLiteral(t token.TokenType, text string) any {
 		}
 	case token.NULL:
 		return nil
-	case token.STRING, token.RAW_STRING:
-		unquoted, err := strconv.Unquote(text)
-		if err != nil {
-			return text
-		}
-		return unquoted
 	}
 	return text
 }
@@ -129,95 +125,6 @@ func (l *Lexer) scanInteger() token.Token {
 	return l.createToken(token.INTEGER)
 }
 
-// scanString processes double-quoted string literals.
-// String interpolation is not supported in double-quoted strings.
-func (l *Lexer) scanString() token.Token {
-	return l.createToken(token.STRING)
-}
-
-// scanRawString processes raw strings (enclosed in backticks) with support for interpolation.
-func (l *Lexer) scanRawString() token.Token {
-	text := l.text()
-	if !l.hasInterpolation(text) {
-		return l.createToken(token.RAW_STRING)
-	}
-
-	// Process interpolation
-	tokens := l.processInterpolations(text)
-	// Add all tokens except the last one
-	for i := 0; i < len(tokens)-1; i++ {
-		l.addToken(tokens[i])
-	}
-	// Return the last token
-	return tokens[len(tokens)-1]
-}
-
-// hasInterpolation checks if the given text contains any interpolation expressions (${})
-// or template expressions (@{}). Returns true if either type of expression is found.
-func (l *Lexer) hasInterpolation(text string) bool {
-	return strings.Contains(text, "${") || strings.Contains(text, "@{")
-}
-
-// processInterpolations breaks down a raw string containing interpolations into a sequence of tokens.
-func (l *Lexer) processInterpolations(text string) []token.Token {
-	var tokens []token.Token
-	currentText := text[1 : len(text)-1] // Trim opening and closing quotes
-
-	for {
-		interpIndex := strings.Index(currentText, "${")
-		macroIndex := strings.Index(currentText, "@{")
-
-		if interpIndex == -1 && macroIndex == -1 {
-			if currentText != "" {
-				tokens = append(tokens, token.New(l.position(), token.RAW_STRING, currentText, currentText))
-			}
-			break
-		}
-
-		startIndex, tokenType := l.findNextInterpolation(interpIndex, macroIndex)
-
-		if startIndex > 0 {
-			tokens = append(tokens, token.New(l.position(), token.RAW_STRING, currentText[:startIndex], currentText[:startIndex]))
-		}
-
-		exprStart := startIndex + 2
-		exprEnd := strings.Index(currentText[exprStart:], "}")
-		if exprEnd == -1 {
-			l.addError("Unclosed interpolation or template")
-			break
-		}
-		exprEnd += exprStart
-
-		tokens = append(tokens, token.New(l.position(), tokenType, currentText[exprStart:exprEnd], currentText[exprStart:exprEnd]))
-		currentText = currentText[exprEnd+1:]
-	}
-
-	return tokens
-}
-
-// findNextInterpolation determines which type of expression (interpolation or template)
-// appears first in the text based on their indices. Returns:
-// - The starting index of the first expression
-// - The appropriate token type (INTERPOLATION for ${} or TEMPLATE for @{})
-func (l *Lexer) findNextInterpolation(interpIndex, macroIndex int) (int, token.TokenType) {
-	startIndex := -1
-	tokenType := token.INTERPOLATION
-
-	if interpIndex == -1 {
-		startIndex = macroIndex
-		tokenType = token.TEMPLATE
-	} else if macroIndex == -1 {
-		startIndex = interpIndex
-	} else if macroIndex < interpIndex {
-		startIndex = macroIndex
-		tokenType = token.TEMPLATE
-	} else {
-		startIndex = interpIndex
-	}
-
-	return startIndex, tokenType
-}
-
 // scanIdentifier processes identifiers and keywords.
 // Returns an IDENTIFIER token or corresponding keyword token.
 func (l *Lexer) scanIdentifier() token.Token {
@@ -234,7 +141,8 @@ func (l *Lexer) scan() token.Token {
 	pos := l.position()
 
 	if ch == scanner.EOF {
-		return l.createToken(token.EOF)
+		// The end of the input is where the source text stops.
+		return token.New(l.nextPosition(), token.EOF, "", "")
 	}
 
 	switch ch {
@@ -242,48 +150,15 @@ func (l *Lexer) scan() token.Token {
 		return l.scanFloat()
 	case scanner.Int:
 		return l.scanInteger()
-	case '\'':
-		return l.scanSingleQuotedString()
-	case scanner.String:
-		return l.scanString()
-	case scanner.RawString:
-		t := l.scanRawString()
-		// Не добавляем токен здесь, так как он уже добавлен в scanRawString
-		return t
+	case '"', '\'', '`':
+		return l.scanString(ch)
 	case scanner.Ident:
 		return l.scanIdentifier()
 	default:
 		if ch < 0 {
-			l.addError(fmt.Sprintf("Unexpected character: %v", ch))
+			l.addError(diagnostic.ErrInvalidToken, pos, fmt.Sprintf("unexpected character: %v", ch))
 			return token.New(pos, token.ILLEGAL, string(ch), string(ch))
 		}
 		return l.scanOperator(ch, pos)
 	}
 }
-
-// scanSingleQuotedString processes single-quoted string literals.
-func (l *Lexer) scanSingleQuotedString() token.Token {
-	var builder strings.Builder
-	pos := l.position()
-
-	for !l.isAtEnd() {
-		ch := l.next()
-		if ch == '\'' {
-			break
-		}
-		if ch == '\\' {
-			// Handle escaped characters
-			next := l.next()
-			if next == '\'' {
-				builder.WriteRune('\'')
-			} else {
-				builder.WriteRune('\\')
-				builder.WriteRune(next)
-			}
-		} else {
-			builder.WriteRune(ch)
-		}
-	}
-
-	return token.New(pos, token.STRING, builder.String(), builder.String())
-}
@@ -0,0 +1,195 @@
+// Package lexer implements lexical analysis for the Sludge programming language.
+package lexer
+
+import (
+	"strconv"
+	"strings"
+	"text/scanner"
+
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/token"
+)
+
+// stringPart is a piece of a string literal: literal text followed by the
+// source of an embedded ${...} expression. The last part of a literal has
+// no expression.
+type stringPart struct {
+	text    string         // Raw literal text, escapes not yet processed
+	expr    string         // Source of the embedded expression
+	exprPos token.Position // Position of the first character of expr
+}
+
+// scanString processes string literals in all three quote styles: "double",
+// 'single' and `raw`. Each of them may embed expressions as ${...}.
+//
+// A literal without expressions becomes a single STRING (or RAW_STRING for
+// backticks) token. Otherwise every text part that precedes an expression
+// becomes an INTERPOLATION token followed by the tokens of the expression,
+// and the text after the last expression becomes the closing STRING or
+// RAW_STRING token, so `a ${x} b` is lexed as INTERPOLATION("a ") x RAW_STRING(" b").
+func (l *Lexer) scanString(quote rune) token.Token {
+	pos := l.position()
+	parts, closed := l.scanStringParts(quote)
+	if !closed {
+		l.addError(diagnostic.ErrUnterminated, pos, "unterminated string literal")
+	}
+
+	ttype := token.STRING
+	if quote == '`' {
+		ttype = token.RAW_STRING
+	}
+
+	for _, part := range parts[:len(parts)-1] {
+		l.addToken(token.New(pos, token.INTERPOLATION, part.text, unescape(part.text, quote)))
+		l.addTokens(l.scanEmbedded(part.expr, part.exprPos))
+	}
+	last := parts[len(parts)-1].text
+	if len(parts) == 1 {
+		last = string(quote) + last + string(quote)
+	}
+	return token.New(pos, ttype, last, unescape(parts[len(parts)-1].text, quote))
+}
+
+// scanStringParts reads a string literal whose opening quote has already
+// been consumed, splitting it at embedded expressions. It reports whether
+// the closing quote was found.
+func (l *Lexer) scanStringParts(quote rune) ([]stringPart, bool) {
+	parts := []stringPart{}
+	text := &strings.Builder{}
+	for {
+		ch := l.next()
+		switch {
+		case ch == scanner.EOF:
+			return append(parts, stringPart{text: text.String()}), false
+		case ch == quote:
+			return append(parts, stringPart{text: text.String()}), true
+		case ch == '\\' && quote != '`':
+			text.WriteRune(ch)
+			if l.peek() != scanner.EOF {
+				text.WriteRune(l.next())
+			}
+		case ch == '$' && l.peek() == '{':
+			l.next()
+			exprPos := l.nextPosition()
+			expr := &strings.Builder{}
+			if !l.copyEmbedded(expr) {
+				return append(parts, stringPart{text: text.String()}), false
+			}
+			parts = append(parts, stringPart{
+				text:    text.String(),
+				expr:    expr.String(),
+				exprPos: exprPos,
+			})
+			text.Reset()
+		default:
+			text.WriteRune(ch)
+		}
+	}
+}
+
+// copyEmbedded copies the source of an embedded expression into b, up to
+// and excluding the '}' that closes it. Nested braces and string literals,
+// including their own embedded expressions, are copied as they are.
+func (l *Lexer) copyEmbedded(b *strings.Builder) bool {
+	depth := 0
+	for {
+		ch := l.next()
+		switch ch {
+		case scanner.EOF:
+			return false
+		case '{':
+			depth++
+		case '}':
+			if depth == 0 {
+				return true
+			}
+			depth--
+		case '"', '\'', '`':
+			b.WriteRune(ch)
+			if !l.copyQuoted(ch, b) {
+				return false
+			}
+			continue
+		}
+		b.WriteRune(ch)
+	}
+}
+
+// copyQuoted copies a string literal nested inside an embedded expression
+// into b, including its closing quote.
+func (l *Lexer) copyQuoted(quote rune, b *strings.Builder) bool {
+	for {
+		ch := l.next()
+		switch {
+		case ch == scanner.EOF:
+			return false
+		case ch == quote:
+			b.WriteRune(ch)
+			return true
+		case ch == '\\' && quote != '`':
+			b.WriteRune(ch)
+			if l.peek() != scanner.EOF {
+				b.WriteRune(l.next())
+			}
+		case ch == '$' && l.peek() == '{':
+			b.WriteString("${")
+			l.next()
+			if !l.copyEmbedded(b) {
+				return false
+			}
+			b.WriteRune('}')
+		default:
+			b.WriteRune(ch)
+		}
+	}
+}
+
+// scanEmbedded lexes the source of an embedded expression into tokens whose
+// positions point into the enclosing source text.
+func (l *Lexer) scanEmbedded(source string, start token.Position) []token.Token {
+	embedded := NewFile(strings.NewReader(source), l.scanner.Filename)
+	tokens := embedded.ScanTokens()
+	for _, err := range embedded.errors {
+		d := err.(diagnostic.Diagnostic)
+		shift(&d.Span.Start, start)
+		shift(&d.Span.End, start)
+		l.hadError = true
+		l.errors = append(l.errors, d)
+	}
+
+	tokens = tokens[:len(tokens)-1] // Drop EOF
+	for i := range tokens {
+		shift(&tokens[i].Position, start)
+	}
+	return tokens
+}
+
+// shift moves pos, a position in the source of an embedded expression, to
+// the enclosing source text, where the expression starts at start.
+func shift(pos *token.Position, start token.Position) {
+	if pos.Line == 1 {
+		pos.Column += start.Column - 1
+	}
+	pos.Line += start.Line - 1
+	pos.Offset += start.Offset
+}
+
+// unescape returns the value of the raw text of a string literal. Raw
+// strings are taken as they are. Single-quoted strings only unescape
+// quotes, double-quoted strings follow Go's escape rules, and both turn
+// "\$" into "$" so that "\${" can be written literally.
+func unescape(text string, quote rune) string {
+	switch quote {
+	case '`':
+		return text
+	case '\'':
+		return strings.NewReplacer(`\'`, `'`, `\$`, `$`).Replace(text)
+	default:
+		text = strings.ReplaceAll(text, `\$`, `$`)
+		unquoted, err := strconv.Unquote(`"` + text + `"`)
+		if err != nil {
+			return text
+		}
+		return unquoted
+	}
+}
@@ -0,0 +1,148 @@
+// Package lexer implements lexical analysis for the Sludge programming language.
+package lexer
+
+import (
+	"strings"
+	"text/scanner"
+
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/token"
+)
+
+// ScanTemplate performs the lexical analysis of a text template: literal
+// text with embedded ${ expression } and @{ statements } regions.
+//
+// A run of text and ${...} regions is lexed like an interpolated string:
+// every piece of text followed by an expression becomes an INTERPOLATION
+// token and the expression's tokens, and the text that ends the run becomes
+// a TEMPLATE token. The tokens of @{...} regions are emitted as they are,
+// except for regions that structure the text around them:
+//
+//	@{ for (...) }, @{ while (...) }, @{ if (...) }  open a block
+//	@{ else }, @{ else if (...) }                    continue an if
+//	@{ end }                                         close a block
+//
+// A @{...} region that is alone on its line removes the whole line from the
+// output, so it doesn't leave an empty line behind.
+func (l *Lexer) ScanTemplate() []token.Token {
+	run := []stringPart{}
+	text := &strings.Builder{}
+	textPos := l.nextPosition()
+	lineStart := true // Only whitespace so far on the current line
+
+	flush := func() {
+		if len(run) == 0 && text.Len() == 0 {
+			return
+		}
+		for _, part := range run {
+			l.addToken(token.New(textPos, token.INTERPOLATION, part.text, part.text))
+			l.addTokens(l.scanEmbedded(part.expr, part.exprPos))
+		}
+		l.addToken(token.New(textPos, token.TEMPLATE, text.String(), text.String()))
+		run = run[:0]
+		text.Reset()
+	}
+
+	for {
+		ch := l.next()
+		switch {
+		case ch == scanner.EOF:
+			flush()
+			l.addToken(token.New(l.nextPosition(), token.EOF, "", ""))
+			return l.tokens
+		case (ch == '$' || ch == '@') && l.peek() == '{':
+			l.next()
+			start := l.nextPosition()
+			code := &strings.Builder{}
+			if !l.copyEmbedded(code) {
+				l.addError(diagnostic.ErrUnterminated, start, "unclosed template region")
+				flush()
+				l.addToken(token.New(l.nextPosition(), token.EOF, "", ""))
+				return l.tokens
+			}
+			if ch == '$' {
+				run = append(run, stringPart{text: text.String(), expr: code.String(), exprPos: start})
+				text.Reset()
+				lineStart = false
+				continue
+			}
+
+			trailing := l.skipSpaces()
+			if lineStart && (l.peek() == '\n' || l.peek() == scanner.EOF) {
+				l.next()
+				indented := text.String()
+				text.Reset()
+				text.WriteString(indented[:strings.LastIndex(indented, "\n")+1])
+				trailing = ""
+			}
+			flush()
+			l.addTokens(l.templateCode(code.String(), start))
+			textPos = l.nextPosition()
+			text.WriteString(trailing)
+			lineStart = trailing == "" && l.peek() != scanner.EOF && textPos.Column == 1
+		default:
+			text.WriteRune(ch)
+			if ch == '\n' {
+				lineStart = true
+			} else if ch != ' ' && ch != '\t' {
+				lineStart = false
+			}
+		}
+	}
+}
+
+// skipSpaces consumes spaces and tabs and returns them.
+func (l *Lexer) skipSpaces() string {
+	b := &strings.Builder{}
+	for l.peek() == ' ' || l.peek() == '\t' {
+		b.WriteRune(l.next())
+	}
+	return b.String()
+}
+
+// templateCode lexes the source of a @{...} region, adding the braces that
+// let block headers, "else" and "end" span the text between regions.
+func (l *Lexer) templateCode(source string, start token.Position) []token.Token {
+	tokens := l.scanEmbedded(source, start)
+	open := token.New(start, token.LEFT_BRACE, "{", "{")
+	closing := token.New(start, token.RIGHT_BRACE, "}", "}")
+
+	switch {
+	case len(tokens) == 1 && tokens[0].Type == token.IDENTIFIER && tokens[0].Lexeme == "end":
+		return []token.Token{closing}
+	case len(tokens) == 1 && tokens[0].Type == token.ELSE:
+		return []token.Token{closing, tokens[0], open}
+	case len(tokens) > 1 && tokens[0].Type == token.ELSE && isBlockHeader(tokens[1:]):
+		return append(append([]token.Token{closing}, tokens...), open)
+	case isBlockHeader(tokens):
+		return append(tokens, open)
+	default:
+		return tokens
+	}
+}
+
+// isBlockHeader reports whether tokens are an if, for or while header
+// without a body: the keyword and a parenthesized clause ending the region.
+func isBlockHeader(tokens []token.Token) bool {
+	if len(tokens) < 3 || tokens[1].Type != token.LEFT_PAREN {
+		return false
+	}
+	switch tokens[0].Type {
+	case token.IF, token.FOR, token.WHILE:
+	default:
+		return false
+	}
+	depth := 0
+	for i, t := range tokens[1:] {
+		switch t.Type {
+		case token.LEFT_PAREN:
+			depth++
+		case token.RIGHT_PAREN:
+			depth--
+			if depth == 0 {
+				return i == len(tokens)-2
+			}
+		}
+	}
+	return false
+}
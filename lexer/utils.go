@@ -2,22 +2,12 @@
 package lexer
 
 import (
-	"fmt"
 	"text/scanner"
 
+	"github.com/Toolnado/sludge/diagnostic"
 	"github.com/Toolnado/sludge/token"
 )
 
-// stringPosition returns a formatted string containing the current position in the source code
-// in the format "filename:line:column". If no filename is set, returns "<input>:line:column".
-func (l *Lexer) stringPosition() string {
-	filename := l.scanner.Position.Filename
-	if filename == "" {
-		filename = "<input>"
-	}
-	return fmt.Sprintf("%s:%d:%d", filename, l.scanner.Position.Line, l.scanner.Position.Column)
-}
-
 // peek returns the next rune in the input without advancing the scanner.
 func (l *Lexer) peek() rune {
 	return l.scanner.Peek()
@@ -42,11 +32,24 @@ func (l *Lexer) isAtEnd() bool {
 func (l *Lexer) position() token.Position {
 	return token.Position{
 		Filename: l.scanner.Position.Filename,
+		Offset:   l.scanner.Position.Offset,
 		Line:     l.scanner.Position.Line,
 		Column:   l.scanner.Position.Column,
 	}
 }
 
+// nextPosition returns the position of the character following the last one
+// read by next, which is where the next piece of source text starts.
+func (l *Lexer) nextPosition() token.Position {
+	pos := l.scanner.Pos()
+	return token.Position{
+		Filename: pos.Filename,
+		Offset:   pos.Offset,
+		Line:     pos.Line,
+		Column:   pos.Column,
+	}
+}
+
 // text returns the string value of the current token.
 func (l *Lexer) text() string {
 	return l.scanner.TokenText()
@@ -57,13 +60,17 @@ func (l *Lexer) addToken(t token.Token) {
 	l.tokens = append(l.tokens, t)
 }
 
-// addError adds a new error to the lexer's error list and sets the error flag.
-// The error message includes the current position in the source code.
-func (l *Lexer) addError(msg string) {
-	if !l.hadError {
-		l.hadError = true
-	}
-	l.errors = append(l.errors, fmt.Errorf("[%s] --> lexer error: %s", l.stringPosition(), msg))
+// addTokens appends several tokens to the lexer's token list.
+func (l *Lexer) addTokens(tokens []token.Token) {
+	l.tokens = append(l.tokens, tokens...)
+}
+
+// addError adds a diagnostic of kind about the source text from start up to
+// the character following the last one read, and sets the error flag.
+func (l *Lexer) addError(kind *diagnostic.Kind, start token.Position, msg string) {
+	l.hadError = true
+	span := diagnostic.Span{Start: start, End: l.nextPosition()}
+	l.errors = append(l.errors, diagnostic.New(kind, msg, span))
 }
 
 // substring returns the content of a string literal without the surrounding quotes.
@@ -1,32 +1,151 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
 	"log"
+	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/Toolnado/sludge/closure"
+	"github.com/Toolnado/sludge/diagnostic"
 	"github.com/Toolnado/sludge/interpreter"
 	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/optimizer"
 	"github.com/Toolnado/sludge/parser"
+	"github.com/Toolnado/sludge/resolver"
+	"github.com/Toolnado/sludge/vm"
 )
 
+// backend selects what runs programs: the tree-walking interpreter, the
+// bytecode vm or the closure compiler. All give the same output and errors.
+var backend = flag.String("backend", "tree", "backend that runs programs: tree, vm or closure")
+
+// optimize makes programs go through the optimizer before they run.
+var optimize = flag.Bool("optimize", false, "fold constants and remove dead code before running")
+
+// maxDepth limits how many calls can run at once before a stack overflow.
+// Only the vm, which doesn't recurse on the Go stack, allows more than
+// interpreter.MaxRecursiveCallDepth.
+var maxDepth = flag.Int("max-depth", interpreter.DefaultMaxCallDepth, "how many nested calls programs can make")
+
+// color makes errors be shown with ANSI colors, for terminals.
+var color = flag.Bool("color", false, "color error messages")
+
+// tailCalls makes functions call the function whose result they return in
+// their own place. Turning it off keeps all the calls on the call stack.
+var tailCalls = flag.Bool("tail-calls", true, "run calls in tail position without nesting them")
+
 func main() {
-	l := lexer.New(strings.NewReader(`
+	flag.Parse()
+	if *backend != "tree" && *backend != "vm" && *backend != "closure" {
+		log.Fatalf("unknown backend %q", *backend)
+	}
+	if *backend != "vm" && *maxDepth > interpreter.MaxRecursiveCallDepth {
+		log.Fatalf("-max-depth can be at most %d with -backend %s, use -backend vm for deeper calls",
+			interpreter.MaxRecursiveCallDepth, *backend)
+	}
+	if flag.NArg() > 0 {
+		runFile(flag.Arg(0))
+		return
+	}
+
+	run(strings.NewReader(`
 		function sayHi(first, last) {
 			print "Hi, " + first + " " + last + "!";
 		}
 
 		sayHi("Dear", "Reader");
-	`))
-	t := l.ScanTokens()
-	p := parser.New(t)
-	stmts, err := p.Parse()
+	`), "", ".")
+}
+
+// runFile runs a script from disk. Modules it imports are resolved
+// relative to the directory of the script.
+func runFile(path string) {
+	f, err := os.Open(path)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer f.Close()
+
+	run(f, filepath.Base(path), filepath.Dir(path))
+}
+
+// run runs a program, loading the modules it imports from root. Errors
+// are shown with the source lines they point at.
+func run(r io.Reader, filename, root string) {
+	source, err := io.ReadAll(r)
 	if err != nil {
 		log.Println(err)
 		return
 	}
-	i := interpreter.New()
+	loader := interpreter.NewFileLoader(root)
+	files := diagnostic.NewFileSet(loader.Load)
+	files.Add(filename, source)
+	renderer := diagnostic.NewRenderer(files, diagnostic.WithColor(*color))
+
+	l := lexer.NewFile(bytes.NewReader(source), filename)
+	t := l.ScanTokens()
+	errs := l.Errors()
+	stmts, err := parser.New(t).Parse()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		report(renderer, errors.Join(errs...))
+		return
+	}
+	if *optimize {
+		// The code the optimizer removes is checked by the resolver first.
+		if err := resolver.New(interpreter.Builtins().Names()...).Resolve(stmts); err != nil {
+			report(renderer, err)
+			return
+		}
+		stmts = optimizer.Optimize(stmts)
+	}
+	switch *backend {
+	case "vm":
+		v := vm.New(vm.WithLoader(loader), vm.WithMaxCallDepth(*maxDepth), vm.WithTailCalls(*tailCalls))
+		f, err := v.Compile(stmts)
+		if err != nil {
+			report(renderer, err)
+			return
+		}
+		if err := v.Run(f); err != nil {
+			report(renderer, err)
+		}
+		return
+	case "closure":
+		c := closure.New(closure.WithLoader(loader), closure.WithMaxCallDepth(*maxDepth), closure.WithTailCalls(*tailCalls))
+		p, err := c.Compile(stmts)
+		if err != nil {
+			report(renderer, err)
+			return
+		}
+		if err := c.Run(p); err != nil {
+			report(renderer, err)
+		}
+		return
+	}
+
+	i := interpreter.New(interpreter.WithLoader(loader), interpreter.WithMaxCallDepth(*maxDepth), interpreter.WithTailCalls(*tailCalls))
+	if err := i.Resolve(stmts); err != nil {
+		report(renderer, err)
+		return
+	}
 	_, err = i.Interpret(stmts)
 	if err != nil {
+		report(renderer, err)
+	}
+}
+
+// report shows err on the standard error.
+func report(renderer *diagnostic.Renderer, err error) {
+	if werr := renderer.Render(os.Stderr, err); werr != nil {
 		log.Println(err)
 	}
 }
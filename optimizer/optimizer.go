@@ -0,0 +1,438 @@
+// Package optimizer rewrites the syntax tree of a Sludge program before it
+// runs, so that the backends don't repeat work whose result is known in
+// advance. It folds operators applied to literals, drops the branches of
+// conditionals that can't be taken and removes the statements that follow
+// a return, break, continue or throw.
+//
+// The rewritten program gives the same output and errors as the original.
+// Operations that would fail, such as a division by zero, are left for the
+// backend to report.
+package optimizer
+
+import (
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/token"
+)
+
+type optimizer struct{}
+
+// Optimize rewrites a program or module in place and returns its new
+// statements. The code it removes is no longer checked by the resolver, so
+// a program should be resolved before it is optimized.
+func Optimize(stmts []ast.Stmt) []ast.Stmt {
+	o := &optimizer{}
+	return o.statements(stmts)
+}
+
+// statements optimizes a list of statements. The statements that follow a
+// return, break, continue or throw can't run and only their declarations
+// are kept.
+func (o *optimizer) statements(stmts []ast.Stmt) []ast.Stmt {
+	optimized := make([]ast.Stmt, 0, len(stmts))
+	for indx, stmt := range stmts {
+		stmt = o.statement(stmt)
+		if stmt == nil {
+			continue
+		}
+		optimized = append(optimized, stmt)
+		switch stmt.(type) {
+		case *ast.ReturnStmt, *ast.BreakStmt, *ast.ContinueStmt, *ast.ThrowStmt:
+			return append(optimized, unreachable(stmts[indx+1:])...)
+		}
+	}
+	return optimized
+}
+
+// statement optimizes a statement, returning nil if nothing is left of
+// it.
+func (o *optimizer) statement(stmt ast.Stmt) ast.Stmt {
+	if s, ok := stmt.(*ast.IfStmt); ok {
+		return o.ifStmt(s)
+	}
+	optimized, _ := stmt.Accept(o)
+	if optimized == nil {
+		return nil
+	}
+	return optimized.(ast.Stmt)
+}
+
+// branch optimizes the branch of a conditional or the body of a loop,
+// which can't be left out.
+func (o *optimizer) branch(stmt ast.Stmt) ast.Stmt {
+	if optimized := o.statement(stmt); optimized != nil {
+		return optimized
+	}
+	return ast.NewBlockStmt(nil)
+}
+
+func (o *optimizer) expression(expr ast.Expr) ast.Expr {
+	optimized, _ := expr.Accept(o)
+	return optimized.(ast.Expr)
+}
+
+func (o *optimizer) expressions(exprs []ast.Expr) {
+	for indx, expr := range exprs {
+		exprs[indx] = o.expression(expr)
+	}
+}
+
+// optional optimizes an expression that may be nil.
+func (o *optimizer) optional(expr ast.Expr) ast.Expr {
+	if expr == nil {
+		return nil
+	}
+	return o.expression(expr)
+}
+
+// ifStmt optimizes a conditional. If its condition is a literal, only the
+// branch that is taken is left, or nil if there is none.
+func (o *optimizer) ifStmt(stmt *ast.IfStmt) ast.Stmt {
+	stmt.Condition = o.expression(stmt.Condition)
+	condition, ok := constant(stmt.Condition)
+	if !ok {
+		stmt.ThenBranch = o.branch(stmt.ThenBranch)
+		if stmt.ElseBranch != nil {
+			stmt.ElseBranch = o.branch(stmt.ElseBranch)
+		}
+		return stmt
+	}
+
+	taken, dropped := stmt.ThenBranch, stmt.ElseBranch
+	if !interpreter.IsTruthy(condition) {
+		taken, dropped = dropped, taken
+	}
+	if taken != nil {
+		taken = o.statement(taken)
+	}
+	var kept []ast.Stmt
+	if dropped != nil {
+		kept = unreachable([]ast.Stmt{dropped})
+	}
+	if len(kept) == 0 {
+		return taken
+	}
+	if taken != nil {
+		kept = append([]ast.Stmt{taken}, kept...)
+	}
+	return ast.NewBlockStmt(kept)
+}
+
+// unreachable returns what is left of statements that can't run: their
+// declarations, which still decide what the names around them refer to.
+// Var declarations nested in other statements belong to the enclosing
+// function and are kept without their initializer.
+func unreachable(stmts []ast.Stmt) []ast.Stmt {
+	var kept []ast.Stmt
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case *ast.VarStmt, *ast.FunctionStmt, *ast.ClassStmt, *ast.RecordStmt, *ast.ImportStmt:
+			kept = append(kept, stmt)
+			continue
+		}
+		for _, v := range ast.HoistedVars([]ast.Stmt{stmt}) {
+			kept = append(kept, ast.NewVarStmt(v.Keyword, v.Name, nil))
+		}
+	}
+	return kept
+}
+
+// constant returns the value of expr if it is a literal.
+func constant(expr ast.Expr) (any, bool) {
+	if literal, ok := expr.(*ast.LiteralExpr); ok {
+		return literal.Value, true
+	}
+	return nil, false
+}
+
+// isStatement reports whether expr is one of the statements the parser
+// accepts where an expression is expected.
+func isStatement(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.BlockStmt, *ast.IfStmt, *ast.WhileStmt:
+		return true
+	default:
+		return false
+	}
+}
+
+func (o *optimizer) VisitPrintStmt(stmt *ast.PrintStmt) (any, error) {
+	stmt.Expession = o.expression(stmt.Expession)
+	return stmt, nil
+}
+
+func (o *optimizer) VisitEmitStmt(stmt *ast.EmitStmt) (any, error) {
+	stmt.Value = o.expression(stmt.Value)
+	return stmt, nil
+}
+
+// VisitExprStmt optimizes an expression statement. A conditional used as a
+// statement is replaced by what is left of it.
+func (o *optimizer) VisitExprStmt(stmt *ast.ExprStmt) (any, error) {
+	if s, ok := stmt.Expession.(*ast.IfStmt); ok {
+		optimized := o.ifStmt(s)
+		if optimized == nil {
+			return nil, nil
+		}
+		if isStatement(optimized) {
+			stmt.Expession = optimized
+			return stmt, nil
+		}
+		return optimized, nil
+	}
+	stmt.Expession = o.expression(stmt.Expession)
+	return stmt, nil
+}
+
+func (o *optimizer) VisitVarStmt(stmt *ast.VarStmt) (any, error) {
+	stmt.Initializer = o.optional(stmt.Initializer)
+	return stmt, nil
+}
+
+func (o *optimizer) VisitBlockStmt(stmt *ast.BlockStmt) (any, error) {
+	stmt.Statements = o.statements(stmt.Statements)
+	return stmt, nil
+}
+
+// VisitIfStmt optimizes a conditional used as an expression, which has to
+// stay a block, conditional or loop.
+func (o *optimizer) VisitIfStmt(stmt *ast.IfStmt) (any, error) {
+	switch s := o.ifStmt(stmt).(type) {
+	case nil:
+		return ast.NewBlockStmt(nil), nil
+	case *ast.BlockStmt, *ast.IfStmt:
+		return s, nil
+	case *ast.ExprStmt:
+		if isStatement(s.Expession) {
+			return s.Expession, nil
+		}
+		return ast.NewBlockStmt([]ast.Stmt{s}), nil
+	default:
+		return ast.NewBlockStmt([]ast.Stmt{s}), nil
+	}
+}
+
+func (o *optimizer) VisitWhileStmt(stmt *ast.WhileStmt) (any, error) {
+	stmt.Condition = o.expression(stmt.Condition)
+	stmt.Body = o.branch(stmt.Body)
+	stmt.Increment = o.optional(stmt.Increment)
+	return stmt, nil
+}
+
+func (o *optimizer) VisitFunctionStmt(stmt *ast.FunctionStmt) (any, error) {
+	stmt.Body = o.statements(stmt.Body)
+	return stmt, nil
+}
+
+func (o *optimizer) VisitReturnStmt(stmt *ast.ReturnStmt) (any, error) {
+	stmt.Value = o.optional(stmt.Value)
+	return stmt, nil
+}
+
+func (o *optimizer) VisitBreakStmt(stmt *ast.BreakStmt) (any, error) {
+	return stmt, nil
+}
+
+func (o *optimizer) VisitContinueStmt(stmt *ast.ContinueStmt) (any, error) {
+	return stmt, nil
+}
+
+func (o *optimizer) VisitThrowStmt(stmt *ast.ThrowStmt) (any, error) {
+	stmt.Value = o.expression(stmt.Value)
+	return stmt, nil
+}
+
+func (o *optimizer) VisitTryStmt(stmt *ast.TryStmt) (any, error) {
+	stmt.Body = o.statements(stmt.Body)
+	stmt.Catch = o.statements(stmt.Catch)
+	if stmt.Finally != nil {
+		stmt.Finally = o.statements(stmt.Finally)
+	}
+	return stmt, nil
+}
+
+func (o *optimizer) VisitClassStmt(stmt *ast.ClassStmt) (any, error) {
+	for _, method := range stmt.Methods {
+		method.Body = o.statements(method.Body)
+	}
+	return stmt, nil
+}
+
+func (o *optimizer) VisitRecordStmt(stmt *ast.RecordStmt) (any, error) {
+	return stmt, nil
+}
+
+func (o *optimizer) VisitImportStmt(stmt *ast.ImportStmt) (any, error) {
+	return stmt, nil
+}
+
+// VisitLogicalExpr drops the operands of "&&" and "||" that are known not
+// to decide the result.
+func (o *optimizer) VisitLogicalExpr(expr *ast.LogicalExpr) (any, error) {
+	expr.Left = o.expression(expr.Left)
+	expr.Right = o.expression(expr.Right)
+	left, ok := constant(expr.Left)
+	if !ok {
+		return expr, nil
+	}
+	if interpreter.IsTruthy(left) == (expr.Operator.Type == token.OR) {
+		return expr.Left, nil
+	}
+	return expr.Right, nil
+}
+
+func (o *optimizer) VisitCallExpr(expr *ast.CallExpr) (any, error) {
+	expr.Callee = o.expression(expr.Callee)
+	o.expressions(expr.Arguments)
+	return expr, nil
+}
+
+// VisitBinaryExpr folds an arithmetic operator or comparison applied to two
+// literals, unless it fails.
+func (o *optimizer) VisitBinaryExpr(expr *ast.BinaryExpr) (any, error) {
+	expr.Left = o.expression(expr.Left)
+	expr.Right = o.expression(expr.Right)
+	left, ok := constant(expr.Left)
+	if !ok {
+		return expr, nil
+	}
+	right, ok := constant(expr.Right)
+	if !ok {
+		return expr, nil
+	}
+
+	var value any
+	var err error
+	switch expr.Operator.Type {
+	case token.PLUS:
+		value, err = interpreter.Add(left, right)
+	case token.MINUS, token.STAR, token.SLASH, token.PERCENT:
+		value, err = interpreter.Arithmetic(expr.Operator.Type, left, right)
+	case token.EQUAL_EQUAL, token.BANG_EQUAL,
+		token.GREATER, token.GREATER_EQUAL,
+		token.LESS, token.LESS_EQUAL:
+		value, err = interpreter.Compare(expr.Operator.Type, left, right)
+	default:
+		return expr, nil
+	}
+	if err != nil {
+		return expr, nil
+	}
+	return ast.NewLiteralExpr(value), nil
+}
+
+// VisitUnaryExpr folds a negation or "!" applied to a literal, unless it
+// fails.
+func (o *optimizer) VisitUnaryExpr(expr *ast.UnaryExpr) (any, error) {
+	expr.Right = o.expression(expr.Right)
+	right, ok := constant(expr.Right)
+	if !ok {
+		return expr, nil
+	}
+	switch expr.Operator.Type {
+	case token.MINUS:
+		value, err := interpreter.Negate(right)
+		if err != nil {
+			return expr, nil
+		}
+		return ast.NewLiteralExpr(value), nil
+	case token.BANG:
+		return ast.NewLiteralExpr(!interpreter.IsTruthy(right)), nil
+	default:
+		return expr, nil
+	}
+}
+
+func (o *optimizer) VisitLiteralExpr(expr *ast.LiteralExpr) (any, error) {
+	return expr, nil
+}
+
+// VisitGroupingExpr leaves out the parentheses around a literal.
+func (o *optimizer) VisitGroupingExpr(expr *ast.GroupingExpr) (any, error) {
+	expr.Expession = o.expression(expr.Expession)
+	if _, ok := constant(expr.Expession); ok {
+		return expr.Expession, nil
+	}
+	return expr, nil
+}
+
+func (o *optimizer) VisitVariableExpr(expr *ast.VariableExpr) (any, error) {
+	return expr, nil
+}
+
+func (o *optimizer) VisitAssignExpr(expr *ast.AssignExpr) (any, error) {
+	expr.Value = o.expression(expr.Value)
+	return expr, nil
+}
+
+func (o *optimizer) VisitCompoundAssignExpr(expr *ast.CompoundAssignExpr) (any, error) {
+	expr.Target = o.expression(expr.Target)
+	expr.Value = o.expression(expr.Value)
+	return expr, nil
+}
+
+func (o *optimizer) VisitFunctionExpr(expr *ast.FunctionExpr) (any, error) {
+	expr.Body = o.statements(expr.Body)
+	return expr, nil
+}
+
+func (o *optimizer) VisitListExpr(expr *ast.ListExpr) (any, error) {
+	o.expressions(expr.Elements)
+	return expr, nil
+}
+
+func (o *optimizer) VisitIndexExpr(expr *ast.IndexExpr) (any, error) {
+	expr.Object = o.expression(expr.Object)
+	expr.Index = o.expression(expr.Index)
+	return expr, nil
+}
+
+func (o *optimizer) VisitSliceExpr(expr *ast.SliceExpr) (any, error) {
+	expr.Object = o.expression(expr.Object)
+	expr.Start = o.optional(expr.Start)
+	expr.End = o.optional(expr.End)
+	return expr, nil
+}
+
+func (o *optimizer) VisitIndexSetExpr(expr *ast.IndexSetExpr) (any, error) {
+	expr.Object = o.expression(expr.Object)
+	expr.Index = o.expression(expr.Index)
+	expr.Value = o.expression(expr.Value)
+	return expr, nil
+}
+
+func (o *optimizer) VisitMapExpr(expr *ast.MapExpr) (any, error) {
+	o.expressions(expr.Keys)
+	o.expressions(expr.Values)
+	return expr, nil
+}
+
+func (o *optimizer) VisitGetExpr(expr *ast.GetExpr) (any, error) {
+	expr.Object = o.expression(expr.Object)
+	return expr, nil
+}
+
+func (o *optimizer) VisitSetExpr(expr *ast.SetExpr) (any, error) {
+	expr.Object = o.expression(expr.Object)
+	expr.Value = o.expression(expr.Value)
+	return expr, nil
+}
+
+func (o *optimizer) VisitThisExpr(expr *ast.ThisExpr) (any, error) {
+	return expr, nil
+}
+
+func (o *optimizer) VisitSuperExpr(expr *ast.SuperExpr) (any, error) {
+	return expr, nil
+}
+
+func (o *optimizer) VisitWithExpr(expr *ast.WithExpr) (any, error) {
+	expr.Object = o.expression(expr.Object)
+	o.expressions(expr.Values)
+	return expr, nil
+}
+
+func (o *optimizer) VisitInterpolationExpr(expr *ast.InterpolationExpr) (any, error) {
+	o.expressions(expr.Parts)
+	return expr, nil
+}
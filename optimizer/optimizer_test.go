@@ -0,0 +1,170 @@
+package optimizer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+	"github.com/Toolnado/sludge/token"
+)
+
+func parse(t *testing.T, input string) []ast.Stmt {
+	t.Helper()
+	stmts, err := parser.New(lexer.New(strings.NewReader(input)).ScanTokens()).Parse()
+	if err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	return stmts
+}
+
+// dump writes a node and its children, leaving out where the tokens are,
+// so that trees parsed from different sources can be compared.
+func dump(b *strings.Builder, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Interface, reflect.Pointer:
+		if v.IsNil() {
+			b.WriteString("nil")
+			return
+		}
+		dump(b, v.Elem())
+	case reflect.Slice:
+		b.WriteString("[")
+		for indx := 0; indx < v.Len(); indx++ {
+			if indx != 0 {
+				b.WriteString(" ")
+			}
+			dump(b, v.Index(indx))
+		}
+		b.WriteString("]")
+	case reflect.Struct:
+		if tok, ok := v.Interface().(token.Token); ok {
+			b.WriteString(tok.Lexeme)
+			return
+		}
+		b.WriteString(v.Type().Name())
+		b.WriteString("{")
+		for indx := 0; indx < v.NumField(); indx++ {
+			if indx != 0 {
+				b.WriteString(" ")
+			}
+			dump(b, v.Field(indx))
+		}
+		b.WriteString("}")
+	default:
+		fmt.Fprintf(b, "%T(%v)", v.Interface(), v.Interface())
+	}
+}
+
+func TestOptimize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string // Program the input should be optimized into
+	}{
+		{
+			name:     "arithmetic",
+			input:    "print 1 + 2 * (3 - 1);",
+			expected: "print 5;",
+		},
+		{
+			name:     "integer division gives a float",
+			input:    "print 7 / 2;",
+			expected: "print 3.5;",
+		},
+		{
+			name:     "strings",
+			input:    `print "a" + "b";`,
+			expected: `print "ab";`,
+		},
+		{
+			name:     "comparison and unary operators",
+			input:    "print !(1 < 2) == -1 > 0;",
+			expected: "print true;",
+		},
+		{
+			name:     "operands that aren't literals",
+			input:    "print x + 1 + 2;",
+			expected: "print x + 1 + 2;",
+		},
+		{
+			name:     "failing operations are left to run",
+			input:    "print 1 / 0; print -\"a\"; print 1 < \"a\";",
+			expected: "print 1 / 0; print -\"a\"; print 1 < \"a\";",
+		},
+		{
+			name:     "logical operators",
+			input:    "print false || x; print 1 && x; print null && x; print 0 || x;",
+			expected: "print x; print x; print null; print 0;",
+		},
+		{
+			name:     "constant condition takes the then branch",
+			input:    "if (1 < 2) { print 1; } else { print 2; }",
+			expected: "{ print 1; }",
+		},
+		{
+			name:     "constant condition takes the else branch",
+			input:    "if (false) print 1; else print 2;",
+			expected: "print 2;",
+		},
+		{
+			name:     "constant condition without a branch to take",
+			input:    "print 0; if (false) print 1; print 2;",
+			expected: "print 0; print 2;",
+		},
+		{
+			name:     "dropped branch keeps its var declarations",
+			input:    "if (true) print 1; else { let a = 1; var b = 2; }",
+			expected: "{ print 1; var b; }",
+		},
+		{
+			name:     "condition that isn't constant",
+			input:    "if (x) print 1 + 1;",
+			expected: "if (x) print 2;",
+		},
+		{
+			name:     "statements after return",
+			input:    "function f() { return 1; print 2; let a = 3; if (x) { var b; } }",
+			expected: "function f() { return 1; let a = 3; var b; }",
+		},
+		{
+			name:     "statements after break and continue",
+			input:    "while (x) { if (y) { continue; print 1; } break; print 2; }",
+			expected: "while (x) { if (y) { continue; } break; }",
+		},
+		{
+			name:     "statements after throw",
+			input:    "try { throw 1 + 1; print 1; } catch (e) { print e; } finally { print 2 * 2; }",
+			expected: "try { throw 2; } catch (e) { print e; } finally { print 4; }",
+		},
+		{
+			name:     "return from a constant condition",
+			input:    "function f() { if (true) return 1; print 2; }",
+			expected: "function f() { return 1; }",
+		},
+		{
+			name:     "nested functions and classes",
+			input:    "let f = function() { return 2 * 3; }; class A { m() { return 1 + 1; } }",
+			expected: "let f = function() { return 6; }; class A { m() { return 2; } }",
+		},
+		{
+			name:     "conditional used as an expression",
+			input:    "let a = if (false) { print 1; };",
+			expected: "let a = {};",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, expected := &strings.Builder{}, &strings.Builder{}
+			dump(got, reflect.ValueOf(Optimize(parse(t, tt.input))))
+			dump(expected, reflect.ValueOf(parse(t, tt.expected)))
+			if got.String() != expected.String() {
+				t.Errorf("got\n%s\nexpected\n%s", got, expected)
+			}
+		})
+	}
+}
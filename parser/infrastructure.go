@@ -17,6 +17,17 @@ func (p *Parser) match(types ...token.TokenType) bool {
 	return false
 }
 
+// matchWord checks if the current token is an identifier spelled as word.
+// It is used for contextual keywords. If a match is found, it advances the
+// parser and returns true.
+func (p *Parser) matchWord(word string) bool {
+	if p.check(token.IDENTIFIER) && p.peek().Lexeme == word {
+		p.advance()
+		return true
+	}
+	return false
+}
+
 // check returns true if the current token matches the provided type.
 // It returns false if the parser is at the end of the input or the types don't match.
 func (p *Parser) check(_type token.TokenType) bool {
@@ -26,6 +37,14 @@ func (p *Parser) check(_type token.TokenType) bool {
 	return p.peek().Type == _type
 }
 
+// checkNext returns true if the token after the current one matches the provided type.
+func (p *Parser) checkNext(_type token.TokenType) bool {
+	if p.isAtEnd() || p.current+1 >= len(p.tokens) {
+		return false
+	}
+	return p.tokens[p.current+1].Type == _type
+}
+
 // advance moves the parser to the next token if it's not at the end.
 // It returns the previous token.
 func (p *Parser) advance() token.Token {
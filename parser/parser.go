@@ -1,20 +1,30 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
-	"log"
 
 	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/diagnostic"
 	"github.com/Toolnado/sludge/token"
 )
 
 // Parser parses a sequence of tokens into an abstract syntax tree (AST).
 // It implements a recursive descent parser based on the following grammar:
 // program        → declaration* EOF ;
-// declaration    → funDecl
+// declaration    → classDecl
+//                | recordDecl
+//                | importDecl
+//                | funDecl
 // 				  | varDecl
 //                | statement ;
 
+// varDecl        → ( "var" | "let" ) IDENTIFIER ( "=" expression )? ";"
+//                | "const" IDENTIFIER "=" expression ";" ;
+// classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" function* "}" ;
+// recordDecl     → "record" IDENTIFIER "(" parameters? ")" ";" ;
+// importDecl     → "import" STRING ( "as" IDENTIFIER )? ";"
+//                | "import" "{" IDENTIFIER ( "," IDENTIFIER )* "}" "from" STRING ";" ;
 // funDecl        → "fun" function ;
 // function       → IDENTIFIER "(" parameters? ")" block ;
 
@@ -22,9 +32,16 @@ import (
 // 				  | forStmt ;
 // 				  | ifStmt ;
 //                | printStmt ;
+//                | returnStmt ;
+//                | breakStmt ;
+//                | continueStmt ;
 // 				  | whileStmt ;
 //				  | block ;
 
+// returnStmt     → "return" expression? ";" ;
+// breakStmt      → "break" ";" ;
+// continueStmt   → "continue" ";" ;
+
 // forStmt        → "for" "(" ( varDecl | exprStmt | ";" )
 //                  expression? ";"
 //                  expression? ")" statement ;
@@ -37,7 +54,8 @@ import (
 // block          → "{" declaration* "}" ;
 
 // expression     → assignment ;
-// assignment     → IDENTIFIER "=" assignment
+// assignment     → ( IDENTIFIER | call "[" expression "]" | call "." IDENTIFIER )
+//                  ( "=" | "+=" | "-=" | "*=" | "/=" | "%=" ) assignment
 //                | logic_or ;
 
 // logic_or       → logic_and ( "or" logic_and )* ;
@@ -48,14 +66,31 @@ import (
 // remainder      → factor ( "%" factor )* ;
 // factor         → unary ( ( "/" | "*" ) unary )* ;
 // unary          → ( "!" | "-" ) unary | call ;
-// call           → primary ( "(" arguments? ")" )* ;
+// call           → primary ( "(" arguments? ")" | "[" index "]" | "." IDENTIFIER
+//                | "with" "{" ( IDENTIFIER ":" expression ( "," IDENTIFIER ":" expression )* )? "}" )* ;
 // arguments      → expression ( "," expression )* ;
-// primary        → NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")" ;
+// index          → expression | expression? ":" expression? ;
+// primary        → NUMBER | STRING | "true" | "false" | "nil" | "(" expression ")"
+//                | IDENTIFIER | "this" | "super" "." IDENTIFIER
+//                | list | map | funExpr | arrowFn | interpolation ;
+// interpolation  → ( INTERPOLATION expression )+ ( STRING | RAW_STRING | TEMPLATE ) ;
+
+// In templates, text between code regions is a statement of its own:
+// emitStmt       → TEMPLATE | interpolation ;
+// list           → "[" ( expression ( "," expression )* ","? )? "]" ;
+// map            → "[" ":" "]" | "[" entry ( "," entry )* ","? "]" ;
+// entry          → expression ":" expression ;
+// funExpr        → "function" "(" parameters? ")" block ;
+// arrowFn        → ( IDENTIFIER | "(" parameters? ")" ) "=>" ( block | expression ) ;
 
 type Parser struct {
-	tokens   []token.Token // List of tokens to parse
-	hadError bool          // Indicates if a parsing error has occurred
-	current  int           // Index of the current token
+	tokens    []token.Token // List of tokens to parse
+	hadError  bool          // Indicates if a parsing error has occurred
+	errors    []error       // Syntax errors found, in the order of the source
+	current   int           // Index of the current token
+	loopDepth int           // Number of loops enclosing the current statement
+	blocks    int           // Number of blocks enclosing the current statement
+	template  bool          // Whether the tokens come from lexer.ScanTemplate
 }
 
 // New creates a new parser from a slice of tokens.
@@ -66,52 +101,188 @@ func New(tokens []token.Token) *Parser {
 	}
 }
 
+// NewTemplate creates a parser for the tokens of a text template, in which
+// literal text and ${...} regions are parsed as statements that emit them.
+func NewTemplate(tokens []token.Token) *Parser {
+	return &Parser{
+		tokens:   tokens,
+		template: true,
+	}
+}
+
 // HadError returns true if the parser has encountered a syntax error.
 func (p *Parser) HadError() bool {
 	return p.hadError
 }
 
-// Parse starts the parsing process and returns the root expression node or an error.
+// Parse parses the whole input and returns its declarations. After a syntax
+// error it skips to the next statement and goes on, so that every error is
+// reported: the error returned joins them all, and Errors lists them.
 func (p *Parser) Parse() ([]ast.Stmt, error) {
 	decls := []ast.Stmt{}
 	for !p.isAtEnd() {
+		start := p.current
 		decl, err := p.declaration()
 		if err != nil {
-			log.Println(err)
-			p.synchronize()
+			p.recover(err, start)
 		} else {
 			decls = append(decls, decl)
 		}
 	}
-	return decls, nil
+	return decls, errors.Join(p.errors...)
+}
+
+// Errors returns the syntax errors found by Parse, in the order of the
+// source. Each of them is a diagnostic.Diagnostic.
+func (p *Parser) Errors() []error {
+	return p.errors
 }
 
 func (p *Parser) declaration() (ast.Stmt, error) {
 	switch {
-	case p.match(token.VAR):
+	case p.match(token.VAR, token.LET, token.CONST):
 		return p.varDeclaration()
-	case p.match(token.FUNCTION):
+	case p.match(token.CLASS):
+		return p.classDeclaration()
+	case p.match(token.RECORD):
+		return p.recordDeclaration()
+	case p.match(token.IMPORT):
+		return p.importDeclaration()
+	case p.check(token.FUNCTION) && p.checkNext(token.IDENTIFIER):
+		p.advance()
 		return p.funDeclaration("function")
 	default:
 		return p.statement()
 	}
 }
 
+func (p *Parser) classDeclaration() (ast.Stmt, error) {
+	name, err := p.consume(token.IDENTIFIER, "expect class name")
+	if err != nil {
+		return nil, err
+	}
+
+	var superclass *ast.VariableExpr
+	if p.match(token.LESS) {
+		super, err := p.consume(token.IDENTIFIER, "expect superclass name")
+		if err != nil {
+			return nil, err
+		}
+		superclass = ast.NewVariableExpr(super)
+	}
+
+	if _, err := p.consume(token.LEFT_BRACE, "expect '{' before class body"); err != nil {
+		return nil, err
+	}
+	methods := []*ast.FunctionStmt{}
+	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
+		method, err := p.funDeclaration("method")
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, method.(*ast.FunctionStmt))
+	}
+	if _, err := p.consume(token.RIGHT_BRACE, "expect '}' after class body"); err != nil {
+		return nil, err
+	}
+	return ast.NewClassStmt(name, superclass, methods), nil
+}
+
+func (p *Parser) recordDeclaration() (ast.Stmt, error) {
+	name, err := p.consume(token.IDENTIFIER, "expect record name")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(token.LEFT_PAREN, "expect '(' after record name"); err != nil {
+		return nil, err
+	}
+	fields, err := p.parameters()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(token.SEMICOLON, "expect ';' after record declaration"); err != nil {
+		return nil, err
+	}
+	return ast.NewRecordStmt(name, fields), nil
+}
+
+// importDeclaration parses both forms of import. "as" and "from" are only
+// keywords in this position, so they remain usable as identifiers.
+func (p *Parser) importDeclaration() (ast.Stmt, error) {
+	keyword := p.previous()
+	var alias token.Token
+	names := []token.Token{}
+
+	if p.match(token.LEFT_BRACE) {
+		for {
+			name, err := p.consume(token.IDENTIFIER, "expect imported name")
+			if err != nil {
+				return nil, err
+			}
+			names = append(names, name)
+			if !p.match(token.COMMA) {
+				break
+			}
+		}
+		if _, err := p.consume(token.RIGHT_BRACE, "expect '}' after imported names"); err != nil {
+			return nil, err
+		}
+		if !p.matchWord("from") {
+			return nil, NewError(p.peek(), "expect 'from' after imported names")
+		}
+	}
+
+	path, err := p.consume(token.STRING, "expect module path")
+	if err != nil {
+		return nil, err
+	}
+
+	if len(names) == 0 && p.matchWord("as") {
+		alias, err = p.consume(token.IDENTIFIER, "expect module name after 'as'")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := p.consume(token.SEMICOLON, "expect ';' after import"); err != nil {
+		return nil, err
+	}
+	return ast.NewImportStmt(keyword, path, alias, names), nil
+}
+
 func (p *Parser) funDeclaration(kind string) (ast.Stmt, error) {
 	name, err := p.consume(token.IDENTIFIER, fmt.Sprintf("expect %s name", kind))
 	if err != nil {
-		return nil, NewError(p.previous(), err.Error())
+		return nil, err
 	}
 	_, err = p.consume(token.LEFT_PAREN, fmt.Sprintf("expect '(' after %s name", kind))
 	if err != nil {
-		return nil, NewError(p.previous(), err.Error())
+		return nil, err
 	}
+	parameters, err := p.parameters()
+	if err != nil {
+		return nil, err
+	}
+	_, err = p.consume(token.LEFT_BRACE, fmt.Sprintf("expect '{' before %s body", kind))
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.functionBody()
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewFunctionStmt(name, parameters, body), nil
+}
+
+// parameters parses a comma separated list of parameter names up to and
+// including the closing ')'. The opening '(' must already be consumed.
+func (p *Parser) parameters() ([]token.Token, error) {
 	parameters := []token.Token{}
 	if !p.check(token.RIGHT_PAREN) {
 		for {
 			param, err := p.consume(token.IDENTIFIER, "expect parameter name")
 			if err != nil {
-				return nil, NewError(p.previous(), err.Error())
+				return nil, err
 			}
 			parameters = append(parameters, param)
 
@@ -120,78 +291,356 @@ func (p *Parser) funDeclaration(kind string) (ast.Stmt, error) {
 			}
 		}
 	}
-	_, err = p.consume(token.RIGHT_PAREN, "expect ')' after parameters")
+	if _, err := p.consume(token.RIGHT_PAREN, "expect ')' after parameters"); err != nil {
+		return nil, err
+	}
+	return parameters, nil
+}
+
+// functionBody parses the block of a function. The opening '{' must already
+// be consumed.
+func (p *Parser) functionBody() ([]ast.Stmt, error) {
+	// Loops outside the function body can't be exited from inside it.
+	enclosingLoops := p.loopDepth
+	p.loopDepth = 0
+	defer func() {
+		p.loopDepth = enclosingLoops
+	}()
+	return p.block()
+}
+
+// functionExpression parses an anonymous function after the "function"
+// keyword: "(" parameters? ")" block.
+func (p *Parser) functionExpression() (ast.Expr, error) {
+	keyword := p.previous()
+	if _, err := p.consume(token.LEFT_PAREN, "expect '(' after 'function'"); err != nil {
+		return nil, err
+	}
+	parameters, err := p.parameters()
 	if err != nil {
-		return nil, NewError(p.previous(), err.Error())
+		return nil, err
 	}
-	_, err = p.consume(token.LEFT_BRACE, fmt.Sprintf("expect '{' before %s body", kind))
+	if _, err := p.consume(token.LEFT_BRACE, "expect '{' before function body"); err != nil {
+		return nil, err
+	}
+	body, err := p.functionBody()
 	if err != nil {
-		return nil, NewError(p.previous(), err.Error())
+		return nil, err
 	}
-	body, err := p.block()
+	return ast.NewFunctionExpr(keyword, parameters, body), nil
+}
+
+// isArrowFunction reports whether the tokens starting at the current one
+// form the parameter list of an arrow function: either a single identifier
+// or a parenthesized list of identifiers, followed by "=>".
+func (p *Parser) isArrowFunction() bool {
+	if p.check(token.IDENTIFIER) {
+		return p.checkNext(token.ARROW)
+	}
+	if !p.check(token.LEFT_PAREN) {
+		return false
+	}
+	for i := p.current + 1; i < len(p.tokens); i++ {
+		switch p.tokens[i].Type {
+		case token.IDENTIFIER, token.COMMA:
+			continue
+		case token.RIGHT_PAREN:
+			return i+1 < len(p.tokens) && p.tokens[i+1].Type == token.ARROW
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// arrowFunction parses an arrow function. The body is either a block or a
+// single expression whose value is returned.
+func (p *Parser) arrowFunction() (ast.Expr, error) {
+	var parameters []token.Token
+	if p.match(token.IDENTIFIER) {
+		parameters = []token.Token{p.previous()}
+	} else {
+		p.advance()
+		params, err := p.parameters()
+		if err != nil {
+			return nil, err
+		}
+		parameters = params
+	}
+	arrow, err := p.consume(token.ARROW, "expect '=>' after parameters")
 	if err != nil {
-		return nil, NewError(p.previous(), err.Error())
+		return nil, err
 	}
-	return ast.NewFunctionStmt(name, parameters, body), nil
+
+	if p.match(token.LEFT_BRACE) {
+		body, err := p.functionBody()
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewFunctionExpr(arrow, parameters, body), nil
+	}
+
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	body := []ast.Stmt{ast.NewReturnStmt(arrow, value)}
+	return ast.NewFunctionExpr(arrow, parameters, body), nil
 }
 
+// varDeclaration parses a declaration whose "var", "let" or "const" keyword
+// has already been consumed. Constants must be initialized.
 func (p *Parser) varDeclaration() (ast.Stmt, error) {
+	keyword := p.previous()
 	name, err := p.consume(token.IDENTIFIER, "expect variable name")
 	if err != nil {
-		return nil, NewError(p.previous(), err.Error())
+		return nil, err
+	}
+	if keyword.Type == token.CONST && !p.check(token.EQUAL) {
+		return nil, NewError(name, fmt.Sprintf("constant '%s' must be initialized", name.Lexeme))
 	}
 	var initializer ast.Expr
 	if p.match(token.EQUAL) {
 		expr, err := p.expression()
 		if err != nil {
-			return nil, NewError(p.previous(), err.Error())
+			return nil, err
 		}
 		initializer = expr
 	}
 
-	p.consume(token.SEMICOLON, "expect ';' after variable declaration.")
-	return ast.NewVarStmt(name, initializer), nil
+	if _, err := p.consume(token.SEMICOLON, "expect ';' after variable declaration"); err != nil {
+		return nil, err
+	}
+	return ast.NewVarStmt(keyword, name, initializer), nil
 }
 
 func (p *Parser) statement() (ast.Stmt, error) {
+	if p.template && p.match(token.TEMPLATE, token.INTERPOLATION) {
+		return p.emitStatement()
+	}
 	if p.match(token.PRINT) {
 		return p.printStatement()
 	}
+	if p.match(token.RETURN) {
+		return p.returnStatement()
+	}
+	if p.match(token.BREAK, token.CONTINUE) {
+		return p.loopControlStatement()
+	}
+	if p.match(token.THROW) {
+		return p.throwStatement()
+	}
+	if p.match(token.TRY) {
+		return p.tryStatement()
+	}
+	// Blocks, loops and conditionals are also parsed by primary, but as
+	// statements they take no ';' after them.
+	if p.match(token.LEFT_BRACE) {
+		stmts, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewBlockStmt(stmts), nil
+	}
+	if p.match(token.WHILE) {
+		return p.whileStatement()
+	}
+	if p.match(token.FOR) {
+		return p.forStatement()
+	}
+	if p.match(token.IF) {
+		return p.ifStatement()
+	}
 	return p.expressionStatement()
 }
 
+func (p *Parser) returnStatement() (ast.Stmt, error) {
+	keyword := p.previous()
+	var value ast.Expr
+	if !p.check(token.SEMICOLON) {
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		value = expr
+	}
+	if _, err := p.consume(token.SEMICOLON, "expect ';' after return value"); err != nil {
+		return nil, err
+	}
+	return ast.NewReturnStmt(keyword, value), nil
+}
+
+func (p *Parser) throwStatement() (ast.Stmt, error) {
+	keyword := p.previous()
+	value, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.consume(token.SEMICOLON, "expect ';' after thrown value"); err != nil {
+		return nil, err
+	}
+	return ast.NewThrowStmt(keyword, value), nil
+}
+
+// tryStatement parses "try" block, followed by a "catch" clause naming the
+// variable that holds the error, a "finally" block or both.
+func (p *Parser) tryStatement() (ast.Stmt, error) {
+	keyword := p.previous()
+	if _, err := p.consume(token.LEFT_BRACE, "expect '{' after 'try'"); err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+
+	var name token.Token
+	var catch []ast.Stmt
+	if p.match(token.CATCH) {
+		if _, err := p.consume(token.LEFT_PAREN, "expect '(' after 'catch'"); err != nil {
+			return nil, err
+		}
+		if name, err = p.consume(token.IDENTIFIER, "expect error variable name"); err != nil {
+			return nil, err
+		}
+		if _, err := p.consume(token.RIGHT_PAREN, "expect ')' after error variable"); err != nil {
+			return nil, err
+		}
+		if _, err := p.consume(token.LEFT_BRACE, "expect '{' before catch body"); err != nil {
+			return nil, err
+		}
+		if catch, err = p.block(); err != nil {
+			return nil, err
+		}
+	}
+
+	var finally []ast.Stmt
+	if p.match(token.FINALLY) {
+		if _, err := p.consume(token.LEFT_BRACE, "expect '{' after 'finally'"); err != nil {
+			return nil, err
+		}
+		if finally, err = p.block(); err != nil {
+			return nil, err
+		}
+	} else if name.Type != token.IDENTIFIER {
+		return nil, NewError(p.peek(), "expect 'catch' or 'finally' after try block")
+	}
+	return ast.NewTryStmt(keyword, body, name, catch, finally), nil
+}
+
+// loopControlStatement parses "break" and "continue", which are only
+// allowed inside the body of a loop.
+func (p *Parser) loopControlStatement() (ast.Stmt, error) {
+	keyword := p.previous()
+	if p.loopDepth == 0 {
+		return nil, NewError(keyword, fmt.Sprintf("can't use '%s' outside of a loop", keyword.Lexeme))
+	}
+	if _, err := p.consume(token.SEMICOLON, fmt.Sprintf("expect ';' after '%s'", keyword.Lexeme)); err != nil {
+		return nil, err
+	}
+	if keyword.Type == token.BREAK {
+		return ast.NewBreakStmt(keyword), nil
+	}
+	return ast.NewContinueStmt(keyword), nil
+}
+
+// emitStatement parses a run of template text with its embedded
+// expressions, which is written to the output as it is.
+func (p *Parser) emitStatement() (ast.Stmt, error) {
+	if p.previous().Type == token.TEMPLATE {
+		return ast.NewEmitStmt(ast.NewLiteralExpr(p.previous().Literal)), nil
+	}
+	value, err := p.interpolation()
+	if err != nil {
+		return nil, err
+	}
+	return ast.NewEmitStmt(value), nil
+}
+
 func (p *Parser) printStatement() (ast.Stmt, error) {
 	value, err := p.expression()
 	if err != nil {
-		return nil, NewError(p.previous(), err.Error())
+		return nil, err
+	}
+	if _, err := p.consume(token.SEMICOLON, "expect ';' after value"); err != nil {
+		return nil, err
 	}
-	p.consume(token.SEMICOLON, "expect ';' after value.")
 	return ast.NewPrintStmt(value), nil
 }
 
 func (p *Parser) expressionStatement() (ast.Stmt, error) {
 	value, err := p.expression()
 	if err != nil {
-		return nil, NewError(p.previous(), err.Error())
+		return nil, err
+	}
+	if _, err := p.consume(token.SEMICOLON, "expect ';' after value"); err != nil {
+		return nil, err
 	}
-	p.consume(token.SEMICOLON, "expect ';' after value")
 	return ast.NewExprStmt(value), nil
 }
 
-// synchronize attempts to recover from a parsing error by advancing
-// through tokens until it finds a likely statement boundary.
-func (p *Parser) synchronize() {
-	p.advance()
+// recover records a syntax error found in the declaration that starts at
+// the token with index start, and skips the rest of the declaration so
+// that parsing can go on with the next one. An error at an illegal token
+// isn't recorded: the lexer has reported that token already.
+func (p *Parser) recover(err error, start int) {
+	var d diagnostic.Diagnostic
+	if !errors.As(err, &d) || p.peek().Type != token.ILLEGAL || d.Span.Start != p.peek().Position {
+		p.errors = append(p.errors, err)
+	}
+	p.hadError = true
+	if p.current == start {
+		p.advance()
+	}
+
+	// The braces the declaration opened and didn't close yet are skipped
+	// with the rest of it, up to their closing '}'.
+	depth := 0
+	for _, t := range p.tokens[start:p.current] {
+		switch t.Type {
+		case token.LEFT_BRACE:
+			depth++
+		case token.RIGHT_BRACE:
+			depth--
+		}
+	}
+	p.synchronize(max(depth, 0))
+}
+
+// synchronize recovers from a parsing error by advancing through tokens
+// until it finds a likely statement boundary: the token after a ';' or
+// one that starts a statement. Inside a block, the closing '}' is one as
+// well. Tokens between braces are skipped whole, starting depth braces
+// deep, so that a '}' or a ';' inside them doesn't end the recovery early.
+func (p *Parser) synchronize(depth int) {
 	for !p.isAtEnd() {
-		if p.previous().Type == token.SEMICOLON {
-			return
+		if depth == 0 {
+			switch p.peek().Type {
+			case token.CLASS, token.RECORD, token.IMPORT, token.FUNCTION, token.VAR, token.FOR, token.IF,
+				token.WHILE, token.LET, token.CONST, token.RETURN, token.THROW, token.TRY, token.PRINT,
+				token.BREAK, token.CONTINUE:
+				return
+			case token.RIGHT_BRACE:
+				if p.blocks > 0 {
+					return
+				}
+			}
 		}
-		switch p.peek().Type {
-		case token.FUNCTION, token.VAR, token.FOR, token.IF,
-			token.WHILE, token.LET, token.CONST, token.RETURN:
-			return
+		switch p.advance().Type {
+		case token.LEFT_BRACE:
+			depth++
+		case token.RIGHT_BRACE:
+			if depth > 0 {
+				depth--
+				if depth == 0 {
+					return
+				}
+			}
+		case token.SEMICOLON:
+			if depth == 0 {
+				return
+			}
 		}
-		p.advance()
 	}
 }
 
@@ -203,21 +652,39 @@ func (p *Parser) expression() (ast.Expr, error) {
 func (p *Parser) assignment() (ast.Expr, error) {
 	expr, err := p.or()
 	if err != nil {
-		return nil, NewError(p.peek(), err.Error())
+		return nil, err
 	}
 	if p.match(token.EQUAL) {
 		equals := p.previous()
 		value, err := p.assignment()
 		if err != nil {
-			return nil, NewError(p.peek(), err.Error())
+			return nil, err
 		}
 		if v, ok := expr.(*ast.VariableExpr); ok {
 			name := v.Name
 			return ast.NewAssignExpr(name, value), nil
 		}
+		if v, ok := expr.(*ast.IndexExpr); ok {
+			return ast.NewIndexSetExpr(v.Object, v.Bracket, v.Index, value), nil
+		}
+		if v, ok := expr.(*ast.GetExpr); ok {
+			return ast.NewSetExpr(v.Object, v.Name, value), nil
+		}
 
 		return nil, NewError(equals, "invalid assignment target")
 	}
+	if p.match(token.PLUS_EQUAL, token.MINUS_EQUAL, token.STAR_EQUAL, token.SLASH_EQUAL, token.PERCENT_EQUAL) {
+		operator := p.previous()
+		value, err := p.assignment()
+		if err != nil {
+			return nil, err
+		}
+		switch expr.(type) {
+		case *ast.VariableExpr, *ast.IndexExpr, *ast.GetExpr:
+			return ast.NewCompoundAssignExpr(expr, operator, value), nil
+		}
+		return nil, NewError(operator, "invalid assignment target")
+	}
 
 	return expr, nil
 }
@@ -225,13 +692,13 @@ func (p *Parser) assignment() (ast.Expr, error) {
 func (p *Parser) or() (ast.Expr, error) {
 	expr, err := p.and()
 	if err != nil {
-		return nil, NewError(p.peek(), err.Error())
+		return nil, err
 	}
 	if p.match(token.OR) {
 		operator := p.previous()
 		right, err := p.and()
 		if err != nil {
-			return nil, NewError(p.peek(), err.Error())
+			return nil, err
 		}
 		return ast.NewLogicalExpr(expr, operator, right), nil
 	}
@@ -242,13 +709,13 @@ func (p *Parser) or() (ast.Expr, error) {
 func (p *Parser) and() (ast.Expr, error) {
 	expr, err := p.equality()
 	if err != nil {
-		return nil, NewError(p.peek(), err.Error())
+		return nil, err
 	}
 	if p.match(token.AND) {
 		operator := p.previous()
 		right, err := p.equality()
 		if err != nil {
-			return nil, NewError(p.peek(), err.Error())
+			return nil, err
 		}
 		return ast.NewLogicalExpr(expr, operator, right), nil
 	}
@@ -366,6 +833,22 @@ func (p *Parser) call() (ast.Expr, error) {
 			if err != nil {
 				return nil, err
 			}
+		} else if p.match(token.LEFT_BRACKET) {
+			expr, err = p.finishIndex(expr)
+			if err != nil {
+				return nil, err
+			}
+		} else if p.match(token.DOT) {
+			name, err := p.consume(token.IDENTIFIER, "expect property name after '.'")
+			if err != nil {
+				return nil, err
+			}
+			expr = ast.NewGetExpr(expr, name)
+		} else if p.match(token.WITH) {
+			expr, err = p.finishWith(expr)
+			if err != nil {
+				return nil, err
+			}
 		} else {
 			break
 		}
@@ -374,6 +857,163 @@ func (p *Parser) call() (ast.Expr, error) {
 	return expr, nil
 }
 
+// finishIndex parses the rest of an index or slice expression after '['.
+func (p *Parser) finishIndex(object ast.Expr) (ast.Expr, error) {
+	bracket := p.previous()
+	var start ast.Expr
+	if !p.check(token.COLON) {
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		start = expr
+	}
+
+	if !p.match(token.COLON) {
+		if _, err := p.consume(token.RIGHT_BRACKET, "expect ']' after index"); err != nil {
+			return nil, err
+		}
+		return ast.NewIndexExpr(object, bracket, start), nil
+	}
+
+	var end ast.Expr
+	if !p.check(token.RIGHT_BRACKET) {
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		end = expr
+	}
+	if _, err := p.consume(token.RIGHT_BRACKET, "expect ']' after slice"); err != nil {
+		return nil, err
+	}
+	return ast.NewSliceExpr(object, bracket, start, end), nil
+}
+
+// interpolation parses a string with embedded expressions. The lexer emits
+// the text before each expression as an INTERPOLATION token followed by the
+// tokens of the expression, and the text after the last one as a string.
+func (p *Parser) interpolation() (ast.Expr, error) {
+	start := p.previous()
+	parts := []ast.Expr{}
+	for {
+		if text := p.previous().Literal.(string); text != "" {
+			parts = append(parts, ast.NewLiteralExpr(text))
+		}
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, expr)
+
+		if !p.match(token.INTERPOLATION) {
+			break
+		}
+	}
+	if !p.match(token.STRING, token.RAW_STRING, token.TEMPLATE) {
+		return nil, NewError(p.peek(), "expect '}' after interpolated expression")
+	}
+	if text := p.previous().Literal.(string); text != "" {
+		parts = append(parts, ast.NewLiteralExpr(text))
+	}
+	return ast.NewInterpolationExpr(start, parts), nil
+}
+
+// finishWith parses the field updates of a "with" expression.
+func (p *Parser) finishWith(object ast.Expr) (ast.Expr, error) {
+	keyword := p.previous()
+	if _, err := p.consume(token.LEFT_BRACE, "expect '{' after 'with'"); err != nil {
+		return nil, err
+	}
+	names := []token.Token{}
+	values := []ast.Expr{}
+	for !p.check(token.RIGHT_BRACE) {
+		name, err := p.consume(token.IDENTIFIER, "expect field name")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.consume(token.COLON, "expect ':' after field name"); err != nil {
+			return nil, err
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+		values = append(values, value)
+
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+	if _, err := p.consume(token.RIGHT_BRACE, "expect '}' after fields"); err != nil {
+		return nil, err
+	}
+	return ast.NewWithExpr(object, keyword, names, values), nil
+}
+
+// list parses a list or map literal after '['. A colon after the first
+// element, or a lone colon for an empty map, makes it a map literal.
+func (p *Parser) list() (ast.Expr, error) {
+	bracket := p.previous()
+	if p.match(token.COLON) {
+		if _, err := p.consume(token.RIGHT_BRACKET, "expect ']' after ':' in empty map"); err != nil {
+			return nil, err
+		}
+		return ast.NewMapExpr(bracket, []ast.Expr{}, []ast.Expr{}), nil
+	}
+
+	elements := []ast.Expr{}
+	for !p.check(token.RIGHT_BRACKET) {
+		expr, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		if len(elements) == 0 && p.check(token.COLON) {
+			return p.mapEntries(bracket, expr)
+		}
+		elements = append(elements, expr)
+
+		if !p.match(token.COMMA) {
+			break
+		}
+	}
+	if _, err := p.consume(token.RIGHT_BRACKET, "expect ']' after list elements"); err != nil {
+		return nil, err
+	}
+	return ast.NewListExpr(bracket, elements), nil
+}
+
+// mapEntries parses the entries of a map literal whose first key has
+// already been parsed.
+func (p *Parser) mapEntries(bracket token.Token, key ast.Expr) (ast.Expr, error) {
+	keys := []ast.Expr{}
+	values := []ast.Expr{}
+	for {
+		if _, err := p.consume(token.COLON, "expect ':' after map key"); err != nil {
+			return nil, err
+		}
+		value, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+
+		if !p.match(token.COMMA) || p.check(token.RIGHT_BRACKET) {
+			break
+		}
+		key, err = p.expression()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.consume(token.RIGHT_BRACKET, "expect ']' after map entries"); err != nil {
+		return nil, err
+	}
+	return ast.NewMapExpr(bracket, keys, values), nil
+}
+
 func (p *Parser) finishCall(callee ast.Expr) (ast.Expr, error) {
 	args := []ast.Expr{}
 	if !p.check(token.RIGHT_PAREN) {
@@ -396,17 +1036,24 @@ func (p *Parser) finishCall(callee ast.Expr) (ast.Expr, error) {
 	return ast.NewCallExpr(callee, paren, args), nil
 }
 
+// block parses the declarations of a block up to and including the closing
+// '}'. The opening '{' must already be consumed. Errors in the declarations
+// are recorded and skipped, like those at the top level.
 func (p *Parser) block() ([]ast.Stmt, error) {
 	statements := []ast.Stmt{}
+	p.blocks++
 	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
+		start := p.current
 		stmt, err := p.declaration()
 		if err != nil {
-			return nil, err
+			p.recover(err, start)
+			continue
 		}
 		statements = append(statements, stmt)
 	}
+	p.blocks--
 
-	_, err := p.consume(token.RIGHT_BRACE, "expect '}' after block.")
+	_, err := p.consume(token.RIGHT_BRACE, "expect '}' after block")
 	if err != nil {
 		return nil, err
 	}
@@ -443,18 +1090,24 @@ func (p *Parser) ifStatement() (ast.Stmt, error) {
 }
 
 func (p *Parser) whileStatement() (ast.Stmt, error) {
-	p.consume(token.LEFT_PAREN, "expect '(' after 'while'")
+	if _, err := p.consume(token.LEFT_PAREN, "expect '(' after 'while'"); err != nil {
+		return nil, err
+	}
 	condition, err := p.expression()
 	if err != nil {
 		return nil, err
 	}
-	p.consume(token.RIGHT_PAREN, "expect ')' after condition")
+	if _, err := p.consume(token.RIGHT_PAREN, "expect ')' after condition"); err != nil {
+		return nil, err
+	}
+	p.loopDepth++
 	body, err := p.statement()
+	p.loopDepth--
 	if err != nil {
 		return nil, err
 	}
 
-	return ast.NewWhileStmt(condition, body), nil
+	return ast.NewWhileStmt(condition, body, nil), nil
 }
 
 func (p *Parser) forStatement() (ast.Stmt, error) {
@@ -501,24 +1154,24 @@ func (p *Parser) forStatement() (ast.Stmt, error) {
 		}
 		increment = i
 	}
-	_, err = p.consume(token.RIGHT_PAREN, "expect ';' after loop condition")
+	_, err = p.consume(token.RIGHT_PAREN, "expect ')' after for clauses")
 	if err != nil {
 		return nil, err
 	}
 
+	p.loopDepth++
 	body, err := p.statement()
+	p.loopDepth--
 	if err != nil {
 		return nil, err
 	}
 
-	if increment != nil {
-		body = ast.NewBlockStmt([]ast.Stmt{body, ast.NewExprStmt(increment)})
-	}
-
 	if condition == nil {
 		condition = ast.NewLiteralExpr(true)
 	}
-	body = ast.NewWhileStmt(condition, body)
+	// The increment is kept on the loop rather than appended to the body
+	// so that "continue" still runs it.
+	body = ast.NewWhileStmt(condition, body, increment)
 
 	if initializer != nil {
 		body = ast.NewBlockStmt([]ast.Stmt{initializer, body})
@@ -532,15 +1185,35 @@ func (p *Parser) forStatement() (ast.Stmt, error) {
 func (p *Parser) primary() (ast.Expr, error) {
 	switch {
 	case p.match(token.FALSE):
-		return ast.NewLiteralExpr(p.previous().Literal), nil
+		return ast.NewLiteralExpr(false), nil
 	case p.match(token.TRUE):
-		return ast.NewLiteralExpr(p.previous().Literal), nil
+		return ast.NewLiteralExpr(true), nil
 	case p.match(token.NULL):
 		return ast.NewLiteralExpr(nil), nil
-	case p.match(token.STRING, token.RAW_STRING, token.INTEGER):
+	case p.match(token.INTERPOLATION):
+		return p.interpolation()
+	case p.match(token.STRING, token.RAW_STRING, token.INTEGER, token.FLOAT):
 		return ast.NewLiteralExpr(p.previous().Literal), nil
+	case p.match(token.THIS):
+		return ast.NewThisExpr(p.previous()), nil
+	case p.match(token.SUPER):
+		keyword := p.previous()
+		if _, err := p.consume(token.DOT, "expect '.' after 'super'"); err != nil {
+			return nil, err
+		}
+		method, err := p.consume(token.IDENTIFIER, "expect superclass method name")
+		if err != nil {
+			return nil, err
+		}
+		return ast.NewSuperExpr(keyword, method), nil
+	case p.isArrowFunction():
+		return p.arrowFunction()
+	case p.match(token.FUNCTION):
+		return p.functionExpression()
 	case p.match(token.IDENTIFIER):
 		return ast.NewVariableExpr(p.previous()), nil
+	case p.match(token.LEFT_BRACKET):
+		return p.list()
 	case p.match(token.LEFT_BRACE):
 		stmts, err := p.block()
 		if err != nil {
@@ -0,0 +1,191 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/lexer"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{
+			name:    "break inside loop",
+			input:   "while (true) { break; }",
+			wantErr: false,
+		},
+		{
+			name:    "continue inside for",
+			input:   "for (var i = 0; i < 1; i = i + 1) { continue; }",
+			wantErr: false,
+		},
+		{
+			name:    "break outside loop",
+			input:   "break;",
+			wantErr: true,
+		},
+		{
+			name:    "continue outside loop",
+			input:   "if (true) { continue; }",
+			wantErr: true,
+		},
+		{
+			name:    "break in function inside loop",
+			input:   "while (true) { function f() { break; } }",
+			wantErr: true,
+		},
+		{
+			name:    "compound assignment targets",
+			input:   "var x = 1; x += 1; xs[0] -= 1; p.n *= 2;",
+			wantErr: false,
+		},
+		{
+			name:    "declarations",
+			input:   "var a; let b; let c = 1; const d = 2;",
+			wantErr: false,
+		},
+		{
+			name:    "uninitialized constant",
+			input:   "const d;",
+			wantErr: true,
+		},
+		{
+			name:    "try statements",
+			input:   "try { throw 1; } catch (e) { print e; } try {} finally {} try {} catch (e) {} finally {}",
+			wantErr: false,
+		},
+		{
+			name:    "try without catch or finally",
+			input:   "try { print 1; }",
+			wantErr: true,
+		},
+		{
+			name:    "catch without error variable",
+			input:   "try {} catch { print 1; }",
+			wantErr: true,
+		},
+		{
+			name:    "throw without value",
+			input:   "throw;",
+			wantErr: true,
+		},
+		{
+			name:    "compound assignment to a call",
+			input:   "f() += 1;",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := lexer.New(strings.NewReader(tt.input))
+			p := New(l.ScanTokens())
+			p.Parse()
+
+			if tt.wantErr && !p.HadError() {
+				t.Error("expected error but got none")
+			}
+			if !tt.wantErr && p.HadError() {
+				t.Error("expected no errors but got one")
+			}
+		})
+	}
+}
+
+func TestParseCollectsErrors(t *testing.T) {
+	input := `let a = ;
+while (true print a;
+function f() {
+  let b = 1
+  if (b) { print (b; }
+  return b;
+}
+print a`
+	expected := []string{
+		"expect expression\n<input>:1:9",
+		"expect ')' after condition\n<input>:2:13",
+		"expect ';' after variable declaration\n<input>:5:3",
+		"expect ')' after expression\n<input>:5:20",
+		"expect ';' after value\n<input>:8:8",
+	}
+
+	l := lexer.New(strings.NewReader(input))
+	p := New(l.ScanTokens())
+	stmts, err := p.Parse()
+	if err == nil {
+		t.Fatal("expected errors but got none")
+	}
+	errs := p.Errors()
+	if len(errs) != len(expected) {
+		t.Fatalf("got %d errors, expected %d: %v", len(errs), len(expected), err)
+	}
+	for indx, e := range errs {
+		if e.Error() != expected[indx] {
+			t.Errorf("error %d: got %q, expected %q", indx, e, expected[indx])
+		}
+		if !errors.Is(e, diagnostic.ErrSyntax) {
+			t.Errorf("error %d: got %v, expected a syntax error", indx, e)
+		}
+	}
+	// The print after the broken condition and the function are kept,
+	// without the statements that failed to parse.
+	if len(stmts) != 2 {
+		t.Errorf("got %d statements, expected the print and the function", len(stmts))
+	}
+}
+
+func TestParseRecoversFromNestedBlocks(t *testing.T) {
+	input := `print 1 +;
+function f() {
+  let a = 1;
+  while (true {
+    print a;
+  }
+  print a;
+}
+class C {
+  m( { return 1; }
+}
+print (1 + ;
+let b = 1 # 2;
+print "ok";`
+	// Lines and columns of the start and the end of each error's span.
+	expected := []struct {
+		message string
+		span    [4]int
+	}{
+		{"expect expression", [4]int{1, 10, 1, 11}},
+		{"expect ')' after condition", [4]int{4, 15, 4, 16}},
+		{"expect parameter name", [4]int{10, 6, 10, 7}},
+		{"expect expression", [4]int{12, 12, 12, 13}},
+	}
+
+	l := lexer.New(strings.NewReader(input))
+	p := New(l.ScanTokens())
+	stmts, _ := p.Parse()
+	errs := p.Errors()
+	if len(errs) != len(expected) {
+		t.Fatalf("got %d errors, expected %d: %v", len(errs), len(expected), errors.Join(errs...))
+	}
+	for indx, e := range errs {
+		d := diagnostic.List(e)[0]
+		span := [4]int{d.Span.Start.Line, d.Span.Start.Column, d.Span.End.Line, d.Span.End.Column}
+		if d.Message != expected[indx].message || span != expected[indx].span {
+			t.Errorf("error %d: got %q at %v, expected %q at %v", indx, d.Message, span, expected[indx].message, expected[indx].span)
+		}
+	}
+	// The '#' is reported by the lexer only.
+	if len(l.Errors()) != 1 {
+		t.Errorf("got %d lexer errors, expected 1", len(l.Errors()))
+	}
+	// The function keeps its last statement and the last print is parsed.
+	if len(stmts) != 2 {
+		t.Errorf("got %d statements, expected the function and the last print", len(stmts))
+	}
+}
@@ -71,4 +71,30 @@ func (a *AstPrinter) VisitBlockStmt(stmt *ast.BlockStmt) (any, error)       { re
 func (a *AstPrinter) VisitIfStmt(stmt *ast.IfStmt) (any, error)             { return nil, nil }
 func (a *AstPrinter) VisitWhileStmt(stmt *ast.WhileStmt) (any, error)       { return nil, nil }
 func (i *AstPrinter) VisitCallExpr(expr *ast.CallExpr) (any, error)         { return nil, nil }
+func (a *AstPrinter) VisitFunctionExpr(expr *ast.FunctionExpr) (any, error) { return nil, nil }
+func (a *AstPrinter) VisitListExpr(expr *ast.ListExpr) (any, error)         { return nil, nil }
+func (a *AstPrinter) VisitIndexExpr(expr *ast.IndexExpr) (any, error)       { return nil, nil }
+func (a *AstPrinter) VisitSliceExpr(expr *ast.SliceExpr) (any, error)       { return nil, nil }
+func (a *AstPrinter) VisitIndexSetExpr(expr *ast.IndexSetExpr) (any, error) { return nil, nil }
+func (a *AstPrinter) VisitMapExpr(expr *ast.MapExpr) (any, error)           { return nil, nil }
+func (a *AstPrinter) VisitGetExpr(expr *ast.GetExpr) (any, error)           { return nil, nil }
+func (a *AstPrinter) VisitSetExpr(expr *ast.SetExpr) (any, error)           { return nil, nil }
+func (a *AstPrinter) VisitThisExpr(expr *ast.ThisExpr) (any, error)         { return nil, nil }
+func (a *AstPrinter) VisitSuperExpr(expr *ast.SuperExpr) (any, error)       { return nil, nil }
+func (a *AstPrinter) VisitClassStmt(stmt *ast.ClassStmt) (any, error)       { return nil, nil }
+func (a *AstPrinter) VisitRecordStmt(stmt *ast.RecordStmt) (any, error)     { return nil, nil }
+func (a *AstPrinter) VisitWithExpr(expr *ast.WithExpr) (any, error)         { return nil, nil }
+func (a *AstPrinter) VisitImportStmt(stmt *ast.ImportStmt) (any, error)     { return nil, nil }
+func (a *AstPrinter) VisitEmitStmt(stmt *ast.EmitStmt) (any, error)         { return nil, nil }
+func (a *AstPrinter) VisitInterpolationExpr(expr *ast.InterpolationExpr) (any, error) {
+	return nil, nil
+}
+func (a *AstPrinter) VisitCompoundAssignExpr(expr *ast.CompoundAssignExpr) (any, error) {
+	return nil, nil
+}
 func (i *AstPrinter) VisitFunctionStmt(expr *ast.FunctionStmt) (any, error) { return nil, nil }
+func (a *AstPrinter) VisitReturnStmt(stmt *ast.ReturnStmt) (any, error)     { return nil, nil }
+func (a *AstPrinter) VisitBreakStmt(stmt *ast.BreakStmt) (any, error)       { return nil, nil }
+func (a *AstPrinter) VisitContinueStmt(stmt *ast.ContinueStmt) (any, error) { return nil, nil }
+func (a *AstPrinter) VisitThrowStmt(stmt *ast.ThrowStmt) (any, error)       { return nil, nil }
+func (a *AstPrinter) VisitTryStmt(stmt *ast.TryStmt) (any, error)           { return nil, nil }
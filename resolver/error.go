@@ -0,0 +1,11 @@
+package resolver
+
+import (
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/token"
+)
+
+// NewError returns the diagnostic of an error of kind at t.
+func NewError(kind *diagnostic.Kind, t token.Token, message string) diagnostic.Diagnostic {
+	return diagnostic.New(kind, message, diagnostic.TokenSpan(t))
+}
@@ -0,0 +1,169 @@
+package resolver
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/token"
+)
+
+// resolve analyzes a single node. Optional nodes may be nil.
+func (r *Resolver) resolve(node ast.Expr) {
+	if node == nil || reflect.ValueOf(node).IsNil() {
+		return
+	}
+	node.Accept(r)
+}
+
+func (r *Resolver) resolveStmts(stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		r.resolve(stmt)
+	}
+}
+
+// resolveFunction analyzes a function body in a scope of its own, which
+// holds the parameters and the hoisted var declarations of the body.
+func (r *Resolver) resolveFunction(params []token.Token, body []ast.Stmt, function functionType) {
+	enclosing := r.function
+	r.function = function
+	defer func() { r.function = enclosing }()
+
+	r.beginScope(true)
+	for _, param := range params {
+		r.declare(param, bindOther)
+		r.define(param)
+	}
+	r.hoist(body)
+	r.resolveStmts(body)
+	r.endScope()
+}
+
+// resolveLocal records the slot of the variable name, as seen from the
+// current scope. Names that aren't declared yet are bound later,
+// when a scope that declares them ends.
+func (r *Resolver) resolveLocal(expr ast.Expr, name token.Token) {
+	level := len(r.scopes) - 1
+	for indx := level; indx >= 0; indx-- {
+		if v, ok := r.scopes[indx].variables[name.Lexeme]; ok {
+			r.bind(expr, v, indx, level)
+			return
+		}
+	}
+	r.unresolved = append(r.unresolved, reference{expr: expr, name: name, level: level, open: level})
+}
+
+// bind records that expr, used in the scope at index level, refers to the
+// variable v of the scope at index indx.
+func (r *Resolver) bind(expr ast.Expr, v *variable, indx, level int) {
+	slot := Slot{Depth: level - indx, Index: v.index}
+	if indx == 0 {
+		slot.Index = -1
+	}
+	r.slots[expr] = slot
+}
+
+// resolveAssign checks that the variable assigned to isn't a constant.
+func (r *Resolver) resolveAssign(name token.Token) {
+	for indx := len(r.scopes) - 1; indx >= 0; indx-- {
+		if v, ok := r.scopes[indx].variables[name.Lexeme]; ok {
+			if v.binding == bindConst {
+				r.error(diagnostic.ErrConstant, name, fmt.Sprintf("can't assign to constant '%s'", name.Lexeme))
+			}
+			return
+		}
+	}
+}
+
+// hoist declares the var declarations of a function body or program in the
+// current scope, which is where they live at runtime.
+func (r *Resolver) hoist(stmts []ast.Stmt) {
+	for _, v := range ast.HoistedVars(stmts) {
+		r.declare(v.Name, bindVar)
+		r.define(v.Name)
+	}
+}
+
+// declare adds a name to the current scope. Names can only be declared
+// once per scope. The name can't be read until it is defined.
+func (r *Resolver) declare(name token.Token, b binding) {
+	variables := r.scopes[len(r.scopes)-1].variables
+	if v, ok := variables[name.Lexeme]; ok {
+		r.redeclared(name, v, fmt.Sprintf("'%s' is already declared in this scope", name.Lexeme))
+		return
+	}
+	variables[name.Lexeme] = &variable{name: name, binding: b, index: len(variables)}
+}
+
+// define marks a declared name as ready to be read.
+func (r *Resolver) define(name token.Token) {
+	if v, ok := r.scopes[len(r.scopes)-1].variables[name.Lexeme]; ok {
+		v.defined = true
+	}
+}
+
+// declareImplicit adds a name the interpreter defines by itself, such as
+// "this", to the current scope.
+func (r *Resolver) declareImplicit(name string) {
+	variables := r.scopes[len(r.scopes)-1].variables
+	variables[name] = &variable{
+		name:    token.New(token.Position{}, token.IDENTIFIER, name, name),
+		binding: bindOther,
+		defined: true,
+		index:   len(variables),
+	}
+}
+
+func (r *Resolver) beginScope(function bool) {
+	r.scopes = append(r.scopes, &scope{
+		variables: make(map[string]*variable),
+		function:  function,
+	})
+}
+
+// endScope closes the current scope, binding the references still waiting
+// for one of its names. References left when the outermost scope ends use
+// names that are declared nowhere.
+func (r *Resolver) endScope() {
+	level := len(r.scopes) - 1
+	variables := r.scopes[level].variables
+	remaining := r.unresolved[:0]
+	for _, ref := range r.unresolved {
+		if ref.open == level {
+			if v, ok := variables[ref.name.Lexeme]; ok {
+				r.bind(ref.expr, v, level, ref.level)
+				continue
+			}
+			ref.open--
+		}
+		remaining = append(remaining, ref)
+	}
+	r.unresolved = remaining
+	r.scopes = r.scopes[:level]
+
+	if level == 0 {
+		for _, ref := range r.unresolved {
+			if !r.globals[ref.name.Lexeme] {
+				r.error(diagnostic.ErrUndefinedVariable, ref.name, fmt.Sprintf("undefined variable '%s'", ref.name.Lexeme))
+			}
+		}
+		r.unresolved = nil
+	}
+}
+
+func (r *Resolver) error(kind *diagnostic.Kind, t token.Token, message string) {
+	r.errors = append(r.errors, NewError(kind, t, message))
+}
+
+// redeclared reports name, which declares v again, with a note pointing at
+// the earlier declaration. Hoisted vars are declared before the names that
+// precede them in the source, so the two are reported in source order.
+func (r *Resolver) redeclared(name token.Token, v *variable, message string) {
+	first, again := v.name, name
+	if again.Position.Offset < first.Position.Offset {
+		first, again = again, first
+	}
+	d := NewError(diagnostic.ErrRedeclared, again, message)
+	r.errors = append(r.errors, d.WithNote("first declared here", diagnostic.TokenSpan(first)))
+}
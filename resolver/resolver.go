@@ -0,0 +1,442 @@
+// Package resolver implements the static analysis of Sludge programs that
+// runs between parsing and interpretation. It follows the scopes of the
+// program, works out which declaration every variable refers to and
+// reports the mistakes that would otherwise only fail at runtime.
+package resolver
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/token"
+)
+
+// binding describes how a name was declared.
+type binding int
+
+const (
+	bindVar   binding = iota // "var", hoisted to the enclosing function
+	bindLet                  // "let", scoped to the enclosing block
+	bindConst                // "const", like let but can't be assigned
+	bindOther                // Parameters, functions, classes, records and imports
+)
+
+// functionType is the kind of function whose body is being resolved.
+type functionType int
+
+const (
+	noFunction functionType = iota
+	inFunction
+	inMethod
+	inInitializer
+)
+
+// classType is the kind of class whose methods are being resolved.
+type classType int
+
+const (
+	noClass classType = iota
+	inClass
+	inSubclass
+)
+
+type variable struct {
+	name    token.Token // Name token of the declaration
+	binding binding
+	defined bool // Whether the initializer has been resolved
+	index   int  // Position among the declarations of its scope
+}
+
+// Slot locates a variable at runtime: Depth is the number of scopes
+// between the one the variable is used in and the one that declares it,
+// and Index is the position of the variable among the declarations of
+// that scope. Variables of the outermost scope, which the host can extend
+// beyond what the program declares, have the Index -1 and are looked up by
+// name.
+type Slot struct {
+	Depth int
+	Index int
+}
+
+type scope struct {
+	variables map[string]*variable
+	function  bool // Whether the scope is a function body or the program
+}
+
+// reference is a use of a name that isn't declared in any open scope yet.
+// A function may refer to names declared after it in an enclosing scope,
+// so the reference is bound when one of its scopes ends.
+type reference struct {
+	expr  ast.Expr    // Node that uses the name
+	name  token.Token // The name used
+	level int         // Index of the scope the name is used in
+	open  int         // Index of the innermost scope still able to bind it
+}
+
+// Resolver walks the syntax tree of a program, records the slot of every
+// variable reference and collects semantic errors.
+//
+// The scopes of the resolver match the environments of the interpreter:
+// the program, blocks, function bodies with their parameters, and the
+// scopes that hold "this" and "super" for methods.
+type Resolver struct {
+	scopes     []*scope
+	slots      map[ast.Expr]Slot
+	globals    map[string]bool // Names defined before the program runs
+	unresolved []reference
+	function   functionType
+	class      classType
+	errors     []error
+}
+
+// New creates a new resolver. Globals are the names the program can use
+// without declaring them, such as built-in functions.
+func New(globals ...string) *Resolver {
+	r := &Resolver{
+		slots:   make(map[ast.Expr]Slot),
+		globals: make(map[string]bool, len(globals)),
+	}
+	for _, name := range globals {
+		r.globals[name] = true
+	}
+	return r
+}
+
+// Resolve analyzes a program and returns all errors found in it, joined
+// into one, or nil if there are none.
+func (r *Resolver) Resolve(stmts []ast.Stmt) error {
+	r.beginScope(true)
+	r.hoist(stmts)
+	r.resolveStmts(stmts)
+	r.endScope()
+	return errors.Join(r.errors...)
+}
+
+// Slots returns the slot of every resolved variable reference. The keys
+// are the *VariableExpr, *AssignExpr, *VarStmt, *ThisExpr and *SuperExpr
+// nodes of the program. The globals passed to New have no entry.
+func (r *Resolver) Slots() map[ast.Expr]Slot {
+	return r.slots
+}
+
+// Errors returns all errors found by Resolve.
+func (r *Resolver) Errors() []error {
+	return r.errors
+}
+
+func (r *Resolver) VisitPrintStmt(stmt *ast.PrintStmt) (any, error) {
+	r.resolve(stmt.Expession)
+	return nil, nil
+}
+
+func (r *Resolver) VisitExprStmt(stmt *ast.ExprStmt) (any, error) {
+	r.resolve(stmt.Expession)
+	return nil, nil
+}
+
+func (r *Resolver) VisitEmitStmt(stmt *ast.EmitStmt) (any, error) {
+	r.resolve(stmt.Value)
+	return nil, nil
+}
+
+func (r *Resolver) VisitVarStmt(stmt *ast.VarStmt) (any, error) {
+	if stmt.Keyword.Type == token.VAR {
+		r.resolve(stmt.Initializer)
+		// The variable itself was hoisted to the function scope. A let or
+		// const of the same name in a block in between would capture it.
+		indx := len(r.scopes) - 1
+		for ; !r.scopes[indx].function; indx-- {
+			if v, ok := r.scopes[indx].variables[stmt.Name.Lexeme]; ok && v.binding != bindVar {
+				r.redeclared(stmt.Name, v, fmt.Sprintf("'%s' is already declared in an enclosing block", stmt.Name.Lexeme))
+			}
+		}
+		r.bind(stmt, r.scopes[indx].variables[stmt.Name.Lexeme], indx, len(r.scopes)-1)
+		return nil, nil
+	}
+
+	if stmt.Keyword.Type == token.CONST {
+		r.declare(stmt.Name, bindConst)
+	} else {
+		r.declare(stmt.Name, bindLet)
+	}
+	r.resolve(stmt.Initializer)
+	r.define(stmt.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitBlockStmt(stmt *ast.BlockStmt) (any, error) {
+	r.beginScope(false)
+	r.resolveStmts(stmt.Statements)
+	r.endScope()
+	return nil, nil
+}
+
+func (r *Resolver) VisitIfStmt(stmt *ast.IfStmt) (any, error) {
+	r.resolve(stmt.Condition)
+	r.resolve(stmt.ThenBranch)
+	r.resolve(stmt.ElseBranch)
+	return nil, nil
+}
+
+func (r *Resolver) VisitWhileStmt(stmt *ast.WhileStmt) (any, error) {
+	r.resolve(stmt.Condition)
+	r.resolve(stmt.Body)
+	r.resolve(stmt.Increment)
+	return nil, nil
+}
+
+func (r *Resolver) VisitFunctionStmt(stmt *ast.FunctionStmt) (any, error) {
+	r.declare(stmt.Name, bindOther)
+	r.define(stmt.Name)
+	r.resolveFunction(stmt.Params, stmt.Body, inFunction)
+	return nil, nil
+}
+
+func (r *Resolver) VisitFunctionExpr(expr *ast.FunctionExpr) (any, error) {
+	r.resolveFunction(expr.Params, expr.Body, inFunction)
+	return nil, nil
+}
+
+func (r *Resolver) VisitReturnStmt(stmt *ast.ReturnStmt) (any, error) {
+	if r.function == noFunction {
+		r.error(diagnostic.ErrInvalidUse, stmt.Keyword, "can't return from top-level code")
+	}
+	// Initializers always return their instance.
+	if r.function == inInitializer && stmt.Value != nil {
+		r.error(diagnostic.ErrInvalidUse, stmt.Keyword, "can't return a value from an initializer")
+	}
+	r.resolve(stmt.Value)
+	return nil, nil
+}
+
+func (r *Resolver) VisitThrowStmt(stmt *ast.ThrowStmt) (any, error) {
+	r.resolve(stmt.Value)
+	return nil, nil
+}
+
+// VisitTryStmt resolves the body and the finally block of a try statement
+// as blocks. The catch clause is a block too, which starts out declaring
+// the variable that holds the error.
+func (r *Resolver) VisitTryStmt(stmt *ast.TryStmt) (any, error) {
+	r.beginScope(false)
+	r.resolveStmts(stmt.Body)
+	r.endScope()
+	if stmt.Name.Type == token.IDENTIFIER {
+		r.beginScope(false)
+		r.declare(stmt.Name, bindOther)
+		r.define(stmt.Name)
+		r.resolveStmts(stmt.Catch)
+		r.endScope()
+	}
+	if stmt.Finally != nil {
+		r.beginScope(false)
+		r.resolveStmts(stmt.Finally)
+		r.endScope()
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitBreakStmt(stmt *ast.BreakStmt) (any, error) {
+	return nil, nil
+}
+
+func (r *Resolver) VisitContinueStmt(stmt *ast.ContinueStmt) (any, error) {
+	return nil, nil
+}
+
+func (r *Resolver) VisitClassStmt(stmt *ast.ClassStmt) (any, error) {
+	enclosing := r.class
+	r.class = inClass
+	defer func() { r.class = enclosing }()
+
+	r.declare(stmt.Name, bindOther)
+	r.define(stmt.Name)
+	if stmt.Superclass != nil {
+		if stmt.Superclass.Name.Lexeme == stmt.Name.Lexeme {
+			r.error(diagnostic.ErrInvalidUse, stmt.Superclass.Name, "a class can't inherit from itself")
+		}
+		r.resolve(stmt.Superclass)
+		r.class = inSubclass
+		r.beginScope(false)
+		r.declareImplicit("super")
+	}
+
+	// Methods are bound to their instance in a scope that holds "this".
+	r.beginScope(false)
+	r.declareImplicit("this")
+	for _, method := range stmt.Methods {
+		function := inMethod
+		if method.Name.Lexeme == "init" {
+			function = inInitializer
+		}
+		r.resolveFunction(method.Params, method.Body, function)
+	}
+	r.endScope()
+
+	if stmt.Superclass != nil {
+		r.endScope()
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitRecordStmt(stmt *ast.RecordStmt) (any, error) {
+	r.declare(stmt.Name, bindOther)
+	r.define(stmt.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitImportStmt(stmt *ast.ImportStmt) (any, error) {
+	if stmt.Alias.Type == token.IDENTIFIER {
+		r.declare(stmt.Alias, bindOther)
+		r.define(stmt.Alias)
+	}
+	for _, name := range stmt.Names {
+		r.declare(name, bindOther)
+		r.define(name)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitLogicalExpr(expr *ast.LogicalExpr) (any, error) {
+	r.resolve(expr.Left)
+	r.resolve(expr.Right)
+	return nil, nil
+}
+
+func (r *Resolver) VisitCallExpr(expr *ast.CallExpr) (any, error) {
+	r.resolve(expr.Callee)
+	for _, argument := range expr.Arguments {
+		r.resolve(argument)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitBinaryExpr(expr *ast.BinaryExpr) (any, error) {
+	r.resolve(expr.Left)
+	r.resolve(expr.Right)
+	return nil, nil
+}
+
+func (r *Resolver) VisitUnaryExpr(expr *ast.UnaryExpr) (any, error) {
+	r.resolve(expr.Right)
+	return nil, nil
+}
+
+func (r *Resolver) VisitLiteralExpr(expr *ast.LiteralExpr) (any, error) {
+	return nil, nil
+}
+
+func (r *Resolver) VisitGroupingExpr(expr *ast.GroupingExpr) (any, error) {
+	r.resolve(expr.Expession)
+	return nil, nil
+}
+
+func (r *Resolver) VisitVariableExpr(expr *ast.VariableExpr) (any, error) {
+	innermost := r.scopes[len(r.scopes)-1].variables
+	if v, ok := innermost[expr.Name.Lexeme]; ok && !v.defined {
+		r.error(diagnostic.ErrInvalidUse, expr.Name, fmt.Sprintf("can't read '%s' in its own initializer", expr.Name.Lexeme))
+	}
+	r.resolveLocal(expr, expr.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitAssignExpr(expr *ast.AssignExpr) (any, error) {
+	r.resolve(expr.Value)
+	r.resolveLocal(expr, expr.Name)
+	r.resolveAssign(expr.Name)
+	return nil, nil
+}
+
+func (r *Resolver) VisitCompoundAssignExpr(expr *ast.CompoundAssignExpr) (any, error) {
+	r.resolve(expr.Target)
+	r.resolve(expr.Value)
+	if target, ok := expr.Target.(*ast.VariableExpr); ok {
+		r.resolveAssign(target.Name)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitListExpr(expr *ast.ListExpr) (any, error) {
+	for _, element := range expr.Elements {
+		r.resolve(element)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitIndexExpr(expr *ast.IndexExpr) (any, error) {
+	r.resolve(expr.Object)
+	r.resolve(expr.Index)
+	return nil, nil
+}
+
+func (r *Resolver) VisitSliceExpr(expr *ast.SliceExpr) (any, error) {
+	r.resolve(expr.Object)
+	r.resolve(expr.Start)
+	r.resolve(expr.End)
+	return nil, nil
+}
+
+func (r *Resolver) VisitIndexSetExpr(expr *ast.IndexSetExpr) (any, error) {
+	r.resolve(expr.Object)
+	r.resolve(expr.Index)
+	r.resolve(expr.Value)
+	return nil, nil
+}
+
+func (r *Resolver) VisitMapExpr(expr *ast.MapExpr) (any, error) {
+	for indx := range expr.Keys {
+		r.resolve(expr.Keys[indx])
+		r.resolve(expr.Values[indx])
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitGetExpr(expr *ast.GetExpr) (any, error) {
+	r.resolve(expr.Object)
+	return nil, nil
+}
+
+func (r *Resolver) VisitSetExpr(expr *ast.SetExpr) (any, error) {
+	r.resolve(expr.Object)
+	r.resolve(expr.Value)
+	return nil, nil
+}
+
+func (r *Resolver) VisitThisExpr(expr *ast.ThisExpr) (any, error) {
+	if r.class == noClass {
+		r.error(diagnostic.ErrInvalidUse, expr.Keyword, "can't use 'this' outside of a class")
+		return nil, nil
+	}
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *Resolver) VisitSuperExpr(expr *ast.SuperExpr) (any, error) {
+	switch r.class {
+	case noClass:
+		r.error(diagnostic.ErrInvalidUse, expr.Keyword, "can't use 'super' outside of a class")
+		return nil, nil
+	case inClass:
+		r.error(diagnostic.ErrInvalidUse, expr.Keyword, "can't use 'super' in a class with no superclass")
+		return nil, nil
+	}
+	r.resolveLocal(expr, expr.Keyword)
+	return nil, nil
+}
+
+func (r *Resolver) VisitWithExpr(expr *ast.WithExpr) (any, error) {
+	r.resolve(expr.Object)
+	for _, value := range expr.Values {
+		r.resolve(value)
+	}
+	return nil, nil
+}
+
+func (r *Resolver) VisitInterpolationExpr(expr *ast.InterpolationExpr) (any, error) {
+	for _, part := range expr.Parts {
+		r.resolve(part)
+	}
+	return nil, nil
+}
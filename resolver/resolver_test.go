@@ -0,0 +1,170 @@
+package resolver
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+)
+
+func resolve(t *testing.T, input string, globals ...string) (*Resolver, []ast.Stmt, error) {
+	t.Helper()
+	l := lexer.New(strings.NewReader(input))
+	p := parser.New(l.ScanTokens())
+	stmts, err := p.Parse()
+	if err != nil || p.HadError() {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	r := New(globals...)
+	return r, stmts, r.Resolve(stmts)
+}
+
+func TestSlots(t *testing.T) {
+	r, stmts, err := resolve(t, `
+		let a = 1;
+		function f(b) {
+			let c = b;
+			{
+				print a + c;
+			}
+			return g();
+		}
+		function g() {
+			return len([]);
+		}
+	`, "len")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	f := stmts[1].(*ast.FunctionStmt)
+	initializer := f.Body[0].(*ast.VarStmt).Initializer
+	block := f.Body[1].(*ast.BlockStmt)
+	sum := block.Statements[0].(*ast.PrintStmt).Expession.(*ast.BinaryExpr)
+	call := f.Body[2].(*ast.ReturnStmt).Value.(*ast.CallExpr)
+	native := stmts[2].(*ast.FunctionStmt).Body[0].(*ast.ReturnStmt).Value.(*ast.CallExpr)
+
+	tests := []struct {
+		name string
+		expr ast.Expr
+		slot Slot
+		ok   bool
+	}{
+		{name: "parameter", expr: initializer, slot: Slot{Depth: 0, Index: 0}, ok: true},
+		{name: "global from a block in a function", expr: sum.Left, slot: Slot{Depth: 2, Index: -1}, ok: true},
+		{name: "local from a block", expr: sum.Right, slot: Slot{Depth: 1, Index: 1}, ok: true},
+		{name: "function declared later", expr: call.Callee, slot: Slot{Depth: 1, Index: -1}, ok: true},
+		{name: "predefined global", expr: native.Callee, ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			slot, ok := r.Slots()[tt.expr]
+			if ok != tt.ok || slot != tt.slot {
+				t.Errorf("got slot %+v (resolved %v), expected %+v (resolved %v)", slot, ok, tt.slot, tt.ok)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{
+			name:    "own initializer",
+			input:   "{\n  let a = a;\n}",
+			wantErr: "can't read 'a' in its own initializer\n<input>:2:11",
+		},
+		{
+			name:    "top-level return",
+			input:   "return 1;",
+			wantErr: "can't return from top-level code\n<input>:1:1",
+		},
+		{
+			name:    "value returned from an initializer",
+			input:   "class A {\n  init() {\n    let f = () => { return 1; };\n    return 2;\n  }\n}",
+			wantErr: "can't return a value from an initializer\n<input>:4:5",
+		},
+		{
+			name:    "undefined variable",
+			input:   "function f() {\n  return missing;\n}",
+			wantErr: "undefined variable 'missing'\n<input>:2:10",
+		},
+		{
+			name:    "undefined assignment target",
+			input:   "missing = 1;",
+			wantErr: "undefined variable 'missing'",
+		},
+		{
+			name:    "this outside of a class",
+			input:   "print this;",
+			wantErr: "can't use 'this' outside of a class",
+		},
+		{
+			name:    "super without superclass",
+			input:   "class A {\n  f() { return super.f(); }\n}",
+			wantErr: "can't use 'super' in a class with no superclass\n<input>:2:16",
+		},
+		{
+			name:    "catch variable redeclared",
+			input:   "try {} catch (e) {\n  let e = 1;\n}",
+			wantErr: "'e' is already declared in this scope\n<input>:2:7",
+		},
+		{
+			name:    "all errors are reported",
+			input:   "return a;\nreturn b;",
+			wantErr: "can't return from top-level code\n<input>:2:1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := resolve(t, tt.input)
+			if err == nil {
+				t.Fatalf("expected error %q but got none", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %q, expected it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRedeclarationNote(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "let after let", input: "let total = 1;\nlet total = 2;"},
+		// The var is hoisted, so it is declared before the let.
+		{name: "var after let", input: "let total = 1;\nvar total = 2;"},
+		{name: "var after var", input: "var total = 1;\nvar total = 2;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := resolve(t, tt.input)
+			list := diagnostic.List(err)
+			if len(list) != 1 {
+				t.Fatalf("got diagnostics %v, expected one", list)
+			}
+			d := list[0]
+			if !errors.Is(err, diagnostic.ErrRedeclared) || d.Code != diagnostic.ErrRedeclared.Code {
+				t.Errorf("got code %s, expected %s", d.Code, diagnostic.ErrRedeclared.Code)
+			}
+			start, end := diagnostic.FormatPosition(d.Span.Start), diagnostic.FormatPosition(d.Span.End)
+			if start != "<input>:2:5" || end != "<input>:2:10" {
+				t.Errorf("got span %s-%s, expected <input>:2:5-<input>:2:10", start, end)
+			}
+			if len(d.Notes) != 1 || d.Notes[0].Message != "first declared here" ||
+				diagnostic.FormatPosition(d.Notes[0].Span.Start) != "<input>:1:5" {
+				t.Errorf("got notes %v, expected one at the first declaration", d.Notes)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+// Package template renders text templates written in Sludge.
+//
+// A template is literal text with embedded ${ expression } and
+// @{ statements } regions. Expressions are written to the output in place,
+// statements run without producing output of their own. Loops and
+// conditionals can span text by leaving their body open:
+//
+//	@{ for (var i = 0; i < len(hosts); i = i + 1) }
+//	server ${hosts[i].name} ${hosts[i].addr}
+//	@{ end }
+//	@{ if (debug) }log_level = debug@{ else }log_level = info@{ end }
+//
+// A @{...} region that is alone on its line doesn't leave an empty line in
+// the output.
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+)
+
+// Template is a parsed template, ready to be executed any number of times.
+type Template struct {
+	name  string
+	stmts []ast.Stmt
+}
+
+// Parse reads a template from r and compiles it. The name is used in the
+// positions of errors.
+func Parse(name string, r io.Reader) (*Template, error) {
+	l := lexer.NewFile(r, name)
+	tokens := l.ScanTemplate()
+	if errs := l.Errors(); len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	stmts, err := parser.NewTemplate(tokens).Parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Template{name: name, stmts: stmts}, nil
+}
+
+// Name returns the name of the template.
+func (t *Template) Name() string {
+	return t.name
+}
+
+// Execute renders the template to w. Every entry of data is defined as a
+// global variable of the template. Go values are converted to their Sludge
+// counterparts: numbers, strings and booleans as they are, slices and
+// arrays to lists and maps to maps with sorted keys. Unsigned integers too
+// large for an int64 are an error.
+func (t *Template) Execute(w io.Writer, data map[string]any, options ...interpreter.Option) error {
+	i := interpreter.New(append(options, interpreter.WithOutput(w))...)
+	for name, v := range data {
+		converted, err := value(v)
+		if err != nil {
+			return diagnostic.Errorf(diagnostic.ErrType, "template %s: %s: %v", t.name, name, err)
+		}
+		i.Define(name, converted)
+	}
+	if err := i.Resolve(t.stmts); err != nil {
+		return err
+	}
+	_, err := i.Interpret(t.stmts)
+	return err
+}
+
+// value converts a Go value into a Sludge value. Sludge values, such as
+// lists, maps and callables, are passed through as they are.
+func value(v any) (any, error) {
+	switch v := v.(type) {
+	case nil, bool, string, int64, float64:
+		return v, nil
+	case *interpreter.List, *interpreter.Map, interpreter.Callable:
+		return v, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), nil
+	case reflect.String:
+		return rv.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return nil, diagnostic.Errorf(diagnostic.ErrType, "unsigned value %d is out of the range of integers", rv.Uint())
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.Slice, reflect.Array:
+		elements := make([]any, rv.Len())
+		for i := range elements {
+			element, err := value(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return interpreter.NewList(elements), nil
+	case reflect.Map:
+		keys := rv.MapKeys()
+		sort.Slice(keys, func(a, b int) bool {
+			return less(keys[a], keys[b])
+		})
+		m := interpreter.NewMap()
+		for _, key := range keys {
+			k, err := value(key.Interface())
+			if err != nil {
+				return nil, err
+			}
+			element, err := value(rv.MapIndex(key).Interface())
+			if err != nil {
+				return nil, err
+			}
+			if err := m.Set(k, element); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+	return nil, diagnostic.Errorf(diagnostic.ErrType, "unsupported value of type %T", v)
+}
+
+// less orders map keys, so that maps are iterated in a stable order.
+func less(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.String:
+		return a.String() < b.String()
+	}
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
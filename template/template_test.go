@@ -0,0 +1,149 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/diagnostic"
+)
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		data     map[string]any
+		expected string
+	}{
+		{
+			name:     "plain text",
+			input:    "no regions here\n",
+			expected: "no regions here\n",
+		},
+		{
+			name:     "expressions",
+			input:    "Hello, ${name}! ${1 + 2} ${[1, 2]}",
+			data:     map[string]any{"name": "World"},
+			expected: "Hello, World! 3 [1, 2]",
+		},
+		{
+			name: "loop around text",
+			input: `upstream app {
+@{ for (var i = 0; i < len(hosts); i = i + 1) }
+    server ${hosts[i]};
+@{ end }
+}
+`,
+			data:     map[string]any{"hosts": []string{"10.0.0.1", "10.0.0.2"}},
+			expected: "upstream app {\n    server 10.0.0.1;\n    server 10.0.0.2;\n}\n",
+		},
+		{
+			name:     "conditionals",
+			input:    "@{ if (debug) }debug@{ else if (verbose) }verbose@{ else }quiet@{ end }",
+			data:     map[string]any{"debug": false, "verbose": true},
+			expected: "verbose",
+		},
+		{
+			name: "statements define variables",
+			input: `@{ var total = 0; }
+@{ for (var i = 0; i < len(prices); i = i + 1) }
+@{ total = total + prices[i]; }
+@{ end }
+total: ${total}
+`,
+			data:     map[string]any{"prices": []int{1, 2, 3}},
+			expected: "total: 6\n",
+		},
+		{
+			name: "maps and while",
+			input: `@{ var names = keys(env); var i = 0; }
+@{ while (i < len(names)) }
+${names[i]}=${env[names[i]]}
+@{ i = i + 1; }
+@{ end }`,
+			data:     map[string]any{"env": map[string]any{"PORT": 8080, "HOST": "localhost"}},
+			expected: "HOST=localhost\nPORT=8080\n",
+		},
+		{
+			name:     "regions sharing a line keep it",
+			input:    "a @{ var x = 1; } b\n  @{ if (true) }yes@{ end }  \n",
+			expected: "a  b\n  yes  \n",
+		},
+		{
+			name:     "braces and strings inside regions",
+			input:    "${ [\"}\": 1][\"}\"] } @{ if (true) { var s = \"@{\"; } }",
+			expected: "1 ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse("test", strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("unexpected parse error: %v", err)
+			}
+			out := &bytes.Buffer{}
+			if err := tmpl.Execute(out, tt.data); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != tt.expected {
+				t.Errorf("got output %q, expected %q", out.String(), tt.expected)
+			}
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		data    map[string]any
+		wantErr string
+		kind    *diagnostic.Kind
+	}{
+		{
+			name:    "unclosed region",
+			input:   "text @{ if (x) ",
+			wantErr: "unclosed template region",
+		},
+		{
+			name:    "runtime error points into the template",
+			input:   "line one\nvalue: ${1 / 0}",
+			wantErr: "division by zero\ntest:2:12",
+		},
+		{
+			name:    "unsupported data",
+			input:   "${x}",
+			data:    map[string]any{"x": struct{}{}},
+			wantErr: "unsupported value of type struct {}",
+			kind:    diagnostic.ErrType,
+		},
+		{
+			name:    "unsigned data out of range",
+			input:   "${x}",
+			data:    map[string]any{"x": uint64(math.MaxInt64) + 1},
+			wantErr: "unsigned value 9223372036854775808 is out of the range of integers",
+			kind:    diagnostic.ErrType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse("test", strings.NewReader(tt.input))
+			if err == nil {
+				err = tmpl.Execute(&bytes.Buffer{}, tt.data)
+			}
+			if err == nil {
+				t.Fatalf("expected error %q but got none", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %q, expected it to contain %q", err, tt.wantErr)
+			}
+			if tt.kind != nil && !errors.Is(err, tt.kind) {
+				t.Errorf("got error %q, expected it to be %s", err, tt.kind.Code)
+			}
+		})
+	}
+}
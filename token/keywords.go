@@ -19,6 +19,15 @@ var Keywords = map[string]TokenType{
 	"null":     NULL,
 	"import":   IMPORT,
 	"print":    PRINT,
+	"class":    CLASS,
+	"this":     THIS,
+	"super":    SUPER,
+	"record":   RECORD,
+	"with":     WITH,
+	"throw":    THROW,
+	"try":      TRY,
+	"catch":    CATCH,
+	"finally":  FINALLY,
 }
 
 // IsKeyword checks if a given string is a keyword in the language.
@@ -49,7 +49,7 @@ const (
 	INTEGER       TokenType = "INTEGER"       // INTEGER represents an integer literal
 	FLOAT         TokenType = "FLOAT"         // FLOAT represents a floating-point literal
 	INTERPOLATION TokenType = "INTERPOLATION" // INTERPOLATION represents string interpolation "${}"
-	TEMPLATE      TokenType = "TEMPLATE"      // TEMPLATE represents a template expression "@{}"
+	TEMPLATE      TokenType = "TEMPLATE"      // TEMPLATE represents literal text of a template
 
 	// Keywords
 	FUNCTION TokenType = "FUNCTION" // FUNCTION represents the "function" keyword
@@ -68,6 +68,15 @@ const (
 	NULL     TokenType = "NULL"     // NULL represents the "null" literal
 	IMPORT   TokenType = "IMPORT"   // IMPORT represents the "import" keyword
 	PRINT    TokenType = "PRINT"
+	CLASS    TokenType = "CLASS"   // CLASS represents the "class" declaration keyword
+	THIS     TokenType = "THIS"    // THIS represents the "this" instance reference keyword
+	SUPER    TokenType = "SUPER"   // SUPER represents the "super" superclass reference keyword
+	RECORD   TokenType = "RECORD"  // RECORD represents the "record" declaration keyword
+	WITH     TokenType = "WITH"    // WITH represents the "with" copy-update keyword
+	THROW    TokenType = "THROW"   // THROW represents the "throw" statement keyword
+	TRY      TokenType = "TRY"     // TRY represents the "try" statement keyword
+	CATCH    TokenType = "CATCH"   // CATCH represents the "catch" clause keyword
+	FINALLY  TokenType = "FINALLY" // FINALLY represents the "finally" clause keyword
 
 	EOF TokenType = "EOF" // EOF represents the end of file token
 )
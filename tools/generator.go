@@ -12,7 +12,14 @@ func main() {
 	generateDefaultAST()
 }
 
-func generateAST(file string, exprs map[string][]string) {
+// node describes a single AST node type: its Go type name and its fields.
+// Nodes are kept in a slice so the generated files have a stable order.
+type node struct {
+	name   string
+	fields []string
+}
+
+func generateAST(file string, nodes []node) {
 	f, err := os.Create(file)
 	if err != nil {
 		log.Println("GenerageAST error:", err)
@@ -22,7 +29,8 @@ func generateAST(file string, exprs map[string][]string) {
 	fmt.Fprint(f, "package ast\n\n")
 	fmt.Fprint(f, "import \"github.com/Toolnado/sludge/token\"\n\n")
 
-	for expr, fields := range exprs {
+	for _, n := range nodes {
+		expr, fields := n.name, n.fields
 		fmt.Fprint(f, "type ")
 		fmt.Fprint(f, expr)
 		fmt.Fprint(f, " struct {\n")
@@ -37,6 +45,31 @@ func generateAST(file string, exprs map[string][]string) {
 	}
 }
 
+// generateVisitorInterfaces writes the visitor interfaces with one Visit
+// method for every expression and statement node.
+func generateVisitorInterfaces(file string, exprs, stmts []node) {
+	f, err := os.Create(file)
+	if err != nil {
+		log.Println("GenerageAST error:", err)
+		return
+	}
+
+	fmt.Fprint(f, "package ast\n\n")
+	fmt.Fprint(f, "type IASTVisitor interface {\n\tIExprVisitor\n\tIStmtVisitor\n}\n\n")
+
+	fmt.Fprint(f, "type IExprVisitor interface {\n")
+	for _, n := range exprs {
+		fmt.Fprintf(f, "\tVisit%s(expr *%s) (any, error)\n", n.name, n.name)
+	}
+	fmt.Fprint(f, "}\n\n")
+
+	fmt.Fprint(f, "type IStmtVisitor interface {\n")
+	for _, n := range stmts {
+		fmt.Fprintf(f, "\tVisit%s(stmt *%s) (any, error)\n", n.name, n.name)
+	}
+	fmt.Fprint(f, "}\n")
+}
+
 func generateVisitor(expr string, f io.Writer) {
 	r := string(strings.ToLower(expr)[0])
 	if r == "v" {
@@ -74,56 +107,155 @@ func generateConstructor(expr string, fields []string, f io.Writer) {
 }
 
 func generateDefaultAST() {
-	generateAST("expr.go", map[string][]string{
-		"BinaryExpr": {
+	exprs := []node{
+		{"LogicalExpr", []string{
+			"Left Expr",
+			"Operator token.Token",
+			"Right Expr",
+		}},
+		{"CallExpr", []string{
+			"Callee Expr",
+			"Paren token.Token",
+			"Arguments []Expr",
+		}},
+		{"BinaryExpr", []string{
 			"Left Expr",
 			"Operator token.Token",
 			"Right Expr",
-		},
-		"UnaryExpr": {
+		}},
+		{"UnaryExpr", []string{
 			"Operator token.Token",
 			"Right Expr",
-		},
-		"LiteralExpr":  {"Value any"},
-		"GroupingExpr": {"Expession Expr"},
-		"VariableExpr": {"Name token.Token"},
-		"AssignExpr": {
+		}},
+		{"LiteralExpr", []string{"Value any"}},
+		{"GroupingExpr", []string{"Expession Expr"}},
+		{"VariableExpr", []string{"Name token.Token"}},
+		{"AssignExpr", []string{
 			"Name token.Token",
 			"Value Expr",
-		},
-		"LogicalExpr": {
-			"Left Expr",
+		}},
+		{"FunctionExpr", []string{
+			"Keyword token.Token",
+			"Params []token.Token",
+			"Body []Stmt",
+		}},
+		{"ListExpr", []string{
+			"Bracket token.Token",
+			"Elements []Expr",
+		}},
+		{"IndexExpr", []string{
+			"Object Expr",
+			"Bracket token.Token",
+			"Index Expr",
+		}},
+		{"SliceExpr", []string{
+			"Object Expr",
+			"Bracket token.Token",
+			"Start Expr",
+			"End Expr",
+		}},
+		{"IndexSetExpr", []string{
+			"Object Expr",
+			"Bracket token.Token",
+			"Index Expr",
+			"Value Expr",
+		}},
+		{"MapExpr", []string{
+			"Bracket token.Token",
+			"Keys []Expr",
+			"Values []Expr",
+		}},
+		{"GetExpr", []string{
+			"Object Expr",
+			"Name token.Token",
+		}},
+		{"SetExpr", []string{
+			"Object Expr",
+			"Name token.Token",
+			"Value Expr",
+		}},
+		{"ThisExpr", []string{"Keyword token.Token"}},
+		{"SuperExpr", []string{
+			"Keyword token.Token",
+			"Method token.Token",
+		}},
+		{"WithExpr", []string{
+			"Object Expr",
+			"Keyword token.Token",
+			"Names []token.Token",
+			"Values []Expr",
+		}},
+		{"InterpolationExpr", []string{
+			"Start token.Token",
+			"Parts []Expr",
+		}},
+		{"CompoundAssignExpr", []string{
+			"Target Expr",
 			"Operator token.Token",
-			"Right Expr",
-		},
-		"CallExpr": {
-			"Callee Expr",
-			"Paren token.Token",
-			"Arguments []Expr",
-		},
-	})
+			"Value Expr",
+		}},
+	}
 
-	generateAST("stmt.go", map[string][]string{
-		"PrintStmt": {"Expession Expr"},
-		"ExprStmt":  {"Expession Expr"},
-		"VarStmt": {
+	stmts := []node{
+		{"PrintStmt", []string{"Expession Expr"}},
+		{"ExprStmt", []string{"Expession Expr"}},
+		{"VarStmt", []string{
+			"Keyword token.Token",
 			"Name token.Token",
 			"Initializer Expr",
-		},
-		"BlockStmt": {"Statements []Stmt"},
-		"IfStmt": {
+		}},
+		{"BlockStmt", []string{"Statements []Stmt"}},
+		{"IfStmt", []string{
 			"Condition Expr",
 			"ThenBranch Stmt",
 			"ElseBranch Stmt",
-		},
-		"WhileStmt": {
+		}},
+		{"WhileStmt", []string{
 			"Condition Expr",
 			"Body Stmt",
-		},
-		"FunctionStmt": {
+			"Increment Expr",
+		}},
+		{"FunctionStmt", []string{
 			"Name token.Token",
 			"Params []token.Token",
 			"Body []Stmt",
-		},
-	})
+		}},
+		{"ReturnStmt", []string{
+			"Keyword token.Token",
+			"Value Expr",
+		}},
+		{"BreakStmt", []string{"Keyword token.Token"}},
+		{"ContinueStmt", []string{"Keyword token.Token"}},
+		{"ClassStmt", []string{
+			"Name token.Token",
+			"Superclass *VariableExpr",
+			"Methods []*FunctionStmt",
+		}},
+		{"RecordStmt", []string{
+			"Name token.Token",
+			"Fields []token.Token",
+		}},
+		{"ImportStmt", []string{
+			"Keyword token.Token",
+			"Path token.Token",
+			"Alias token.Token",
+			"Names []token.Token",
+		}},
+		{"EmitStmt", []string{"Value Expr"}},
+		{"ThrowStmt", []string{
+			"Keyword token.Token",
+			"Value Expr",
+		}},
+		{"TryStmt", []string{
+			"Keyword token.Token",
+			"Body []Stmt",
+			"Name token.Token",
+			"Catch []Stmt",
+			"Finally []Stmt",
+		}},
+	}
+
+	generateAST("expr.go", exprs)
+	generateAST("stmt.go", stmts)
+	generateVisitorInterfaces("visitor.go", exprs, stmts)
 }
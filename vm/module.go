@@ -0,0 +1,37 @@
+package vm
+
+import (
+	"github.com/Toolnado/sludge/environment"
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/token"
+)
+
+// importModule returns the module at the given import path, running it on
+// first use. Pos is the position of the path in the import statement. A
+// module runs in an environment of its own, which sees the builtins but
+// not the globals of the program that imports it.
+func (vm *VM) importModule(path string, pos token.Position) (*interpreter.Module, error) {
+	name := interpreter.ResolveModule(vm.loading, path)
+	if module, ok := vm.modules[name]; ok {
+		return module, nil
+	}
+	stmts, err := interpreter.ParseModule(vm.loader, vm.loading, name, pos)
+	if err != nil {
+		return nil, err
+	}
+	f, err := vm.compile(stmts, vm.builtins.Names())
+	if err != nil {
+		return nil, err
+	}
+
+	env := environment.NewGlobal(vm.builtins)
+	vm.loading = append(vm.loading, name)
+	err = vm.execute(&Closure{function: f, globals: env})
+	vm.loading = vm.loading[:len(vm.loading)-1]
+	if err != nil {
+		return nil, err
+	}
+	module := interpreter.NewModule(name, env)
+	vm.modules[name] = module
+	return module, nil
+}
@@ -0,0 +1,126 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Toolnado/sludge/compiler"
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/environment"
+	"github.com/Toolnado/sludge/interpreter"
+)
+
+// Closure is the runtime value of a function: its compiled code together
+// with the variables it captured.
+type Closure struct {
+	function *compiler.Function
+	upvalues []*upvalue
+	globals  *environment.Environment // Scope of the module the function was declared in
+}
+
+func (c *Closure) String() string {
+	return c.function.String()
+}
+
+// undeclared fills the slots of local variables whose declaration hasn't
+// run yet.
+type undeclared struct{}
+
+// upvalue is a variable captured by a closure. It refers to a slot of the
+// stack while the variable's scope is running, and holds the value itself
+// once the scope ends.
+type upvalue struct {
+	slot   int
+	closed bool
+	value  any
+}
+
+// Class is the runtime value of a class declaration. Calling a class
+// creates a new instance and runs its "init" method, if any.
+type Class struct {
+	name       string
+	superclass *Class
+	methods    map[string]*Closure
+}
+
+// findMethod looks up a method on the class and then on its superclasses.
+func (c *Class) findMethod(name string) (*Closure, bool) {
+	for class := c; class != nil; class = class.superclass {
+		if method, ok := class.methods[name]; ok {
+			return method, true
+		}
+	}
+	return nil, false
+}
+
+func (c *Class) String() string {
+	return fmt.Sprintf("<class %s>", c.name)
+}
+
+// Instance is an object created by calling a class. Fields are created on
+// first assignment and printed in that order.
+type Instance struct {
+	class  *Class
+	names  []string
+	fields map[string]any
+}
+
+// get returns the field with the given name or, failing that, the method
+// of the same name bound to the instance.
+func (i *Instance) get(name string) (any, error) {
+	if value, ok := i.fields[name]; ok {
+		return value, nil
+	}
+	if method, ok := i.class.findMethod(name); ok {
+		return &BoundMethod{receiver: i, method: method}, nil
+	}
+	return nil, diagnostic.Errorf(diagnostic.ErrUndefinedProperty, "undefined property '%s'", name)
+}
+
+func (i *Instance) set(name string, value any) {
+	if _, ok := i.fields[name]; !ok {
+		i.names = append(i.names, name)
+	}
+	i.fields[name] = value
+}
+
+func (i *Instance) String() string {
+	b := &strings.Builder{}
+	b.WriteString(i.class.name)
+	b.WriteString(" {")
+	for indx, name := range i.names {
+		if indx != 0 {
+			b.WriteString(",")
+		}
+		b.WriteString(" ")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(interpreter.Repr(i.fields[name]))
+	}
+	if len(i.names) != 0 {
+		b.WriteString(" ")
+	}
+	b.WriteString("}")
+	return b.String()
+}
+
+// BoundMethod is a method read from an instance, which it is called on.
+type BoundMethod struct {
+	receiver *Instance
+	method   *Closure
+}
+
+func (b *BoundMethod) String() string {
+	return b.method.String()
+}
+
+// isEqual compares two values as the '==' operator does. Classes and
+// instances of the vm are compared by identity, like those of the
+// interpreter.
+func isEqual(a, b any) bool {
+	switch a.(type) {
+	case *Class, *Instance:
+		return a == b
+	}
+	return interpreter.IsEqual(a, b)
+}
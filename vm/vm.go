@@ -0,0 +1,875 @@
+// Package vm runs the bytecode of the compiler package on a stack of
+// values. Programs give the same output and errors as in the interpreter,
+// whose operators and built-in values the vm shares.
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/Toolnado/sludge/ast"
+	"github.com/Toolnado/sludge/compiler"
+	"github.com/Toolnado/sludge/diagnostic"
+	"github.com/Toolnado/sludge/environment"
+	"github.com/Toolnado/sludge/interpreter"
+	"github.com/Toolnado/sludge/resolver"
+	"github.com/Toolnado/sludge/token"
+)
+
+type VM struct {
+	builtins *environment.Environment // Natives, which programs may shadow
+	globals  *environment.Environment
+	out      io.Writer
+	loader   interpreter.Loader             // Reads the source of imported modules
+	modules  map[string]*interpreter.Module // Modules that have already run, by path
+	loading  []string                       // Paths of the modules currently running
+
+	stack    []any
+	sp       int // Index of the first free slot of the stack
+	frames   []frame
+	open     []*upvalue // Captured variables still on the stack, by slot
+	handlers []handler  // Handlers of the try statements being run, innermost last
+
+	programs     int  // Frames that run the top level of a program or module
+	maxCallDepth int  // How many frames of function calls may exist at once
+	tailCalls    bool // Whether calls in tail position replace the frame of the caller
+}
+
+// frame is a call being run.
+type frame struct {
+	closure *Closure
+	ip      int  // Offset of the next instruction
+	base    int  // Slot of the callee, followed by the locals
+	program bool // Whether the frame runs the top level of a program or module
+
+	// Function whose call in tail position replaced the frame of the
+	// caller with this one, if any, and the offset of that call.
+	tailCaller *compiler.Function
+	tailCall   int
+}
+
+// handler is where the errors raised in a try statement go.
+type handler struct {
+	frame int // Index of the frame running the try statement
+	sp    int // Stack size when the handler was installed
+	ip    int // Offset of the code handling the errors
+}
+
+// caught is an error being handled, on the stack of the code handling it.
+type caught struct {
+	err error
+}
+
+// Option configures a VM created by New.
+type Option func(*VM)
+
+// WithLoader sets the loader used to read imported modules. By default
+// modules are read from disk relative to the working directory.
+func WithLoader(loader interpreter.Loader) Option {
+	return func(vm *VM) {
+		vm.loader = loader
+	}
+}
+
+// WithOutput sets the writer that print statements and template text are
+// written to. By default it is os.Stdout.
+func WithOutput(w io.Writer) Option {
+	return func(vm *VM) {
+		vm.out = w
+	}
+}
+
+// WithMaxCallDepth sets how many calls of functions written in Sludge can
+// run at once. A call beyond that fails with a stack overflow. By default
+// it is interpreter.DefaultMaxCallDepth.
+func WithMaxCallDepth(depth int) Option {
+	return func(vm *VM) {
+		vm.maxCallDepth = depth
+	}
+}
+
+// WithTailCalls sets whether a function that returns the result of
+// calling a function written in Sludge makes that call in its own frame,
+// so that it runs in constant space. Turning it off keeps every call on
+// the call stack of errors. By default it is on.
+func WithTailCalls(enabled bool) Option {
+	return func(vm *VM) {
+		vm.tailCalls = enabled
+	}
+}
+
+func New(options ...Option) *VM {
+	builtins := interpreter.Builtins()
+	vm := &VM{
+		builtins: builtins,
+		globals:  environment.NewGlobal(builtins),
+		out:      os.Stdout,
+		loader:   interpreter.NewFileLoader("."),
+		modules:  make(map[string]*interpreter.Module),
+		stack:    make([]any, 256),
+
+		maxCallDepth: interpreter.DefaultMaxCallDepth,
+		tailCalls:    true,
+	}
+	for _, option := range options {
+		option(vm)
+	}
+	return vm
+}
+
+// Define binds name to value in the global environment, so that the
+// programs run afterwards can refer to it.
+func (vm *VM) Define(name string, value any) {
+	vm.globals.Define(name, value)
+}
+
+// Compile resolves a program and compiles it into a function for Run.
+// Names already defined in the global environment are known to the
+// resolver.
+func (vm *VM) Compile(stmts []ast.Stmt) (*compiler.Function, error) {
+	return vm.compile(stmts, append(vm.builtins.Names(), vm.globals.Names()...))
+}
+
+// compile compiles stmts like Compile, knowing the predefined names only.
+func (vm *VM) compile(stmts []ast.Stmt, predefined []string) (*compiler.Function, error) {
+	r := resolver.New(predefined...)
+	if err := r.Resolve(stmts); err != nil {
+		return nil, err
+	}
+	return compiler.Compile(stmts, r.Slots())
+}
+
+// Run runs a program compiled by Compile in the global environment.
+func (vm *VM) Run(f *compiler.Function) error {
+	return vm.execute(&Closure{function: f, globals: vm.globals})
+}
+
+// execute runs the top level of a program or module to completion.
+func (vm *VM) execute(closure *Closure) error {
+	floor, sp, handlers := len(vm.frames), vm.sp, len(vm.handlers)
+	vm.grow(sp + 1)
+	vm.push(closure)
+	// The frame is counted as a program before it is pushed, so that it
+	// never counts as a call.
+	vm.programs++
+	err := vm.callClosure(closure, 0)
+	if err == nil {
+		vm.frames[floor].program = true
+		err = vm.run(floor)
+	}
+	if err != nil {
+		vm.closeUpvalues(sp)
+		vm.frames = vm.frames[:floor]
+		vm.handlers = vm.handlers[:handlers]
+	}
+	vm.programs--
+	vm.sp = sp
+	return err
+}
+
+// run runs the innermost frame, and the frames it calls, until it returns.
+// Floor is the index of that frame. Errors raised in a try statement of
+// these frames go to its handler.
+func (vm *VM) run(floor int) error {
+	for {
+		err := vm.dispatch(floor)
+		if err == nil || !vm.handle(err, floor) {
+			return err
+		}
+	}
+}
+
+// handle makes the innermost handler of the frames from floor on handle
+// err, dropping the frames and values above the handler's. It reports
+// false if there is no such handler.
+func (vm *VM) handle(err error, floor int) bool {
+	n := len(vm.handlers)
+	if n == 0 || vm.handlers[n-1].frame < floor {
+		return false
+	}
+	h := vm.handlers[n-1]
+	vm.handlers = vm.handlers[:n-1]
+	vm.closeUpvalues(h.sp)
+	vm.frames = vm.frames[:h.frame+1]
+	vm.frames[h.frame].ip = h.ip
+	vm.sp = h.sp
+	vm.push(caught{err: err})
+	return true
+}
+
+// dispatch runs instructions of the innermost frame, and the frames it
+// calls, until the frame at floor returns or an error is raised.
+func (vm *VM) dispatch(floor int) error {
+	frame := &vm.frames[len(vm.frames)-1]
+	closure := frame.closure
+	code, constants := closure.function.Code, closure.function.Constants
+	ip, base := frame.ip, frame.base
+
+	for {
+		start := ip
+		op := compiler.Opcode(code[ip])
+		ip++
+
+		switch op {
+		case compiler.OpConstant:
+			vm.push(constants[read16(code, ip)])
+			ip += 2
+		case compiler.OpNil:
+			vm.push(nil)
+		case compiler.OpTrue:
+			vm.push(true)
+		case compiler.OpFalse:
+			vm.push(false)
+		case compiler.OpPop:
+			vm.sp--
+		case compiler.OpDup:
+			vm.push(vm.stack[vm.sp-1])
+		case compiler.OpDup2:
+			vm.push(vm.stack[vm.sp-2])
+			vm.push(vm.stack[vm.sp-2])
+
+		case compiler.OpGetLocal:
+			vm.push(vm.stack[base+int(code[ip])])
+			ip++
+		case compiler.OpSetLocal:
+			vm.stack[base+int(code[ip])] = vm.stack[vm.sp-1]
+			ip++
+		case compiler.OpGetUpvalue:
+			u := closure.upvalues[code[ip]]
+			ip++
+			if u.closed {
+				vm.push(u.value)
+			} else {
+				vm.push(vm.stack[u.slot])
+			}
+		case compiler.OpSetUpvalue:
+			u := closure.upvalues[code[ip]]
+			ip++
+			if u.closed {
+				u.value = vm.stack[vm.sp-1]
+			} else {
+				vm.stack[u.slot] = vm.stack[vm.sp-1]
+			}
+
+		case compiler.OpGetGlobal, compiler.OpGetName:
+			name := identifier(constants, code, ip)
+			ip += 2
+			var value any
+			var err error
+			if op == compiler.OpGetGlobal {
+				value, err = closure.globals.GetAt(0, -1, name)
+			} else {
+				value, err = closure.globals.Get(name)
+			}
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.push(value)
+		case compiler.OpSetGlobal, compiler.OpSetName:
+			name := identifier(constants, code, ip)
+			ip += 2
+			var err error
+			if op == compiler.OpSetGlobal {
+				_, err = closure.globals.AssignAt(0, -1, name, vm.stack[vm.sp-1])
+			} else {
+				_, err = closure.globals.Assign(name, vm.stack[vm.sp-1])
+			}
+			if err != nil {
+				return vm.fail(err, start)
+			}
+		case compiler.OpDeclareGlobal, compiler.OpDeclareConst:
+			name := identifier(constants, code, ip)
+			ip += 2
+			declare := closure.globals.Declare
+			if op == compiler.OpDeclareConst {
+				declare = closure.globals.DeclareConst
+			}
+			if err := declare(name, vm.pop()); err != nil {
+				return vm.fail(err, start)
+			}
+		case compiler.OpHoistGlobal:
+			name := identifier(constants, code, ip)
+			ip += 2
+			if _, ok := closure.globals.Lookup(name.Lexeme); !ok {
+				closure.globals.Define(name.Lexeme, nil)
+			}
+		case compiler.OpCloseUpvalues:
+			vm.closeUpvalues(base + int(code[ip]))
+			ip++
+		case compiler.OpUndeclare:
+			slot := base + int(code[ip])
+			for indx := 0; indx < int(code[ip+1]); indx++ {
+				vm.stack[slot+indx] = undeclared{}
+			}
+			ip += 2
+		case compiler.OpCheckLocal, compiler.OpCheckUpvalue:
+			var value any
+			if op == compiler.OpCheckLocal {
+				value = vm.stack[base+int(code[ip])]
+			} else if u := closure.upvalues[code[ip]]; u.closed {
+				value = u.value
+			} else {
+				value = vm.stack[u.slot]
+			}
+			if _, ok := value.(undeclared); ok {
+				name := identifier(constants, code, ip+1)
+				return vm.fail(diagnostic.Errorf(diagnostic.ErrUndefinedVariable, "undefined variable '%s'", name.Lexeme), start)
+			}
+			ip += 3
+		case compiler.OpCheckSuperclass:
+			if _, ok := vm.stack[vm.sp-1].(*Class); !ok {
+				return vm.fail(diagnostic.Errorf(diagnostic.ErrType, "superclass must be a class"), start)
+			}
+
+		case compiler.OpAdd:
+			right := vm.pop()
+			left := vm.stack[vm.sp-1]
+			if l, ok := left.(int64); ok {
+				if r, ok := right.(int64); ok {
+					vm.stack[vm.sp-1] = l + r
+					continue
+				}
+			}
+			value, err := interpreter.Add(left, right)
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.stack[vm.sp-1] = value
+		case compiler.OpSubtract, compiler.OpMultiply, compiler.OpDivide, compiler.OpModulo:
+			right := vm.pop()
+			left := vm.stack[vm.sp-1]
+			if l, ok := left.(int64); ok {
+				if r, ok := right.(int64); ok {
+					switch op {
+					case compiler.OpSubtract:
+						vm.stack[vm.sp-1] = l - r
+						continue
+					case compiler.OpMultiply:
+						vm.stack[vm.sp-1] = l * r
+						continue
+					}
+				}
+			}
+			value, err := interpreter.Arithmetic(arithmetic[op], left, right)
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.stack[vm.sp-1] = value
+		case compiler.OpEqual:
+			right := vm.pop()
+			vm.stack[vm.sp-1] = isEqual(vm.stack[vm.sp-1], right)
+		case compiler.OpNotEqual:
+			right := vm.pop()
+			vm.stack[vm.sp-1] = !isEqual(vm.stack[vm.sp-1], right)
+		case compiler.OpLess, compiler.OpLessEqual, compiler.OpGreater, compiler.OpGreaterEqual:
+			right := vm.pop()
+			left := vm.stack[vm.sp-1]
+			if l, ok := left.(int64); ok {
+				if r, ok := right.(int64); ok {
+					vm.stack[vm.sp-1] = compareInts(op, l, r)
+					continue
+				}
+			}
+			value, err := interpreter.Compare(comparison[op], left, right)
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.stack[vm.sp-1] = value
+		case compiler.OpNegate:
+			value, err := interpreter.Negate(vm.stack[vm.sp-1])
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.stack[vm.sp-1] = value
+		case compiler.OpNot:
+			vm.stack[vm.sp-1] = !interpreter.IsTruthy(vm.stack[vm.sp-1])
+
+		case compiler.OpJump:
+			ip += 2 + read16(code, ip)
+		case compiler.OpJumpIfFalse:
+			if interpreter.IsTruthy(vm.pop()) {
+				ip += 2
+			} else {
+				ip += 2 + read16(code, ip)
+			}
+		case compiler.OpJumpIfFalseOrPop:
+			if interpreter.IsTruthy(vm.stack[vm.sp-1]) {
+				vm.sp--
+				ip += 2
+			} else {
+				ip += 2 + read16(code, ip)
+			}
+		case compiler.OpJumpIfTrueOrPop:
+			if interpreter.IsTruthy(vm.stack[vm.sp-1]) {
+				ip += 2 + read16(code, ip)
+			} else {
+				vm.sp--
+				ip += 2
+			}
+		case compiler.OpLoop:
+			ip += 2 - read16(code, ip)
+
+		case compiler.OpTry:
+			vm.handlers = append(vm.handlers, handler{
+				frame: len(vm.frames) - 1,
+				sp:    vm.sp,
+				ip:    ip + 2 + read16(code, ip),
+			})
+			ip += 2
+		case compiler.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case compiler.OpThrow:
+			pos := closure.function.Position(start)
+			return vm.trace(interpreter.Throw(vm.pop(), pos))
+		case compiler.OpCatch:
+			// The error was reported and traced where it was raised.
+			err := vm.stack[vm.sp-1].(caught).err
+			value, ok := interpreter.Caught(err)
+			if !ok {
+				vm.sp--
+				return err
+			}
+			vm.stack[vm.sp-1] = value
+		case compiler.OpRethrow:
+			return vm.pop().(caught).err
+
+		case compiler.OpCall, compiler.OpTailCall:
+			argc := int(code[ip])
+			ip++
+			frame.ip = ip
+			var err error
+			if op == compiler.OpTailCall && vm.tailCalls {
+				err = vm.tailCall(vm.stack[vm.sp-argc-1], argc, start)
+			} else {
+				err = vm.call(vm.stack[vm.sp-argc-1], argc)
+			}
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			closure = frame.closure
+			code, constants = closure.function.Code, closure.function.Constants
+			ip, base = frame.ip, frame.base
+		case compiler.OpClosure:
+			function := constants[read16(code, ip)].(*compiler.Function)
+			ip += 2
+			c := &Closure{
+				function: function,
+				upvalues: make([]*upvalue, function.Upvalues),
+				globals:  closure.globals,
+			}
+			for indx := range c.upvalues {
+				if code[ip] == 1 {
+					c.upvalues[indx] = vm.capture(base + int(code[ip+1]))
+				} else {
+					c.upvalues[indx] = closure.upvalues[code[ip+1]]
+				}
+				ip += 2
+			}
+			vm.push(c)
+		case compiler.OpReturn:
+			result := vm.stack[vm.sp-1]
+			vm.closeUpvalues(base)
+			vm.stack[base] = result
+			vm.sp = base + 1
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == floor {
+				return nil
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			closure = frame.closure
+			code, constants = closure.function.Code, closure.function.Constants
+			ip, base = frame.ip, frame.base
+
+		case compiler.OpList:
+			n := read16(code, ip)
+			ip += 2
+			elements := make([]any, n)
+			copy(elements, vm.stack[vm.sp-n:vm.sp])
+			vm.sp -= n
+			vm.push(interpreter.NewList(elements))
+		case compiler.OpMap:
+			vm.push(interpreter.NewMap())
+		case compiler.OpMapEntry:
+			value := vm.pop()
+			key := vm.pop()
+			if err := vm.stack[vm.sp-1].(*interpreter.Map).Set(key, value); err != nil {
+				return vm.fail(err, start)
+			}
+		case compiler.OpGetIndex:
+			index := vm.pop()
+			value, err := interpreter.GetIndex(vm.stack[vm.sp-1], index)
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.stack[vm.sp-1] = value
+		case compiler.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			if err := interpreter.SetIndex(vm.stack[vm.sp-1], index, value); err != nil {
+				return vm.fail(err, start)
+			}
+			vm.stack[vm.sp-1] = value
+		case compiler.OpSlice:
+			high := vm.pop()
+			low := vm.pop()
+			value, err := interpreter.Slice(vm.stack[vm.sp-1], low, high)
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.stack[vm.sp-1] = value
+		case compiler.OpGetProperty:
+			name := identifier(constants, code, ip)
+			ip += 2
+			value, err := getProperty(vm.stack[vm.sp-1], name)
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.stack[vm.sp-1] = value
+		case compiler.OpGetPropertyKeep:
+			name := identifier(constants, code, ip)
+			ip += 2
+			object := vm.stack[vm.sp-1]
+			value, err := getProperty(object, name)
+			if err == nil {
+				err = checkSetProperty(object, name)
+			}
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.push(value)
+		case compiler.OpCheckProperty:
+			name := identifier(constants, code, ip)
+			ip += 2
+			if err := checkSetProperty(vm.stack[vm.sp-1], name); err != nil {
+				return vm.fail(err, start)
+			}
+		case compiler.OpSetProperty:
+			name := identifier(constants, code, ip)
+			ip += 2
+			value := vm.pop()
+			setProperty(vm.stack[vm.sp-1], name, value)
+			vm.stack[vm.sp-1] = value
+		case compiler.OpInterpolate:
+			n := read16(code, ip)
+			ip += 2
+			b := &strings.Builder{}
+			for _, part := range vm.stack[vm.sp-n : vm.sp] {
+				b.WriteString(interpreter.Stringify(part))
+			}
+			vm.sp -= n
+			vm.push(b.String())
+		case compiler.OpCheckRecord:
+			if _, ok := vm.stack[vm.sp-1].(*interpreter.RecordValue); !ok {
+				return vm.fail(diagnostic.Errorf(diagnostic.ErrType, "can only use 'with' on records"), start)
+			}
+		case compiler.OpWith:
+			names := constants[read16(code, ip)].([]string)
+			ip += 2
+			values := make([]any, len(names))
+			copy(values, vm.stack[vm.sp-len(names):vm.sp])
+			vm.sp -= len(names)
+			updated, err := vm.stack[vm.sp-1].(*interpreter.RecordValue).With(names, values)
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.stack[vm.sp-1] = updated
+
+		case compiler.OpClass:
+			name := constants[read16(code, ip)].(string)
+			ip += 2
+			vm.push(&Class{name: name, methods: make(map[string]*Closure)})
+		case compiler.OpInherit:
+			superclass := vm.pop().(*Class)
+			vm.stack[vm.sp-1].(*Class).superclass = superclass
+		case compiler.OpMethod:
+			name := constants[read16(code, ip)].(string)
+			ip += 2
+			method := vm.pop().(*Closure)
+			vm.stack[vm.sp-1].(*Class).methods[name] = method
+		case compiler.OpGetSuper:
+			name := constants[read16(code, ip)].(string)
+			ip += 2
+			superclass := vm.pop().(*Class)
+			method, ok := superclass.findMethod(name)
+			if !ok {
+				return vm.fail(diagnostic.Errorf(diagnostic.ErrUndefinedProperty, "undefined property '%s'", name), start)
+			}
+			vm.stack[vm.sp-1] = &BoundMethod{receiver: vm.stack[vm.sp-1].(*Instance), method: method}
+		case compiler.OpRecord:
+			declaration := constants[read16(code, ip)].([]string)
+			ip += 2
+			vm.push(interpreter.NewRecord(declaration[0], declaration[1:]))
+		case compiler.OpImport:
+			path := constants[read16(code, ip)].(string)
+			ip += 2
+			frame.ip = ip
+			pos := closure.function.Position(start)
+			module, err := vm.importModule(path, pos)
+			if err != nil {
+				return vm.trace(err)
+			}
+			// Running the module may have grown the stack and the frames.
+			frame = &vm.frames[len(vm.frames)-1]
+			vm.push(module)
+		case compiler.OpImportName:
+			name := identifier(constants, code, ip)
+			ip += 2
+			value, err := vm.stack[vm.sp-1].(*interpreter.Module).Get(name)
+			if err != nil {
+				return vm.fail(err, start)
+			}
+			vm.push(value)
+
+		case compiler.OpPrint:
+			fmt.Fprintln(vm.out, interpreter.Stringify(vm.pop()))
+		case compiler.OpEmit:
+			if _, err := fmt.Fprint(vm.out, interpreter.Stringify(vm.pop())); err != nil {
+				return vm.trace(err)
+			}
+
+		default:
+			return vm.fail(diagnostic.Errorf(diagnostic.ErrRuntime, "unknown instruction %s", op), start)
+		}
+	}
+}
+
+// call calls callee with the argc arguments above it on the stack.
+// Closures, bound methods and initializers get a new frame, which run then
+// executes. Other callables run at once and their result replaces the
+// callee and the arguments.
+func (vm *VM) call(callee any, argc int) error {
+	switch c := callee.(type) {
+	case *Closure:
+		return vm.callClosure(c, argc)
+	case *BoundMethod:
+		vm.stack[vm.sp-argc-1] = c.receiver
+		return vm.callClosure(c.method, argc)
+	case *Class:
+		instance := &Instance{class: c, fields: make(map[string]any)}
+		vm.stack[vm.sp-argc-1] = instance
+		if initializer, ok := c.findMethod("init"); ok {
+			return vm.callClosure(initializer, argc)
+		}
+		if argc != 0 {
+			return diagnostic.Errorf(diagnostic.ErrArity, "expected 0 arguments, but got %d", argc)
+		}
+		return nil
+	case interpreter.Callable:
+		if argc != c.Arity() {
+			return diagnostic.Errorf(diagnostic.ErrArity, "expected %d arguments, but got %d", c.Arity(), argc)
+		}
+		arguments := make([]any, argc)
+		copy(arguments, vm.stack[vm.sp-argc:vm.sp])
+		value, err := c.Call(nil, arguments)
+		if err != nil {
+			return err
+		}
+		vm.sp -= argc
+		vm.stack[vm.sp-1] = value
+		return nil
+	default:
+		return diagnostic.Errorf(diagnostic.ErrNotCallable, "can only call functions and classes")
+	}
+}
+
+// tailCall calls callee with the argc arguments above it on the stack, by
+// the instruction at offset of the innermost frame, which then returns the
+// result. Closures and bound methods take over that frame instead of
+// getting a new one. Other callees are called as usual.
+func (vm *VM) tailCall(callee any, argc int, offset int) error {
+	var c *Closure
+	switch callee := callee.(type) {
+	case *Closure:
+		c = callee
+	case *BoundMethod:
+		vm.stack[vm.sp-argc-1] = callee.receiver
+		c = callee.method
+	default:
+		return vm.call(callee, argc)
+	}
+	if argc != c.function.Arity {
+		return diagnostic.Errorf(diagnostic.ErrArity, "expected %d arguments, but got %d", c.function.Arity, argc)
+	}
+
+	caller := vm.frames[len(vm.frames)-1]
+	vm.closeUpvalues(caller.base)
+	copy(vm.stack[caller.base:], vm.stack[vm.sp-argc-1:vm.sp])
+	vm.sp = caller.base + argc + 1
+	vm.frames = vm.frames[:len(vm.frames)-1]
+	// With the caller's frame gone, the call can't be one too many.
+	vm.callClosure(c, argc)
+	f := &vm.frames[len(vm.frames)-1]
+	f.tailCaller, f.tailCall = caller.closure.function, offset
+	return nil
+}
+
+// callClosure pushes the frame of a call to a closure whose arguments are
+// on top of the stack.
+func (vm *VM) callClosure(c *Closure, argc int) error {
+	f := c.function
+	if argc != f.Arity {
+		return diagnostic.Errorf(diagnostic.ErrArity, "expected %d arguments, but got %d", f.Arity, argc)
+	}
+	if len(vm.frames)-vm.programs >= vm.maxCallDepth {
+		return interpreter.StackOverflow(vm.maxCallDepth)
+	}
+	base := vm.sp - argc - 1
+	vm.grow(base + f.Slots)
+	// Hoisted variables start out as nil.
+	for slot := vm.sp; slot < base+f.Locals; slot++ {
+		vm.stack[slot] = nil
+	}
+	vm.sp = base + f.Locals
+	vm.frames = append(vm.frames, frame{closure: c, base: base})
+	return nil
+}
+
+// callStack returns the calls of functions that are running, outermost
+// first. Each was called by the instruction before the one its caller
+// resumes at, unless it replaced the frame of a call in tail position.
+func (vm *VM) callStack() []interpreter.CallFrame {
+	var stack []interpreter.CallFrame
+	for indx := 1; indx < len(vm.frames); indx++ {
+		if vm.frames[indx].program {
+			continue
+		}
+		f, caller := vm.frames[indx], vm.frames[indx-1]
+		var pos token.Position
+		if f.tailCaller != nil {
+			pos = f.tailCaller.Position(f.tailCall)
+		} else {
+			pos = caller.closure.function.Position(caller.ip - 2)
+		}
+		stack = append(stack, interpreter.CallFrame{Function: f.closure.function.Name, Position: pos})
+	}
+	return stack
+}
+
+// capture returns the upvalue of the variable in slot, shared by all the
+// closures that capture it.
+func (vm *VM) capture(slot int) *upvalue {
+	indx := len(vm.open)
+	for indx > 0 && vm.open[indx-1].slot >= slot {
+		if vm.open[indx-1].slot == slot {
+			return vm.open[indx-1]
+		}
+		indx--
+	}
+	u := &upvalue{slot: slot}
+	vm.open = append(vm.open, nil)
+	copy(vm.open[indx+1:], vm.open[indx:])
+	vm.open[indx] = u
+	return u
+}
+
+// closeUpvalues moves the variables captured from slot upwards off the
+// stack, into their upvalues.
+func (vm *VM) closeUpvalues(slot int) {
+	indx := len(vm.open)
+	for indx > 0 && vm.open[indx-1].slot >= slot {
+		u := vm.open[indx-1]
+		u.value = vm.stack[u.slot]
+		u.closed = true
+		indx--
+	}
+	vm.open = vm.open[:indx]
+}
+
+// fail reports an error raised by the instruction at offset of the
+// innermost frame, at the position of that instruction.
+func (vm *VM) fail(err error, offset int) error {
+	f := vm.frames[len(vm.frames)-1]
+	return vm.trace(interpreter.Wrap(err, f.closure.function.Position(offset)))
+}
+
+// trace records the calls running in an error raised by the innermost
+// frame.
+func (vm *VM) trace(err error) error {
+	return interpreter.Trace(err, vm.callStack())
+}
+
+func (vm *VM) push(value any) {
+	vm.stack[vm.sp] = value
+	vm.sp++
+}
+
+func (vm *VM) pop() any {
+	vm.sp--
+	return vm.stack[vm.sp]
+}
+
+// grow makes room for size slots on the stack.
+func (vm *VM) grow(size int) {
+	if size <= len(vm.stack) {
+		return
+	}
+	stack := make([]any, max(size, 2*len(vm.stack)))
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
+
+// arithmetic and comparison map instructions to the operators of the
+// interpreter package.
+var (
+	arithmetic = map[compiler.Opcode]token.TokenType{
+		compiler.OpSubtract: token.MINUS,
+		compiler.OpMultiply: token.STAR,
+		compiler.OpDivide:   token.SLASH,
+		compiler.OpModulo:   token.PERCENT,
+	}
+	comparison = map[compiler.Opcode]token.TokenType{
+		compiler.OpLess:         token.LESS,
+		compiler.OpLessEqual:    token.LESS_EQUAL,
+		compiler.OpGreater:      token.GREATER,
+		compiler.OpGreaterEqual: token.GREATER_EQUAL,
+	}
+)
+
+func compareInts(op compiler.Opcode, l, r int64) bool {
+	switch op {
+	case compiler.OpLess:
+		return l < r
+	case compiler.OpLessEqual:
+		return l <= r
+	case compiler.OpGreater:
+		return l > r
+	default:
+		return l >= r
+	}
+}
+
+// read16 decodes the two-byte operand at offset.
+func read16(code []byte, offset int) int {
+	return int(code[offset])<<8 | int(code[offset+1])
+}
+
+// identifier returns the name in the constant referred to by the operand
+// at offset.
+func identifier(constants []any, code []byte, offset int) token.Token {
+	return token.Token{Lexeme: constants[read16(code, offset)].(string)}
+}
+
+func getProperty(object any, name token.Token) (any, error) {
+	if instance, ok := object.(*Instance); ok {
+		return instance.get(name.Lexeme)
+	}
+	return interpreter.GetProperty(object, name)
+}
+
+func checkSetProperty(object any, name token.Token) error {
+	if _, ok := object.(*Instance); ok {
+		return nil
+	}
+	return interpreter.CheckSetProperty(object, name)
+}
+
+func setProperty(object any, name token.Token, value any) {
+	if instance, ok := object.(*Instance); ok {
+		instance.set(name.Lexeme, value)
+		return
+	}
+	interpreter.SetProperty(object, name, value)
+}
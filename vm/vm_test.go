@@ -0,0 +1,215 @@
+package vm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Toolnado/sludge/lexer"
+	"github.com/Toolnado/sludge/parser"
+)
+
+// run compiles and runs each input in turn on vm, returning everything
+// written by print statements. The output and errors of programs in
+// general are tested against the interpreter's in the interpreter package.
+func run(vm *VM, inputs ...string) (string, error) {
+	out := &bytes.Buffer{}
+	vm.out = out
+	for _, input := range inputs {
+		l := lexer.New(strings.NewReader(input))
+		stmts, err := parser.New(l.ScanTokens()).Parse()
+		if err != nil {
+			return "", err
+		}
+		f, err := vm.Compile(stmts)
+		if err != nil {
+			return out.String(), err
+		}
+		if err := vm.Run(f); err != nil {
+			return out.String(), err
+		}
+	}
+	return out.String(), nil
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		inputs   []string
+		expected string
+	}{
+		{
+			name: "closures share captured variables",
+			inputs: []string{`
+				function pair() {
+					let n = 0;
+					let inc = function() { n += 1; };
+					let get = function() { return n; };
+					return [inc, get];
+				}
+				let p = pair();
+				p[0]();
+				p[0]();
+				print p[1]();
+			`},
+			expected: "2\n",
+		},
+		{
+			name: "loop bodies capture a fresh variable per iteration",
+			inputs: []string{`
+				let fns = [null, null, null];
+				for (let i = 0; i < 3; i += 1) {
+					let j = i;
+					fns[i] = function() { return j; };
+				}
+				print fns[0]() + fns[1]() + fns[2]();
+			`},
+			expected: "3\n",
+		},
+		{
+			name: "finally blocks run by return see the function's locals",
+			inputs: []string{`
+				function f() {
+					var i = 5;
+					try {
+						let z = 1;
+						let y = 2;
+						return i;
+					} finally {
+						print i;
+					}
+				}
+				print f();
+			`},
+			expected: "5\n5\n",
+		},
+		{
+			name: "finally blocks run by break and continue see the loop's locals",
+			inputs: []string{`
+				for (let i = 0; i < 3; i += 1) {
+					let w = 10;
+					try {
+						let q = 1;
+						break;
+					} finally {
+						print w;
+					}
+				}
+				for (let i = 0; i < 2; i += 1) {
+					let w = 10 + i;
+					try {
+						let q = 99;
+						let r = 98;
+						continue;
+					} finally {
+						let sum = i + w;
+						print sum;
+					}
+				}
+			`},
+			expected: "10\n10\n12\n",
+		},
+		{
+			name: "nested finally blocks run by a jump out of a catch clause",
+			inputs: []string{`
+				function f() {
+					let n = 4;
+					try {
+						let a = 1;
+						try {
+							throw 2;
+						} catch (e) {
+							let m = 3;
+							return n + e + m;
+						} finally {
+							let b = n * 10;
+							print b;
+						}
+					} finally {
+						print n;
+					}
+				}
+				print f();
+			`},
+			expected: "40\n4\n9\n",
+		},
+		{
+			name: "deep recursion grows the stack",
+			inputs: []string{`
+				function depth(n) {
+					if (n == 0) return 0;
+					return 1 + depth(n - 1);
+				}
+				print depth(1000);
+			`},
+			expected: "1000\n",
+		},
+		{
+			name:     "globals persist between programs",
+			inputs:   []string{"let a = 1;", "function f() { return a + 1; }", "print f();"},
+			expected: "2\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := run(New(), tt.inputs...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got output %q, expected %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDefine(t *testing.T) {
+	vm := New()
+	vm.Define("answer", int64(42))
+	got, err := run(vm, "print answer;")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "42\n" {
+		t.Errorf("got output %q, expected %q", got, "42\n")
+	}
+}
+
+// TestErrorResetsState checks that a failed program leaves the vm ready to
+// run the next one.
+func TestErrorResetsState(t *testing.T) {
+	vm := New()
+	_, err := run(vm, "function f() { return 1 / 0; }\nprint f();")
+	if err == nil || !strings.Contains(err.Error(), "division by zero\n<input>:1:25") {
+		t.Fatalf("got error %v, expected division by zero", err)
+	}
+	if vm.sp != 0 || len(vm.frames) != 0 || len(vm.open) != 0 {
+		t.Fatalf("got sp %d, %d frames and %d open upvalues after an error", vm.sp, len(vm.frames), len(vm.open))
+	}
+	got, err := run(vm, "print 1;")
+	if err != nil || got != "1\n" {
+		t.Errorf("got output %q and error %v, expected %q", got, err, "1\n")
+	}
+}
+
+// TestMaxCallDepth checks that the limit counts calls of functions only,
+// not the programs run, and that an overflow leaves no frames behind.
+func TestMaxCallDepth(t *testing.T) {
+	vm := New(WithMaxCallDepth(3))
+	_, err := run(vm, "function f(n) {\n  if (n > 0) f(n - 1);\n}\nf(2);", "f(3);")
+	if err == nil || !strings.HasPrefix(err.Error(), "stack overflow: more than 3 nested calls\n<input>:2:21\n  f called at <input>:2:21 (2 times)\n  f called at <input>:1:4") {
+		t.Fatalf("got error %v, expected stack overflow", err)
+	}
+	if vm.programs != 0 || len(vm.frames) != 0 {
+		t.Fatalf("got %d programs and %d frames after an error", vm.programs, len(vm.frames))
+	}
+}
+
+func TestTailCallsOff(t *testing.T) {
+	vm := New(WithMaxCallDepth(3), WithTailCalls(false))
+	_, err := run(vm, "function f(n) {\n  if (n > 0) return f(n - 1);\n}\nf(2);", "f(3);")
+	if err == nil || !strings.HasPrefix(err.Error(), "stack overflow: more than 3 nested calls\n<input>:2:28\n  f called at <input>:2:28 (2 times)\n  f called at <input>:1:4") {
+		t.Fatalf("got error %v, expected stack overflow", err)
+	}
+}